@@ -0,0 +1,512 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// the layout of an unbuilt app, items are stored one file per id in their directory
+const (
+	APP_SCRIPT_FILE    = "script.qvs"
+	APP_VARIABLES_FILE = "variables.json"
+	APP_DIMENSIONS_DIR = "dimensions"
+	APP_MEASURES_DIR   = "measures"
+	APP_OBJECTS_DIR    = "objects"
+	APP_SHEETS_DIR     = "sheets"
+	APP_BOOKMARKS_DIR  = "bookmarks"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// bookmarkFile holds a bookmark's properties with its selections, which the engine
+// only takes from the current selections when the bookmark is created.
+type bookmarkFile struct {
+	Properties json.RawMessage     `json:"qProp"`
+	StateData  []BookmarkStateData `json:"qStateData"`
+}
+
+// the directories of the kinds of items, in the order Build creates them
+var appDirs = []struct {
+	kind string
+	dir  string
+}{
+	{DIMENSION_TYPE, APP_DIMENSIONS_DIR},
+	{MEASURE_TYPE, APP_MEASURES_DIR},
+	{MASTER_OBJECT_TYPE, APP_OBJECTS_DIR},
+	{SHEET_TYPE, APP_SHEETS_DIR},
+	{BOOKMARK_TYPE, APP_BOOKMARKS_DIR},
+}
+
+// appSnapshot is what Unbuild writes of an app. items holds, by kind and id, the
+// properties of master items, the property trees of objects and the bookmark files,
+// as generic JSON values.
+type appSnapshot struct {
+	script    string
+	variables []GenericVariableProperties
+	items     map[string]map[string]interface{}
+}
+
+// Unbuild writes the app to dir: the load script, the variables not created by the
+// script, and one JSON file per master dimension, master measure, master object, sheet
+// with its objects and bookmark. Files are indented with sorted keys so changes to the
+// app diff well. Item directories are emptied first so removed items disappear.
+func Unbuild(doc *Doc, dir string) error {
+	snapshot, err := takeSnapshot(doc)
+	if err != nil {
+		return err
+	}
+	for _, sub := range appDirs {
+		err := os.RemoveAll(filepath.Join(dir, sub.dir))
+		if err == nil {
+			err = os.MkdirAll(filepath.Join(dir, sub.dir), 0755)
+		}
+		if err != nil {
+			return fmt.Errorf("error preparing [%s]:%v", dir, err)
+		}
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, APP_SCRIPT_FILE), []byte(snapshot.script), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing script [%s]:%v", dir, err)
+	}
+	err = writeJSON(filepath.Join(dir, APP_VARIABLES_FILE), snapshot.variables)
+	if err != nil {
+		return err
+	}
+	for _, sub := range appDirs {
+		for id, value := range snapshot.items[sub.kind] {
+			err = writeJSON(filepath.Join(dir, sub.dir, fileName(id)), value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func takeSnapshot(doc *Doc) (*appSnapshot, error) {
+	snapshot := &appSnapshot{items: map[string]map[string]interface{}{}}
+	for _, sub := range appDirs {
+		snapshot.items[sub.kind] = map[string]interface{}{}
+	}
+	var err error
+	snapshot.script, err = doc.GetScript()
+	if err != nil {
+		return nil, err
+	}
+	snapshot.variables, err = snapshotVariables(doc)
+	if err != nil {
+		return nil, err
+	}
+	dimensions, err := doc.Dimensions()
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range dimensions {
+		dimension, err := doc.GetDimension(item.Id)
+		if err != nil {
+			return nil, err
+		}
+		err = snapshot.addProperties(doc.api, dimension.Handle, DIMENSION_TYPE, item.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	measures, err := doc.Measures()
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range measures {
+		measure, err := doc.GetMeasure(item.Id)
+		if err != nil {
+			return nil, err
+		}
+		err = snapshot.addProperties(doc.api, measure.Handle, MEASURE_TYPE, item.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, objectType := range []string{MASTER_OBJECT_TYPE, SHEET_TYPE} {
+		items, err := doc.AppObjects(objectType)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			object, err := doc.GetObject(item.Id)
+			if err != nil {
+				return nil, err
+			}
+			entry, err := object.GetFullPropertyTree()
+			if err != nil {
+				return nil, err
+			}
+			err = snapshot.add(objectType, item.Id, entry)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return snapshot, snapshotBookmarks(doc, snapshot)
+}
+
+func snapshotVariables(doc *Doc) ([]GenericVariableProperties, error) {
+	items, err := doc.Variables()
+	if err != nil {
+		return nil, err
+	}
+	variables := []GenericVariableProperties{}
+	for _, item := range items {
+		if item.IsScriptCreated {
+			continue
+		}
+		variable, err := doc.GetVariableById(item.Id)
+		if err != nil {
+			return nil, err
+		}
+		properties, err := variable.GetProperties()
+		if err != nil {
+			return nil, err
+		}
+		variables = append(variables, properties)
+	}
+	sort.Slice(variables, func(i, j int) bool { return variables[i].Name < variables[j].Name })
+	return variables, nil
+}
+
+func snapshotBookmarks(doc *Doc, snapshot *appSnapshot) error {
+	items, err := doc.Bookmarks()
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		bookmark, err := doc.GetBookmark(item.Id)
+		if err != nil {
+			return err
+		}
+		var file bookmarkFile
+		file.Properties, err = rawProperties(doc.api, bookmark.Handle)
+		if err != nil {
+			return err
+		}
+		layout, err := bookmark.GetLayout()
+		if err != nil {
+			return err
+		}
+		file.StateData = layout.Bookmark.StateData
+		err = snapshot.add(BOOKMARK_TYPE, item.Id, file)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *appSnapshot) addProperties(api *API, handle int, kind, id string) error {
+	properties, err := rawProperties(api, handle)
+	if err != nil {
+		return err
+	}
+	return s.add(kind, id, properties)
+}
+
+func (s *appSnapshot) add(kind, id string, value interface{}) error {
+	tree, err := genericJSON(value)
+	if err != nil {
+		return err
+	}
+	s.items[kind][id] = tree
+	return nil
+}
+
+func rawProperties(api *API, handle int) (json.RawMessage, error) {
+	var result struct {
+		Properties json.RawMessage `json:"qProp"`
+	}
+	err := api.call(handle, "GetProperties", nil, &result)
+	return result.Properties, err
+}
+
+func fileName(id string) string {
+	return unsafeFileChars.ReplaceAllString(id, "_") + ".json"
+}
+
+// genericJSON converts value to maps, slices and scalars as unmarshalled into an
+// interface{}, which marshal with the keys of objects sorted.
+func genericJSON(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var tree interface{}
+	err = json.Unmarshal(data, &tree)
+	return tree, err
+}
+
+// writeJSON writes value indented, with the keys of objects sorted.
+func writeJSON(path string, value interface{}) error {
+	tree, err := genericJSON(value)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(tree, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path, append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing [%s]:%v", path, err)
+	}
+	return nil
+}
+
+// Build recreates an app written by Unbuild into doc. Items that exist are updated in
+// place, the others are created, and items of doc missing from dir are left alone.
+// Bookmarks are recreated by making their selections, which are cleared afterwards,
+// adding the alternate states they refer to.
+// Call DoSave to persist the app.
+func Build(doc *Doc, dir string) error {
+	script, err := ioutil.ReadFile(filepath.Join(dir, APP_SCRIPT_FILE))
+	if err == nil {
+		err = doc.SetScript(string(script))
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("error reading script [%s]:%v", dir, err)
+	}
+	err = buildVariables(doc, dir)
+	if err != nil {
+		return err
+	}
+	err = buildItems(doc, filepath.Join(dir, APP_DIMENSIONS_DIR), "Dimension")
+	if err != nil {
+		return err
+	}
+	err = buildItems(doc, filepath.Join(dir, APP_MEASURES_DIR), "Measure")
+	if err != nil {
+		return err
+	}
+	for _, sub := range []string{APP_OBJECTS_DIR, APP_SHEETS_DIR} {
+		err = buildObjects(doc, filepath.Join(dir, sub))
+		if err != nil {
+			return err
+		}
+	}
+	return buildBookmarks(doc, filepath.Join(dir, APP_BOOKMARKS_DIR))
+}
+
+func buildVariables(doc *Doc, dir string) error {
+	var variables []GenericVariableProperties
+	err := readJSON(filepath.Join(dir, APP_VARIABLES_FILE), &variables)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, properties := range variables {
+		variable, err := doc.GetVariableByName(properties.Name)
+		if err == ErrDoesNotExist {
+			_, err = doc.CreateVariableEx(properties)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		properties.Info.Id = variable.Id
+		err = variable.SetProperties(properties)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildItems creates or updates master items, kind being Dimension or Measure as in
+// the names of the Doc methods.
+func buildItems(doc *Doc, dir, kind string) error {
+	return eachFile(dir, func(path string) error {
+		var properties json.RawMessage
+		err := readJSON(path, &properties)
+		if err != nil {
+			return err
+		}
+		id, err := infoId(properties)
+		if err != nil {
+			return fmt.Errorf("error reading [%s]:%v", path, err)
+		}
+		handle, err := doc.api.callForHandle(doc.Handle, "Get"+kind, []interface{}{id})
+		if err == ErrDoesNotExist {
+			_, _, err = doc.createItem("Create"+kind, properties)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		return doc.api.call(handle.Handle, "SetProperties", []interface{}{properties}, nil)
+	})
+}
+
+func buildObjects(doc *Doc, dir string) error {
+	return eachFile(dir, func(path string) error {
+		var entry GenericObjectEntry
+		err := readJSON(path, &entry)
+		if err != nil {
+			return err
+		}
+		id, err := infoId(entry.Property)
+		if err != nil {
+			return fmt.Errorf("error reading [%s]:%v", path, err)
+		}
+		object, err := doc.GetObject(id)
+		if err == ErrDoesNotExist {
+			object, err = doc.CreateObject(entry.Property)
+		}
+		if err != nil {
+			return err
+		}
+		return object.SetFullPropertyTree(entry)
+	})
+}
+
+// buildBookmarks recreates the bookmarks by making their selections. Every state is
+// cleared before each bookmark so it only stores its own selections, and the alternate
+// states the bookmarks refer to are added to the app when missing.
+func buildBookmarks(doc *Doc, dir string) error {
+	var states []string
+	err := eachFile(dir, func(path string) error {
+		var file bookmarkFile
+		err := readJSON(path, &file)
+		if err != nil {
+			return err
+		}
+		id, err := infoId(file.Properties)
+		if err != nil {
+			return fmt.Errorf("error reading [%s]:%v", path, err)
+		}
+		if states == nil {
+			states, err = doc.AlternateStates()
+			if err != nil {
+				return err
+			}
+		}
+		for _, data := range file.StateData {
+			if data.StateName == DEFAULT_STATE || len(data.StateName) == 0 || hasString(states, data.StateName) {
+				continue
+			}
+			err = doc.AddAlternateState(data.StateName)
+			if err != nil {
+				return fmt.Errorf("error adding state [%s] of bookmark [%s]:%v", data.StateName, id, err)
+			}
+			states = append(states, data.StateName)
+		}
+		_, err = doc.GetBookmark(id)
+		if err == nil {
+			_, err = doc.DestroyBookmark(id)
+		}
+		if err != nil && err != ErrDoesNotExist {
+			return err
+		}
+		err = clearStates(doc, states)
+		if err != nil {
+			return err
+		}
+		for _, data := range file.StateData {
+			err = doc.applySelections(data.FieldItems, data.StateName)
+			if err != nil {
+				return fmt.Errorf("error selecting bookmark [%s]:%v", id, err)
+			}
+		}
+		_, _, err = doc.createItem("CreateBookmark", file.Properties)
+		return err
+	})
+	if err != nil || states == nil {
+		return err
+	}
+	return clearStates(doc, states)
+}
+
+// clearStates clears the selections of the default state and the alternate states.
+func clearStates(doc *Doc, states []string) error {
+	err := doc.ClearAll(false)
+	for _, state := range states {
+		if err != nil {
+			return err
+		}
+		err = doc.ClearAllInState(false, state)
+	}
+	return err
+}
+
+func hasString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// eachFile calls fn for the JSON files of dir in name order, if dir exists.
+func eachFile(dir string, fn func(path string) error) error {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading [%s]:%v", dir, err)
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		err = fn(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readJSON returns an error satisfying os.IsNotExist if the file is missing.
+func readJSON(path string, value interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, value)
+	if err != nil {
+		return fmt.Errorf("error parsing [%s]:%v", path, err)
+	}
+	return nil
+}
+
+func infoId(properties json.RawMessage) (string, error) {
+	var info struct {
+		Info NxInfo `json:"qInfo"`
+	}
+	err := json.Unmarshal(properties, &info)
+	if err == nil && len(info.Info.Id) == 0 {
+		err = fmt.Errorf("properties have no qInfo.qId")
+	}
+	return info.Info.Id, err
+}
@@ -0,0 +1,159 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"encoding/json"
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readTree reads the files under dir by their path relative to it.
+func readTree(t *testing.T, dir string) map[string]string {
+	retval := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		rel, _ := filepath.Rel(dir, path)
+		retval[rel] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return retval
+}
+
+func TestUnbuildBuildRoundTrip(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "Load 1 as A AutoGenerate 1;")
+	server.AddDoc("Copy.qvf", "")
+	doc := openTestDoc(t, server, "Sales.qvf")
+	if _, err := doc.CreateDimension(glik.NewDimensionProperties("dim-region", "Region", "Region")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.CreateMeasure(glik.NewMeasureProperties("kpi-revenue", "Revenue", "Sum(Sales)")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.CreateObject(map[string]interface{}{"qInfo": glik.NxInfo{Id: "master-kpi", Type: glik.MASTER_OBJECT_TYPE}, "visualization": glik.VIZ_KPI}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createLanding(doc); err != nil {
+		t.Fatal(err)
+	}
+	unbuilt := t.TempDir()
+	if err := glik.Unbuild(doc, unbuilt); err != nil {
+		t.Fatal(err)
+	}
+	files := readTree(t, unbuilt)
+	for _, name := range []string{glik.APP_SCRIPT_FILE, glik.APP_VARIABLES_FILE, "dimensions/dim-region.json", "measures/kpi-revenue.json", "objects/master-kpi.json", "sheets/landing.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing %s in %v", name, files)
+		}
+	}
+	if files[glik.APP_SCRIPT_FILE] != "Load 1 as A AutoGenerate 1;" || !strings.Contains(files["sheets/landing.json"], `"qChildren": [`) {
+		t.Errorf("got %v", files)
+	}
+	copy := openTestDoc(t, server, "Copy.qvf")
+	if err := glik.Build(copy, unbuilt); err != nil {
+		t.Fatal(err)
+	}
+	// building again updates the items in place
+	if err := glik.Build(copy, unbuilt); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt := t.TempDir()
+	if err := glik.Unbuild(copy, rebuilt); err != nil {
+		t.Fatal(err)
+	}
+	again := readTree(t, rebuilt)
+	if len(again) != len(files) {
+		t.Errorf("got %v files, want %v", len(again), len(files))
+	}
+	for name, data := range files {
+		if again[name] != data {
+			t.Errorf("%s differs after a round trip:\n%s\n%s", name, data, again[name])
+		}
+	}
+}
+
+// writeBookmark writes a bookmark file as Unbuild does.
+func writeBookmark(t *testing.T, dir, id string, stateData []glik.BookmarkStateData) {
+	properties := glik.BookmarkProperties{Info: glik.NxInfo{Id: id, Type: glik.BOOKMARK_TYPE}, MetaDef: glik.BookmarkMeta{Title: id}}
+	data, err := json.Marshal(map[string]interface{}{"qProp": properties, "qStateData": stateData})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, glik.APP_BOOKMARKS_DIR), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, glik.APP_BOOKMARKS_DIR, id+".json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildBookmarksInStates(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "").Fields = []string{"Region", "Year"}
+	states := []string{"Baseline"}
+	serveStates(server, &states)
+	server.Handle("Doc.ClearAll", func(call *enginetest.Call) (interface{}, error) {
+		return nil, nil
+	})
+	dir := t.TempDir()
+	region := func(value string) []glik.BookmarkFieldItem {
+		return []glik.BookmarkFieldItem{{Def: glik.BookmarkFieldDef{Name: "Region"}, Values: []glik.FieldValue{glik.TextValue(value)}}}
+	}
+	writeBookmark(t, dir, "bm1", []glik.BookmarkStateData{{StateName: glik.DEFAULT_STATE, FieldItems: region("North")}, {StateName: "Compare", FieldItems: region("West")}})
+	writeBookmark(t, dir, "bm2", []glik.BookmarkStateData{{StateName: glik.DEFAULT_STATE, FieldItems: region("South")}})
+	doc := openTestDoc(t, server, "Sales.qvf")
+	if err := glik.Build(doc, dir); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, request := range server.Requests() {
+		switch request.Method {
+		case "AddAlternateState", "ClearAll", "SelectValues", "CreateBookmark":
+			got = append(got, request.Method+" "+string(request.Params))
+		}
+	}
+	clearAll := []string{`ClearAll [false,""]`, `ClearAll [false,"Baseline"]`, `ClearAll [false,"Compare"]`}
+	want := []string{`AddAlternateState ["Compare"]`}
+	want = append(want, clearAll...)
+	want = append(want,
+		`ClearAll [false,"$"]`,
+		`SelectValues [[{"qText":"North","qIsNumeric":false,"qNumber":0}],false,false]`,
+		`ClearAll [false,"Compare"]`,
+		`SelectValues [[{"qText":"West","qIsNumeric":false,"qNumber":0}],false,false]`,
+		`CreateBookmark [{"qInfo":{"qId":"bm1","qType":"bookmark"},"qMetaDef":{"title":"bm1"}}]`)
+	want = append(want, clearAll...)
+	want = append(want,
+		`ClearAll [false,"$"]`,
+		`SelectValues [[{"qText":"South","qIsNumeric":false,"qNumber":0}],false,false]`,
+		`CreateBookmark [{"qInfo":{"qId":"bm2","qType":"bookmark"},"qMetaDef":{"title":"bm2"}}]`)
+	want = append(want, clearAll...)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sent\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(states) != 2 || states[1] != "Compare" {
+		t.Errorf("got states %v", states)
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"fmt"
+)
+
+const BOOKMARK_TYPE = "bookmark"
+const BOOKMARK_LIST_TYPE = "BookmarkList"
+
+// BookmarkMeta is the qMetaDef of a bookmark, shown in the client's bookmark list.
+type BookmarkMeta struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+type BookmarkProperties struct {
+	Info    NxInfo       `json:"qInfo"`
+	MetaDef BookmarkMeta `json:"qMetaDef"`
+}
+
+type BookmarkFieldDef struct {
+	Name string `json:"qName"`
+	Type string `json:"qType,omitempty"`
+}
+
+// BookmarkFieldItem is the stored selection of a field. Values holds the selected values,
+// or Def is selected through a search in SelectInfo.
+type BookmarkFieldItem struct {
+	Def            BookmarkFieldDef `json:"qDef"`
+	Values         []FieldValue     `json:"qValues"`
+	ExcludedValues []FieldValue     `json:"qExcludedValues,omitempty"`
+	AndMode        bool             `json:"qAndMode,omitempty"`
+	OneAndOnlyOne  bool             `json:"qOneAndOnlyOne,omitempty"`
+	Locked         bool             `json:"qLocked,omitempty"`
+	SelectInfo     *SelectInfo      `json:"qSelectInfo,omitempty"`
+}
+
+type SelectInfo struct {
+	TextSearch string `json:"qTextSearch,omitempty"`
+}
+
+// BookmarkStateData are the selections stored for a state, DEFAULT_STATE for the default one.
+type BookmarkStateData struct {
+	StateName  string              `json:"qStateName"`
+	FieldItems []BookmarkFieldItem `json:"qFieldItems"`
+}
+
+type BookmarkLayout struct {
+	Info NxInfo `json:"qInfo"`
+	Meta struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Published   bool   `json:"published"`
+	} `json:"qMeta"`
+	Bookmark struct {
+		StateData     []BookmarkStateData `json:"qStateData"`
+		UtcModifyTime float64             `json:"qUtcModifyTime"`
+	} `json:"qBookmark"`
+}
+
+// GenericBookmark is a bookmark of an app, see the GenericBookmark class of the engine api.
+type GenericBookmark struct {
+	api    *API
+	Handle int
+	Id     string
+}
+
+// CreateBookmark bookmarks the current selections of all states.
+func (d *Doc) CreateBookmark(title, description string) (*GenericBookmark, error) {
+	properties := BookmarkProperties{Info: NxInfo{Type: BOOKMARK_TYPE}, MetaDef: BookmarkMeta{Title: title, Description: description}}
+	handle, id, err := d.createItem("CreateBookmark", properties)
+	if err != nil {
+		return nil, err
+	}
+	return &GenericBookmark{api: d.api, Handle: handle.Handle, Id: id}, nil
+}
+
+// GetBookmark returns ErrDoesNotExist if the app has no bookmark with the id.
+func (d *Doc) GetBookmark(id string) (*GenericBookmark, error) {
+	handle, err := d.api.callForHandle(d.Handle, "GetBookmark", []interface{}{id})
+	if err != nil {
+		return nil, err
+	}
+	return &GenericBookmark{api: d.api, Handle: handle.Handle, Id: id}, nil
+}
+
+func (d *Doc) DestroyBookmark(id string) (bool, error) {
+	return d.destroyItem("DestroyBookmark", id)
+}
+
+// ApplyBookmark applies the selections of the bookmark with the id.
+func (d *Doc) ApplyBookmark(id string) (bool, error) {
+	var result struct {
+		Success bool `json:"qSuccess"`
+	}
+	err := d.call("ApplyBookmark", []interface{}{id}, &result)
+	return result.Success, err
+}
+
+// CloneBookmark copies a bookmark, returning the id of the copy.
+func (d *Doc) CloneBookmark(id string) (string, error) {
+	return d.cloneItem("CloneBookmark", id)
+}
+
+// BookmarkItem is a bookmark as listed by Bookmarks.
+type BookmarkItem struct {
+	Id          string
+	Title       string
+	Description string
+	Published   bool
+}
+
+// Bookmarks lists the app's bookmarks, through a session bookmark list object.
+func (d *Doc) Bookmarks() ([]BookmarkItem, error) {
+	properties := map[string]interface{}{
+		"qInfo": NxInfo{Type: BOOKMARK_LIST_TYPE},
+		"qBookmarkListDef": map[string]interface{}{
+			"qType": BOOKMARK_TYPE,
+			"qData": map[string]string{"title": "/qMetaDef/title", "description": "/qMetaDef/description"},
+		},
+	}
+	object, err := d.CreateSessionObject(properties)
+	if err != nil {
+		return nil, err
+	}
+	defer d.DestroySessionObject(object.Id)
+	var layout struct {
+		BookmarkList struct {
+			Items []struct {
+				Info NxInfo `json:"qInfo"`
+				Meta struct {
+					Published bool `json:"published"`
+				} `json:"qMeta"`
+				Data struct {
+					Title       string `json:"title"`
+					Description string `json:"description"`
+				} `json:"qData"`
+			} `json:"qItems"`
+		} `json:"qBookmarkList"`
+	}
+	err = object.GetLayout(&layout)
+	if err != nil {
+		return nil, err
+	}
+	retval := []BookmarkItem{}
+	for _, item := range layout.BookmarkList.Items {
+		retval = append(retval, BookmarkItem{Id: item.Info.Id, Title: item.Data.Title, Description: item.Data.Description, Published: item.Meta.Published})
+	}
+	return retval, nil
+}
+
+// FindBookmark returns the bookmark with the id, or else the one with the title.
+func (d *Doc) FindBookmark(idOrTitle string) (*GenericBookmark, error) {
+	items, err := d.Bookmarks()
+	if err != nil {
+		return nil, err
+	}
+	id := ""
+	for _, item := range items {
+		if item.Id == idOrTitle {
+			id = item.Id
+			break
+		}
+		if item.Title == idOrTitle {
+			if len(id) > 0 {
+				return nil, fmt.Errorf("error finding bookmark [%s]:more than one bookmark has the title", idOrTitle)
+			}
+			id = item.Id
+		}
+	}
+	if len(id) == 0 {
+		return nil, ErrDoesNotExist
+	}
+	return d.GetBookmark(id)
+}
+
+// ApplyBookmarkInState applies the default state selections stored in a bookmark to
+// an alternate state, clearing the state's selections first. The engine only applies
+// bookmarks to the states they were made in.
+func (d *Doc) ApplyBookmarkInState(id, state string) error {
+	bookmark, err := d.GetBookmark(id)
+	if err != nil {
+		return err
+	}
+	selections, err := bookmark.Selections(DEFAULT_STATE)
+	if err != nil {
+		return err
+	}
+	return d.applySelections(selections, state)
+}
+
+// applySelections clears the state's selections and selects the stored ones. Fields
+// stored as everything but their ExcludedValues get all values selected and the
+// excluded ones toggled off, OneAndOnlyOne and Locked are set on the field after
+// selecting. AND mode selections can not be made through the field api and are an error.
+func (d *Doc) applySelections(selections []BookmarkFieldItem, state string) error {
+	for _, item := range selections {
+		if item.AndMode {
+			return fmt.Errorf("error applying selections of field [%s]:and mode selections are not supported", item.Def.Name)
+		}
+	}
+	err := d.ClearAllInState(false, state)
+	if err != nil {
+		return err
+	}
+	for _, item := range selections {
+		field, err := d.FieldInState(item.Def.Name, state)
+		if err != nil {
+			return err
+		}
+		switch {
+		case item.SelectInfo != nil && len(item.SelectInfo.TextSearch) > 0:
+			_, err = field.Select(item.SelectInfo.TextSearch, false, EXCLUDED_VALUES_IGNORE)
+		case len(item.Values) == 0 && len(item.ExcludedValues) > 0:
+			_, err = field.SelectAll(false)
+			if err == nil {
+				_, err = field.SelectValues(item.ExcludedValues, true, false)
+			}
+		default:
+			_, err = field.SelectValues(item.Values, false, false)
+		}
+		if err != nil {
+			return err
+		}
+		if item.OneAndOnlyOne {
+			err = field.SetNxProperties(NxFieldProperties{OneAndOnlyOne: true})
+			if err != nil {
+				return err
+			}
+		}
+		if item.Locked {
+			_, err = field.Lock()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *GenericBookmark) call(method string, params interface{}, result interface{}) error {
+	return b.api.call(b.Handle, method, params, result)
+}
+
+func (b *GenericBookmark) GetLayout() (BookmarkLayout, error) {
+	var result struct {
+		Layout BookmarkLayout `json:"qLayout"`
+	}
+	err := b.call("GetLayout", nil, &result)
+	return result.Layout, err
+}
+
+func (b *GenericBookmark) GetProperties() (BookmarkProperties, error) {
+	var result struct {
+		Properties BookmarkProperties `json:"qProp"`
+	}
+	err := b.call("GetProperties", nil, &result)
+	return result.Properties, err
+}
+
+func (b *GenericBookmark) SetProperties(properties BookmarkProperties) error {
+	return b.call("SetProperties", []interface{}{properties}, nil)
+}
+
+// Selections returns the field selections stored for the state, DEFAULT_STATE or empty
+// for the default state.
+func (b *GenericBookmark) Selections(state string) ([]BookmarkFieldItem, error) {
+	layout, err := b.GetLayout()
+	if err != nil {
+		return nil, err
+	}
+	if len(state) == 0 {
+		state = DEFAULT_STATE
+	}
+	for _, data := range layout.Bookmark.StateData {
+		if data.StateName == state || (len(data.StateName) == 0 && state == DEFAULT_STATE) {
+			return data.FieldItems, nil
+		}
+	}
+	return []BookmarkFieldItem{}, nil
+}
+
+func (b *GenericBookmark) Apply() (bool, error) {
+	var result struct {
+		Success bool `json:"qSuccess"`
+	}
+	err := b.call("Apply", nil, &result)
+	return result.Success, err
+}
+
+// Publish makes the bookmark visible to the other users of a published app.
+func (b *GenericBookmark) Publish() error {
+	return b.call("Publish", nil, nil)
+}
+
+func (b *GenericBookmark) UnPublish() error {
+	return b.call("UnPublish", nil, nil)
+}
@@ -0,0 +1,148 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"strings"
+	"testing"
+)
+
+func TestBookmarkRoundTrip(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	doc := openTestDoc(t, server, "Sales.qvf")
+	ids := map[string]string{}
+	for _, title := range []string{"North", "South", "South"} {
+		bookmark, err := doc.CreateBookmark(title, "Sales of the "+title)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[title] = bookmark.Id
+	}
+	items, err := doc.Bookmarks()
+	if err != nil || len(items) != 3 {
+		t.Fatalf("got %+v, %v", items, err)
+	}
+	bookmark, err := doc.FindBookmark("North")
+	if err != nil || bookmark.Id != ids["North"] {
+		t.Errorf("got %+v, %v", bookmark, err)
+	}
+	properties, err := bookmark.GetProperties()
+	if err != nil || properties.MetaDef.Title != "North" || properties.MetaDef.Description != "Sales of the North" || properties.Info.Type != glik.BOOKMARK_TYPE {
+		t.Errorf("got %+v, %v", properties, err)
+	}
+	if bookmark, err := doc.FindBookmark(ids["South"]); err != nil || bookmark.Id != ids["South"] {
+		t.Errorf("got %+v, %v finding by id", bookmark, err)
+	}
+	if _, err := doc.FindBookmark("South"); err == nil || !strings.Contains(err.Error(), "more than one") {
+		t.Errorf("got %v for a shared title", err)
+	}
+	if _, err := doc.FindBookmark("West"); err != glik.ErrDoesNotExist {
+		t.Errorf("got %v for a missing bookmark", err)
+	}
+	if ok, err := doc.DestroyBookmark(ids["North"]); err != nil || !ok {
+		t.Errorf("got %v, %v", ok, err)
+	}
+	if _, err := doc.GetBookmark(ids["North"]); err != glik.ErrDoesNotExist {
+		t.Errorf("got %v for a destroyed bookmark", err)
+	}
+}
+
+// serveBookmarkStates scripts the bookmark layouts to hold the stored selections.
+func serveBookmarkStates(server *enginetest.Server, stateData []glik.BookmarkStateData) {
+	server.Handle("GenericBookmark.GetLayout", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qLayout": map[string]interface{}{
+			"qInfo":     call.Object().Properties["qInfo"],
+			"qBookmark": map[string]interface{}{"qStateData": stateData},
+		}}, nil
+	})
+}
+
+// selectionRequests lists the selection requests the server received as "Method params".
+func selectionRequests(server *enginetest.Server) []string {
+	retval := []string{}
+	for _, request := range server.Requests() {
+		switch request.Method {
+		case "OpenDoc", "CreateBookmark", "GetBookmark", "GetLayout":
+			continue
+		}
+		retval = append(retval, request.Method+" "+string(request.Params))
+	}
+	return retval
+}
+
+func TestApplyBookmarkInState(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "").Fields = []string{"Region", "Year", "Product", "Customer"}
+	server.Handle("Doc.ClearAll", func(call *enginetest.Call) (interface{}, error) {
+		return nil, nil
+	})
+	serveBookmarkStates(server, []glik.BookmarkStateData{
+		{StateName: "Compare", FieldItems: []glik.BookmarkFieldItem{{Def: glik.BookmarkFieldDef{Name: "Region"}, Values: []glik.FieldValue{glik.TextValue("West")}}}},
+		{StateName: glik.DEFAULT_STATE, FieldItems: []glik.BookmarkFieldItem{
+			{Def: glik.BookmarkFieldDef{Name: "Region"}, Values: []glik.FieldValue{glik.TextValue("North")}},
+			{Def: glik.BookmarkFieldDef{Name: "Year"}, ExcludedValues: []glik.FieldValue{glik.NumberValue(2016)}},
+			{Def: glik.BookmarkFieldDef{Name: "Product"}, SelectInfo: &glik.SelectInfo{TextSearch: "A*"}},
+			{Def: glik.BookmarkFieldDef{Name: "Customer"}, Values: []glik.FieldValue{glik.TextValue("Acme")}, OneAndOnlyOne: true, Locked: true},
+		}},
+	})
+	doc := openTestDoc(t, server, "Sales.qvf")
+	bookmark, err := doc.CreateBookmark("North", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.ApplyBookmarkInState(bookmark.Id, "Baseline"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`ClearAll [false,"Baseline"]`,
+		`GetField ["Region","Baseline"]`,
+		`SelectValues [[{"qText":"North","qIsNumeric":false,"qNumber":0}],false,false]`,
+		`GetField ["Year","Baseline"]`,
+		`SelectAll [false]`,
+		`SelectValues [[{"qText":"","qIsNumeric":true,"qNumber":2016}],true,false]`,
+		`GetField ["Product","Baseline"]`,
+		`Select ["A*",false,0]`,
+		`GetField ["Customer","Baseline"]`,
+		`SelectValues [[{"qText":"Acme","qIsNumeric":false,"qNumber":0}],false,false]`,
+		`SetNxProperties [{"qOneAndOnlyOne":true}]`,
+		`Lock []`,
+	}
+	got := selectionRequests(server)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sent\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestApplyBookmarkInStateAndMode(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "").Fields = []string{"Region"}
+	serveBookmarkStates(server, []glik.BookmarkStateData{{StateName: glik.DEFAULT_STATE, FieldItems: []glik.BookmarkFieldItem{
+		{Def: glik.BookmarkFieldDef{Name: "Region"}, ExcludedValues: []glik.FieldValue{glik.TextValue("North")}, AndMode: true},
+	}}})
+	doc := openTestDoc(t, server, "Sales.qvf")
+	bookmark, err := doc.CreateBookmark("Not North", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.ApplyBookmarkInState(bookmark.Id, "Baseline"); err == nil || !strings.Contains(err.Error(), "and mode") {
+		t.Errorf("got %v for an and mode selection", err)
+	}
+	if got := selectionRequests(server); len(got) != 0 {
+		t.Errorf("changed the state before failing: %v", got)
+	}
+}
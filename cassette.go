@@ -0,0 +1,547 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A cassette captures the QRS HTTP exchanges and Engine websocket frames of an API so
+// they can be served back later without a server, e.g. record once against a dev box:
+//
+//	cassette := api.Record("testdata/reload.json")
+//	... use api ...
+//	err := cassette.Save()
+//
+// and replay in CI:
+//
+//	cassette, err := api.Replay("testdata/reload.json")
+//
+// xrfkeys, session cookies, passwords and tickets are scrubbed before anything is kept.
+// Replay answers each request with the recorded response to the same request, it does
+// not reproduce the recorded timing.
+
+const scrubbed = "REDACTED"
+
+const (
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+const (
+	FrameSend = "send"
+	FrameRecv = "recv"
+)
+
+var ErrCassetteExhausted = errors.New("cassette: no more recorded traffic")
+
+var scrubbed_headers = []string{xrf_header, "Authorization", "Cookie", "Set-Cookie", "X-Qlik-Session"}
+var scrubbed_keys = []string{"password", "qpassword", "ticket", "secret", "token"}
+
+// scrubbed_credentials finds credentials inside connection strings, such as
+// "Pwd=secret;" in a qConnectionString or "XPassword is secret" in an ODBC connect.
+var scrubbed_credentials = regexp.MustCompile(`(?i)(\b(?:x?password|pwd|passwd)(?:\s*=\s*|\s+is\s+))("[^"]*"|[^;"),]*)`)
+
+// EngineConn is the message level connection the Engine API is spoken over. It is
+// satisfied by *websocket.Conn, recording and replay put their own in front of it.
+type EngineConn interface {
+	WriteMessage(messageType int, data []byte) error
+	ReadMessage() (messageType int, p []byte, err error)
+	Close() error
+}
+
+// Interaction is one recorded QRS/QPS HTTP exchange.
+type Interaction struct {
+	Method          string        `json:"method"`
+	Url             string        `json:"url"`
+	RequestHeaders  http.Header   `json:"requestHeaders,omitempty"`
+	RequestBody     string        `json:"requestBody,omitempty"`
+	Status          int           `json:"status"`
+	ResponseHeaders http.Header   `json:"responseHeaders,omitempty"`
+	ResponseBody    string        `json:"responseBody,omitempty"`
+	Offset          time.Duration `json:"offset"`
+	Duration        time.Duration `json:"duration"`
+	replayed        bool
+}
+
+// Frame is one recorded Engine websocket message. Conn numbers the websocket connections
+// opened by the API, RequestId and Method are lifted from the JSON-RPC message.
+type Frame struct {
+	Conn      int             `json:"conn"`
+	Url       string          `json:"url,omitempty"`
+	Direction string          `json:"direction"`
+	RequestId int             `json:"requestId,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	Offset    time.Duration   `json:"offset"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+	Frames       []*Frame       `json:"frames"`
+	mode         string
+	path         string
+	start        time.Time
+	conns        int
+	mu           sync.Mutex
+}
+
+// Record starts recording the API's traffic into a cassette, written to path by Save.
+func (api *API) Record(path string) *Cassette {
+	api.cassette = &Cassette{mode: CassetteRecord, path: path, start: time.Now(), Interactions: []*Interaction{}, Frames: []*Frame{}}
+	return api.cassette
+}
+
+// Replay serves the API's QRS requests and Engine connections from the cassette at path.
+func (api *API) Replay(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cassette := &Cassette{mode: CassetteReplay, path: path, start: time.Now()}
+	err = json.Unmarshal(data, cassette)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cassette [%s]:%v", path, err)
+	}
+	api.cassette = cassette
+	return cassette, nil
+}
+
+func (c *Cassette) Mode() string {
+	return c.mode
+}
+
+// Save writes a recording cassette to its path.
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, data, 0644)
+}
+
+func (c *Cassette) transport(next http.RoundTripper) http.RoundTripper {
+	if c.mode == CassetteReplay {
+		return replayTransport{c}
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return recordTransport{c, next}
+}
+
+// dial opens the Engine connection for the cassette, live is only called when recording.
+func (c *Cassette) dial(engineUrl string, live func() (EngineConn, error)) (EngineConn, error) {
+	c.mu.Lock()
+	c.conns++
+	conn := c.conns
+	c.mu.Unlock()
+	if c.mode == CassetteReplay {
+		return newReplayConn(c, conn), nil
+	}
+	inner, err := live()
+	if err != nil {
+		return nil, err
+	}
+	return &recordConn{cassette: c, conn: conn, url: engineUrl, inner: inner}, nil
+}
+
+type recordTransport struct {
+	cassette *Cassette
+	next     http.RoundTripper
+}
+
+func (t recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	started := time.Now()
+	var requestBody []byte
+	if req.Body != nil {
+		var err error
+		requestBody, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+	interaction := &Interaction{Method: req.Method,
+		Url:             scrubUrl(req.URL),
+		RequestHeaders:  scrubHeaders(req.Header),
+		RequestBody:     string(scrubBody(requestBody)),
+		Status:          resp.StatusCode,
+		ResponseHeaders: scrubHeaders(resp.Header),
+		ResponseBody:    string(scrubBody(responseBody)),
+		Offset:          started.Sub(t.cassette.start),
+		Duration:        time.Since(started)}
+	t.cassette.mu.Lock()
+	t.cassette.Interactions = append(t.cassette.Interactions, interaction)
+	t.cassette.mu.Unlock()
+	return resp, nil
+}
+
+type replayTransport struct {
+	cassette *Cassette
+}
+
+func (t replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	target := scrubUrl(req.URL)
+	t.cassette.mu.Lock()
+	defer t.cassette.mu.Unlock()
+	for _, interaction := range t.cassette.Interactions {
+		if interaction.replayed || interaction.Method != req.Method || !sameRequestUri(interaction.Url, target) {
+			continue
+		}
+		interaction.replayed = true
+		header := http.Header{}
+		for key, values := range interaction.ResponseHeaders {
+			header[key] = values
+		}
+		return &http.Response{Status: fmt.Sprintf("%v %s", interaction.Status, http.StatusText(interaction.Status)),
+			StatusCode:    interaction.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(interaction.ResponseBody)),
+			ContentLength: int64(len(interaction.ResponseBody)),
+			Request:       req}, nil
+	}
+	return nil, fmt.Errorf("cassette: no recorded interaction for %s %s", req.Method, target)
+}
+
+// sameRequestUri compares recorded urls ignoring the host, test servers get a new port every run.
+func sameRequestUri(recorded, target string) bool {
+	a, err := url.Parse(recorded)
+	if err != nil {
+		return false
+	}
+	b, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	return a.Path == b.Path && a.Query().Encode() == b.Query().Encode()
+}
+
+type recordConn struct {
+	cassette *Cassette
+	conn     int
+	url      string
+	inner    EngineConn
+}
+
+func (r *recordConn) WriteMessage(messageType int, data []byte) error {
+	r.record(FrameSend, data)
+	return r.inner.WriteMessage(messageType, data)
+}
+
+func (r *recordConn) ReadMessage() (int, []byte, error) {
+	messageType, data, err := r.inner.ReadMessage()
+	if err == nil {
+		r.record(FrameRecv, data)
+	}
+	return messageType, data, err
+}
+
+func (r *recordConn) Close() error {
+	return r.inner.Close()
+}
+
+func (r *recordConn) record(direction string, data []byte) {
+	var message struct {
+		Id     int    `json:"id"`
+		Method string `json:"method"`
+	}
+	json.Unmarshal(data, &message)
+	frame := &Frame{Conn: r.conn, Direction: direction, RequestId: message.Id, Method: message.Method, Data: json.RawMessage(scrubBody(data))}
+	r.cassette.mu.Lock()
+	defer r.cassette.mu.Unlock()
+	frame.Offset = time.Since(r.cassette.start)
+	if len(r.cassette.Frames) == 0 || r.cassette.Frames[len(r.cassette.Frames)-1].Conn != r.conn {
+		frame.Url = r.url
+	}
+	r.cassette.Frames = append(r.cassette.Frames, frame)
+}
+
+// replayConn plays back the frames of one recorded connection. Each write is matched to
+// a recorded request with the same method, handle and params, whose response is then
+// queued for reading with its request id mapped to the id actually sent. Identical
+// requests, such as GetProgress polls, get their recorded responses in order and then
+// the last one again, so a replay may poll more or less often than the recording did.
+type replayConn struct {
+	exchanges []*replayExchange
+	ids       map[int]int
+	pending   [][]byte
+	ready     chan struct{}
+	closed    chan struct{}
+	mu        sync.Mutex
+	once      sync.Once
+}
+
+// replayExchange is a recorded request with its response and the notifications
+// received after it.
+type replayExchange struct {
+	method    string
+	handle    int
+	params    interface{}
+	requestId int
+	replies   []*Frame
+	used      bool
+}
+
+// request_id_methods take the id of an earlier request as their first param.
+var request_id_methods = map[string]bool{"GetProgress": true, "CancelRequest": true}
+
+type replayMessage struct {
+	Id     int             `json:"id"`
+	Method string          `json:"method"`
+	Handle int             `json:"handle"`
+	Params json.RawMessage `json:"params"`
+}
+
+func newReplayConn(cassette *Cassette, conn int) *replayConn {
+	r := &replayConn{ids: make(map[int]int), ready: make(chan struct{}, 1), closed: make(chan struct{})}
+	byId := map[int]*replayExchange{}
+	var last *replayExchange
+	cassette.mu.Lock()
+	for _, frame := range cassette.Frames {
+		if frame.Conn != conn {
+			continue
+		}
+		if frame.Direction == FrameSend {
+			var message replayMessage
+			json.Unmarshal(frame.Data, &message)
+			last = &replayExchange{method: frame.Method, handle: message.Handle, params: decodeParams(message.Params), requestId: frame.RequestId}
+			r.exchanges = append(r.exchanges, last)
+			byId[frame.RequestId] = last
+			continue
+		}
+		if exchange, ok := byId[frame.RequestId]; ok && frame.RequestId != 0 {
+			exchange.replies = append(exchange.replies, frame)
+		} else if last != nil {
+			last.replies = append(last.replies, frame)
+		} else {
+			// notifications sent on connect, e.g. OnConnected
+			r.push(frame.Data)
+		}
+	}
+	cassette.mu.Unlock()
+	return r
+}
+
+func decodeParams(raw json.RawMessage) interface{} {
+	var params interface{}
+	if len(raw) > 0 {
+		json.Unmarshal(raw, &params)
+	}
+	return params
+}
+
+func (r *replayConn) WriteMessage(messageType int, data []byte) error {
+	var message replayMessage
+	if err := json.Unmarshal(scrubBody(data), &message); err != nil {
+		return err
+	}
+	params := decodeParams(message.Params)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var match *replayExchange
+	for _, exchange := range r.exchanges {
+		if exchange.method != message.Method || exchange.handle != message.Handle || !r.sameParams(exchange, params) {
+			continue
+		}
+		match = exchange
+		if !exchange.used {
+			break
+		}
+	}
+	if match == nil {
+		return fmt.Errorf("cassette: no recorded %s request on handle %v with params %s", message.Method, message.Handle, string(message.Params))
+	}
+	match.used = true
+	r.ids[match.requestId] = message.Id
+	for _, frame := range match.replies {
+		data := []byte(frame.Data)
+		if frame.RequestId == match.requestId && frame.RequestId != 0 {
+			var reply map[string]interface{}
+			if json.Unmarshal(data, &reply) == nil {
+				reply["id"] = message.Id
+				data, _ = json.Marshal(reply)
+			}
+		}
+		r.push(data)
+	}
+	return nil
+}
+
+// sameParams compares the recorded params with the params sent, with request ids
+// passed as params mapped to the ids sent in the replay.
+func (r *replayConn) sameParams(exchange *replayExchange, params interface{}) bool {
+	recorded := exchange.params
+	if request_id_methods[exchange.method] {
+		if positional, ok := recorded.([]interface{}); ok && len(positional) > 0 {
+			if id, ok := positional[0].(float64); ok {
+				if live, ok := r.ids[int(id)]; ok {
+					positional = append([]interface{}{float64(live)}, positional[1:]...)
+					recorded = positional
+				}
+			}
+		}
+	}
+	return reflect.DeepEqual(recorded, params)
+}
+
+// push queues a frame for reading, the caller holds r.mu or owns r.
+func (r *replayConn) push(data []byte) {
+	r.pending = append(r.pending, data)
+	select {
+	case r.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (r *replayConn) ReadMessage() (int, []byte, error) {
+	for {
+		r.mu.Lock()
+		if len(r.pending) > 0 {
+			data := r.pending[0]
+			r.pending = r.pending[1:]
+			r.mu.Unlock()
+			return websocket.TextMessage, data, nil
+		}
+		r.mu.Unlock()
+		select {
+		case <-r.ready:
+		case <-r.closed:
+			return 0, nil, ErrCassetteExhausted
+		}
+	}
+}
+
+func (r *replayConn) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	return nil
+}
+
+func scrubUrl(u *url.URL) string {
+	scrubbedUrl := *u
+	query := u.Query()
+	if len(query.Get("xrfkey")) > 0 {
+		query.Set("xrfkey", scrubbed)
+		scrubbedUrl.RawQuery = query.Encode()
+	}
+	return scrubbedUrl.String()
+}
+
+func scrubHeaders(headers http.Header) http.Header {
+	retval := http.Header{}
+	for key, values := range headers {
+		retval[key] = values
+	}
+	for _, key := range scrubbed_headers {
+		if len(retval.Get(key)) > 0 {
+			retval.Set(key, scrubbed)
+		}
+	}
+	return retval
+}
+
+// scrubBody redacts secret values in JSON bodies, anything else is kept as is.
+func scrubBody(body []byte) []byte {
+	var value interface{}
+	if len(body) == 0 || json.Unmarshal(body, &value) != nil {
+		return body
+	}
+	if !scrubValue(value) {
+		return body
+	}
+	retval, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+	return retval
+}
+
+func scrubValue(value interface{}) bool {
+	changed := false
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			if isSecretKey(key) {
+				if s, ok := child.(string); ok && len(s) > 0 {
+					typed[key] = scrubbed
+					changed = true
+				}
+				continue
+			}
+			if s, ok := child.(string); ok {
+				if clean := scrubCredentials(s); clean != s {
+					typed[key] = clean
+					changed = true
+				}
+				continue
+			}
+			changed = scrubValue(child) || changed
+		}
+	case []interface{}:
+		for i, child := range typed {
+			if s, ok := child.(string); ok {
+				if clean := scrubCredentials(s); clean != s {
+					typed[i] = clean
+					changed = true
+				}
+				continue
+			}
+			changed = scrubValue(child) || changed
+		}
+	}
+	return changed
+}
+
+// scrubCredentials redacts the passwords of a connection string, leaving the rest.
+func scrubCredentials(value string) string {
+	return scrubbed_credentials.ReplaceAllString(value, "${1}"+scrubbed)
+}
+
+func isSecretKey(key string) bool {
+	for _, secret := range scrubbed_keys {
+		if strings.EqualFold(key, secret) {
+			return true
+		}
+	}
+	return false
+}
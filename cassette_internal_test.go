@@ -0,0 +1,43 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import "testing"
+
+func TestScrubCredentials(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"Server=dw;Uid=etl;Pwd=hunter2;Database=sales", "Server=dw;Uid=etl;Pwd=REDACTED;Database=sales"},
+		{"host=dw;password = hunter2", "host=dw;password = REDACTED"},
+		{`CUSTOM CONNECT TO "provider=QvOdbcConnectorPackage.exe;host=dw;XUserId=etl;XPassword=VbZKTBA;"`, `CUSTOM CONNECT TO "provider=QvOdbcConnectorPackage.exe;host=dw;XUserId=etl;XPassword=REDACTED;"`},
+		{"ODBC CONNECT TO [dw] (XUserId is etl, XPassword is VbZKTBA)", "ODBC CONNECT TO [dw] (XUserId is etl, XPassword is REDACTED)"},
+		{`OLEDB CONNECT TO [Provider=SQLOLEDB;Password="a;b";User ID=etl]`, `OLEDB CONNECT TO [Provider=SQLOLEDB;Password=REDACTED;User ID=etl]`},
+		{"Load Password, UserPwd From users.csv;", "Load Password, UserPwd From users.csv;"},
+	}
+	for _, test := range tests {
+		if got := scrubCredentials(test.value); got != test.want {
+			t.Errorf("got %s, want %s", got, test.want)
+		}
+	}
+}
+
+func TestScrubBody(t *testing.T) {
+	body := []byte(`{"params":[{"qName":"DW","qConnectionString":"Server=dw;Pwd=x1","qPassword":"x2"}],"ticket":"abc"}`)
+	want := `{"params":[{"qConnectionString":"Server=dw;Pwd=REDACTED","qName":"DW","qPassword":"REDACTED"}],"ticket":"REDACTED"}`
+	if got := string(scrubBody(body)); got != want {
+		t.Errorf("got %s", got)
+	}
+	if got := string(scrubBody([]byte("not json Pwd=x"))); got != "not json Pwd=x" {
+		t.Errorf("got %s", got)
+	}
+}
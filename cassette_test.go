@@ -0,0 +1,157 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"github.com/mattbaird/glik/qrstest"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCassetteScrubsSecrets(t *testing.T) {
+	store := qrstest.NewStore()
+	server := qrstest.NewServer(store)
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "connections.json")
+	api := server.API()
+	cassette := api.Record(path)
+	connection := glik.DataConnection{Name: "DW", Type: glik.CONNECTION_ODBC, UserName: "etl", Password: "s3cret",
+		ConnectionString: "Driver={SQL Server};Server=dw;Uid=etl;Pwd=hunter2;Database=sales"}
+	if _, err := api.CreateDataConnection(connection); err != nil {
+		t.Fatal(err)
+	}
+	if err := cassette.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"s3cret", "hunter2", api.XrfKey} {
+		if len(secret) > 0 && strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q:\n%s", secret, data)
+		}
+	}
+	if !strings.Contains(string(data), "Pwd=REDACTED;Database=sales") {
+		t.Errorf("connection string was not scrubbed in place:\n%s", data)
+	}
+}
+
+func TestCassetteReplaysQrs(t *testing.T) {
+	store := qrstest.NewStore()
+	store.AddApp("Sales")
+	server := qrstest.NewServer(store)
+	path := filepath.Join(t.TempDir(), "apps.json")
+	api := server.API()
+	cassette := api.Record(path)
+	if _, err := api.List(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cassette.Save(); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	replay := server.API()
+	if _, err := replay.Replay(path); err != nil {
+		t.Fatal(err)
+	}
+	apps, err := replay.List()
+	if err != nil || len(apps) != 1 || apps[0].Name != "Sales" {
+		t.Fatalf("got %+v, %v", apps, err)
+	}
+	if _, err := replay.List(); err == nil {
+		t.Error("expected an error once the interaction was replayed")
+	}
+}
+
+// recordReload records opening an app and reloading it with progress polls.
+func recordReload(t *testing.T, path string) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "Load 1 as A AutoGenerate 1;")
+	server.Handle("DoReload", func(call *enginetest.Call) (interface{}, error) {
+		time.Sleep(50 * time.Millisecond)
+		return map[string]interface{}{"qReturn": true}, nil
+	})
+	polls := 0
+	server.Handle("GetProgress", func(call *enginetest.Call) (interface{}, error) {
+		polls++
+		return map[string]interface{}{"qProgressData": glik.ProgressData{Started: true, Completed: polls, Total: 10}}, nil
+	})
+	api := server.API()
+	cassette := api.Record(path)
+	if err := api.OpenWebSocket(); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := api.OpenDoc("Sales.qvf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.GetScript(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.DoReloadWithProgress(glik.RELOAD_MODE_DEFAULT, false, 5*time.Millisecond, func(glik.ProgressData) {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.SetScript("Load 2 as A AutoGenerate 1;"); err != nil {
+		t.Fatal(err)
+	}
+	api.CloseWebSocket()
+	if err := cassette.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCassetteReplaysEngineByRequest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reload.json")
+	recordReload(t, path)
+	// replay polling at other rates and with requests out of the recorded order
+	for _, interval := range []time.Duration{time.Millisecond, time.Hour} {
+		api := glik.NewAPI("localhost", glik.DEFAULT_DIR, glik.DEFAULT_USER, 0, 0, 1)
+		if _, err := api.Replay(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := api.OpenWebSocket(); err != nil {
+			t.Fatal(err)
+		}
+		doc, err := api.OpenDoc("Sales.qvf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := doc.SetScript("Load 2 as A AutoGenerate 1;"); err != nil {
+			t.Fatal(err)
+		}
+		calls := 0
+		success, err := doc.DoReloadWithProgress(glik.RELOAD_MODE_DEFAULT, false, interval, func(progress glik.ProgressData) {
+			if progress.Total != 10 {
+				t.Errorf("got progress %+v", progress)
+			}
+			calls++
+		})
+		if err != nil || !success || calls == 0 {
+			t.Errorf("interval %v: got %v, %v after %v progress calls", interval, success, err, calls)
+		}
+		script, err := doc.GetScript()
+		if err != nil || script != "Load 1 as A AutoGenerate 1;" {
+			t.Errorf("got %q, %v", script, err)
+		}
+		if _, err := doc.Evaluate("Sum(A)"); err == nil || !strings.Contains(err.Error(), "no recorded Evaluate") {
+			t.Errorf("got %v for an unrecorded request", err)
+		}
+		api.CloseWebSocket()
+	}
+}
@@ -21,8 +21,8 @@ import (
 	"github.com/AtScaleInc/apps-shared/httputil"
 	"github.com/gorilla/websocket"
 	"github.com/satori/go.uuid"
+	"io"
 	"io/ioutil"
-	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -37,6 +37,7 @@ const content_length_header = "Content-Length"
 const xrf_header = "X-Qlik-Xrfkey"
 const qlik_user_header = "X-Qlik-User"
 const application_json_content_type = "application/xml"
+const qvf_content_type = "application/vnd.qlik.sense.app"
 const user_header_value = "UserDirectory=%s; UserId=%s"
 const POST = "POST"
 const GET = "GET"
@@ -50,7 +51,7 @@ var API_VERSION = "2.2"
 //http://help.qlik.com/en-US/sense-developer/2.2/Subsystems/RepositoryServiceAPI/Content/RepositoryServiceAPI/RepositoryServiceAPI-About-API-Get-Description.htm
 func (api *API) About() (About, error) {
 	xrfKey := makeXrfKey()
-	url := fmt.Sprintf("%s://%s:%v/qrs/about?xrfkey=%s", "https", api.Server, api.QrsPort, xrfKey)
+	url := api.qrsUrl("about", xrfQuery(xrfKey))
 	var retval About
 	headers := make(map[string]string)
 	headers[xrf_header] = xrfKey
@@ -63,7 +64,10 @@ func (api *API) About() (About, error) {
 //http://help.qlik.com/en-US/sense-developer/2.2/Subsystems/RepositoryServiceAPI/Content/RepositoryServiceAPI/RepositoryServiceAPI-App-Publish.htm
 func (api *API) Publish(appId, streamId, name string) (ApplicationResult, error) {
 	xrfKey := makeXrfKey()
-	url := fmt.Sprintf("%s://%s:%v/qrs/app/%s/publish?stream=%s&name=%s&xrfkey=%s", "https", api.Server, api.QrsPort, appId, streamId, url.QueryEscape(name), xrfKey)
+	query := xrfQuery(xrfKey)
+	query.Set("stream", streamId)
+	query.Set("name", name)
+	url := api.qrsUrl("app/"+appId+"/publish", query)
 	var retval ApplicationResult
 	headers := make(map[string]string)
 	headers[xrf_header] = xrfKey
@@ -76,7 +80,9 @@ func (api *API) Publish(appId, streamId, name string) (ApplicationResult, error)
 //http://help.qlik.com/en-US/sense-developer/2.2/Subsystems/RepositoryServiceAPI/Content/RepositoryServiceAPI/RepositoryServiceAPI-App-Make-Copy.htm
 func (api *API) Copy(appId, name string) (ApplicationResult, error) {
 	xrfKey := makeXrfKey()
-	url := fmt.Sprintf("%s://%s:%v/qrs/app/%s/copy?name=%s&xrfkey=%s", "https", api.Server, api.QrsPort, appId, url.QueryEscape(name), xrfKey)
+	query := xrfQuery(xrfKey)
+	query.Set("name", name)
+	url := api.qrsUrl("app/"+appId+"/copy", query)
 	var retval ApplicationResult
 	headers := make(map[string]string)
 	headers[xrf_header] = xrfKey
@@ -89,7 +95,7 @@ func (api *API) Copy(appId, name string) (ApplicationResult, error) {
 //http://help.qlik.com/en-US/sense-developer/2.2/Subsystems/RepositoryServiceAPI/Content/RepositoryServiceAPI/RepositoryServiceAPI-App-Publish.htm
 func (api *API) List() ([]ApplicationResult, error) {
 	xrfKey := makeXrfKey()
-	url := fmt.Sprintf("%s://%s:%v/qrs/app?xrfkey=%s", "https", api.Server, api.QrsPort, xrfKey)
+	url := api.qrsUrl("app", xrfQuery(xrfKey))
 	var retval []ApplicationResult
 	headers := make(map[string]string)
 	headers[xrf_header] = xrfKey
@@ -102,7 +108,7 @@ func (api *API) List() ([]ApplicationResult, error) {
 //http://help.qlik.com/en-US/sense-developer/2.2/Subsystems/RepositoryServiceAPI/Content/RepositoryServiceAPI/RepositoryServiceAPI-App-Reload.htm
 func (api *API) Reload(appId string) error {
 	xrfKey := makeXrfKey()
-	url := fmt.Sprintf("%s://%s:%v/qrs/app/%s/reload?xrfkey=%s", "https", api.Server, api.QrsPort, appId, xrfKey)
+	url := api.qrsUrl("app/"+appId+"/reload", xrfQuery(xrfKey))
 	headers := make(map[string]string)
 	headers[xrf_header] = xrfKey
 	headers[qlik_user_header] = api.makeQlikUserHeader()
@@ -111,10 +117,104 @@ func (api *API) Reload(appId string) error {
 	return err
 }
 
+//http://help.qlik.com/en-US/sense-developer/2.2/Subsystems/RepositoryServiceAPI/Content/RepositoryServiceAPI/RepositoryServiceAPI-App-Delete.htm
+func (api *API) Delete(appId string) error {
+	xrfKey := makeXrfKey()
+	url := api.qrsUrl("app/"+appId, xrfQuery(xrfKey))
+	headers := make(map[string]string)
+	headers[xrf_header] = xrfKey
+	headers[qlik_user_header] = api.makeQlikUserHeader()
+	headers[content_type_header] = application_json_content_type
+	return api.makeRequest(url, DELETE, nil, nil, headers, connectTimeOut, readWriteTimeout)
+}
+
+//http://help.qlik.com/en-US/sense-developer/2.2/Subsystems/RepositoryServiceAPI/Content/RepositoryServiceAPI/RepositoryServiceAPI-App-Export.htm
+// Export writes the app's qvf to w, the app is first exported to get a download ticket.
+func (api *API) Export(appId string, w io.Writer) error {
+	xrfKey := makeXrfKey()
+	url := api.qrsUrl("app/"+appId+"/export", xrfQuery(xrfKey))
+	var ticket ExportTicket
+	headers := make(map[string]string)
+	headers[xrf_header] = xrfKey
+	headers[qlik_user_header] = api.makeQlikUserHeader()
+	headers[content_type_header] = application_json_content_type
+	err := api.makeRequest(url, GET, nil, &ticket, headers, connectTimeOut, readWriteTimeout)
+	if err != nil {
+		return err
+	}
+	url = api.qrsUrl("download/app/"+appId+"/"+ticket.Value+"/"+appId+".qvf", xrfQuery(xrfKey))
+	return api.download(url, w, headers, connectTimeOut, downloadTimeout)
+}
+
+//http://help.qlik.com/en-US/sense-developer/2.2/Subsystems/RepositoryServiceAPI/Content/RepositoryServiceAPI/RepositoryServiceAPI-App-Import-Upload.htm
+// Upload imports a qvf as a new app called name.
+func (api *API) Upload(name string, qvf io.Reader) (ApplicationResult, error) {
+	var retval ApplicationResult
+	xrfKey := makeXrfKey()
+	query := xrfQuery(xrfKey)
+	query.Set("name", name)
+	url := api.qrsUrl("app/upload", query)
+	headers := make(map[string]string)
+	headers[xrf_header] = xrfKey
+	headers[qlik_user_header] = api.makeQlikUserHeader()
+	headers[content_type_header] = qvf_content_type
+	err := api.upload(url, qvf, &retval, headers, connectTimeOut, downloadTimeout)
+	return retval, err
+}
+
+//http://help.qlik.com/en-US/sense-developer/2.2/Subsystems/RepositoryServiceAPI/Content/RepositoryServiceAPI/RepositoryServiceAPI-Stream-Get.htm
+func (api *API) Streams() ([]Stream, error) {
+	xrfKey := makeXrfKey()
+	url := api.qrsUrl("stream", xrfQuery(xrfKey))
+	var retval []Stream
+	headers := make(map[string]string)
+	headers[xrf_header] = xrfKey
+	headers[qlik_user_header] = api.makeQlikUserHeader()
+	headers[content_type_header] = application_json_content_type
+	err := api.makeRequest(url, GET, nil, &retval, headers, connectTimeOut, readWriteTimeout)
+	return retval, err
+}
+
+//http://help.qlik.com/en-US/sense-developer/2.2/Subsystems/RepositoryServiceAPI/Content/RepositoryServiceAPI/RepositoryServiceAPI-Task-Get.htm
+func (api *API) ReloadTasks() ([]ReloadTask, error) {
+	xrfKey := makeXrfKey()
+	url := api.qrsUrl("reloadtask", xrfQuery(xrfKey))
+	var retval []ReloadTask
+	headers := make(map[string]string)
+	headers[xrf_header] = xrfKey
+	headers[qlik_user_header] = api.makeQlikUserHeader()
+	headers[content_type_header] = application_json_content_type
+	err := api.makeRequest(url, GET, nil, &retval, headers, connectTimeOut, readWriteTimeout)
+	return retval, err
+}
+
+//http://help.qlik.com/en-US/sense-developer/2.2/Subsystems/RepositoryServiceAPI/Content/RepositoryServiceAPI/RepositoryServiceAPI-Task-Start.htm
+func (api *API) StartTask(taskId string) error {
+	xrfKey := makeXrfKey()
+	url := api.qrsUrl("task/"+taskId+"/start", xrfQuery(xrfKey))
+	headers := make(map[string]string)
+	headers[xrf_header] = xrfKey
+	headers[qlik_user_header] = api.makeQlikUserHeader()
+	headers[content_type_header] = application_json_content_type
+	return api.makeRequest(url, POST, nil, nil, headers, connectTimeOut, readWriteTimeout)
+}
+
+func (api *API) StartTaskByName(name string) error {
+	xrfKey := makeXrfKey()
+	query := xrfQuery(xrfKey)
+	query.Set("name", name)
+	url := api.qrsUrl("task/start", query)
+	headers := make(map[string]string)
+	headers[xrf_header] = xrfKey
+	headers[qlik_user_header] = api.makeQlikUserHeader()
+	headers[content_type_header] = application_json_content_type
+	return api.makeRequest(url, POST, nil, nil, headers, connectTimeOut, readWriteTimeout)
+}
+
 func (api *API) getTicket() error {
 	//	https://localhost:4243/qps/ticket
 	xrfKey := makeXrfKey()
-	url := fmt.Sprintf("%s://%s:%v/qps/ticket?xrfkey=%s", "https", api.Server, api.AuthPort, xrfKey)
+	url := api.qpsUrl("ticket", xrfQuery(xrfKey))
 	headers := make(map[string]string)
 	headers[xrf_header] = xrfKey
 	headers[qlik_user_header] = api.makeQlikUserHeader()
@@ -127,6 +227,9 @@ func (api *API) getTicket() error {
 //https://help.qlik.com/en-US/sense-developer/2.1/Subsystems/EngineAPI/Content/CreatingAppLoadingData/CreateApps/create-app.htm
 func (api *API) Create(name, localizedScriptMainSection string) (Response, error) {
 	command := CreateApp(name)
+	if len(localizedScriptMainSection) > 0 {
+		command.Params = []string{name, localizedScriptMainSection}
+	}
 	return api.executeWebsocketCommand(command)
 }
 
@@ -180,75 +283,91 @@ func (api *API) GetProgress(handle int, id int) (Response, error) {
 }
 
 func (api *API) OpenWebSocket() error {
-	ws := fmt.Sprintf("wss://%s:%v/app", api.Server, api.WebsocketPort)
-	u, err := url.Parse(ws)
-	if err != nil {
-		return err
-	}
-	dialer := net.Dialer{}
-	rawConn, err := tls.DialWithDialer(&dialer, "tcp", u.Host, api.getTlsConfig(api.ClientCert, api.ClientKey, api.CertAuth))
+	return api.OpenAppWebSocket("")
+}
 
+// OpenAppWebSocket opens the Engine websocket against /app/<appId>, which is required
+// when connecting through the proxy so it can route the session to an engine holding the app.
+func (api *API) OpenAppWebSocket(appId string) error {
+	u, err := url.Parse(api.engineUrl(appId))
 	if err != nil {
 		return err
 	}
-
 	xrfKey := makeXrfKey()
-	// your milage may differ
 	wsHeaders := http.Header{
-		"Origin":                   {"http://192.168.5.131"},
+		"Origin":                   {api.origin()},
 		"Sec-WebSocket-Extensions": {"permessage-deflate; client_max_window_bits, x-webkit-deflate-frame"},
 		xrf_header:                 {xrfKey},
 		qlik_user_header:           {api.makeQlikUserHeader()},
 		content_type_header:        {application_json_content_type},
 	}
-	websocketConnection, resp, err := websocket.NewClient(rawConn, u, wsHeaders, 1024, 1024)
-	api.WebsocketConnection = websocketConnection
-	if err != nil {
-		return fmt.Errorf("websocket.NewClient Error: %s\nResp:%+v", err, resp)
+	// the dialer connects and does the TLS handshake for wss urls with the client
+	// certificates, honouring the handshake timeout
+	dialer := websocket.Dialer{TLSClientConfig: api.getTlsConfig(api.ClientCert, api.ClientKey, api.CertAuth),
+		HandshakeTimeout: connectTimeOut, ReadBufferSize: 1024, WriteBufferSize: 1024}
+	dial := func() (EngineConn, error) {
+		websocketConnection, resp, err := dialer.Dial(u.String(), wsHeaders)
+		api.WebsocketConnection = websocketConnection
+		if err != nil {
+			return nil, fmt.Errorf("websocket.Dial Error: %s\nResp:%+v", err, resp)
+		}
+		return websocketConnection, nil
 	}
-	return nil
+	api.rpc = nil
+	if api.cassette != nil {
+		api.engine, err = api.cassette.dial(u.String(), dial)
+	} else {
+		api.engine, err = dial()
+	}
+	return err
 }
 
 func (api *API) CloseWebSocket() error {
-	return api.WebsocketConnection.Close()
+	conn := api.engineConnection()
+	if conn == nil {
+		return ErrWebsocketClosed
+	}
+	if api.WebsocketConnection != nil && EngineConn(api.WebsocketConnection) == conn {
+		api.WebsocketConnection = nil
+	}
+	api.rpc = nil
+	api.engine = nil
+	return conn.Close()
+}
+
+// engineConnection is the connection Engine requests go over, falling back to a
+// WebsocketConnection set by the caller.
+func (api *API) engineConnection() EngineConn {
+	if api.engine == nil && api.WebsocketConnection != nil {
+		api.engine = api.WebsocketConnection
+	}
+	return api.engine
 }
 
 const debug = false
 
-func (api *API) executeWebsocketCommand(command interface{}) (Response, error) {
+func (api *API) executeWebsocketCommand(command Request) (Response, error) {
 	response := Response{}
-	if debug {
-		commandJson, _ := json.Marshal(command)
-		fmt.Printf("Websocket request:%v\n", string(commandJson))
+	rpc, err := api.engineRpc()
+	if err != nil {
+		return response, err
 	}
-	err := api.WebsocketConnection.WriteJSON(command)
+	_, ch, err := rpc.send(command)
 	if err != nil {
 		return response, err
 	}
-	if debug {
-		_, res, err := api.WebsocketConnection.ReadMessage()
-		if err != nil {
-			return response, err
-		}
-		fmt.Printf("Websocket response:%v\n", string(res))
-		err = json.Unmarshal(res, &response)
-		if err != nil {
-			return response, err
-		}
-		if response.Error != nil {
-			return response, response.Error.GetError()
-		}
-	} else {
-		err = api.WebsocketConnection.ReadJSON(&response)
-		if err == nil {
-			return response, err
-		}
-		if response.Error != nil {
-			return response, response.Error.GetError()
-		}
+	res, err := rpc.wait(ch)
+	if err != nil {
+		return response, err
+	}
+	err = json.Unmarshal(res, &response)
+	if err != nil {
+		return response, err
+	}
+	if response.Error != nil {
+		return response, response.Error.GetError()
 	}
 	return response, nil
-
 }
 
 func (api *API) makeQlikUserHeader() string {
@@ -269,7 +388,7 @@ func (api *API) makeRequest(requestUrl string, method string, payload []byte, re
 			fmt.Printf("%v\n", string(payload))
 		}
 	}
-	client := httputil.NewTimeoutClient(cTimeout, rwTimeout, true)
+	client := api.httpClient(cTimeout, rwTimeout)
 	var req *http.Request
 	if len(payload) > 0 {
 		var httpErr error
@@ -325,6 +444,68 @@ func (api *API) makeRequest(requestUrl string, method string, payload []byte, re
 	return nil
 }
 
+// download streams the body of a GET to w.
+func (api *API) download(requestUrl string, w io.Writer, headers map[string]string, cTimeout time.Duration, rwTimeout time.Duration) error {
+	if debug {
+		fmt.Printf("%s:%v\n", GET, requestUrl)
+	}
+	req, err := http.NewRequest(GET, strings.TrimSpace(requestUrl), nil)
+	if err != nil {
+		return err
+	}
+	for header, headerValue := range headers {
+		req.Header.Add(header, headerValue)
+	}
+	resp, err := api.httpClient(cTimeout, rwTimeout).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 404 {
+		return ErrDoesNotExist
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Error during request [%v]:%v", resp.StatusCode, resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// upload posts body as it is read, for files too large to hold in memory, and
+// unmarshals the response into result.
+func (api *API) upload(requestUrl string, body io.Reader, result interface{}, headers map[string]string, cTimeout time.Duration, rwTimeout time.Duration) error {
+	if debug {
+		fmt.Printf("%s:%v\n", POST, requestUrl)
+	}
+	req, err := http.NewRequest(POST, strings.TrimSpace(requestUrl), body)
+	if err != nil {
+		return err
+	}
+	for header, headerValue := range headers {
+		req.Header.Add(header, headerValue)
+	}
+	resp, err := api.httpClient(cTimeout, rwTimeout).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 404 {
+		return ErrDoesNotExist
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Error during request [%v]:%v", resp.StatusCode, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (api *API) httpClient(cTimeout time.Duration, rwTimeout time.Duration) *http.Client {
+	client := httputil.NewTimeoutClient(cTimeout, rwTimeout, true)
+	if api.cassette != nil {
+		client.Transport = api.cassette.transport(client.Transport)
+	}
+	return client
+}
+
 func (api *API) getTlsConfig(certLocation, keyLocation, caFile string) *tls.Config {
 	tlsConfig := &tls.Config{InsecureSkipVerify: true}
 	if len(certLocation) > 0 && len(keyLocation) > 0 {
@@ -0,0 +1,635 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mattbaird/glik"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var guidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func about(ctx *context, args []string) error {
+	about, err := ctx.api.About()
+	if err != nil {
+		return err
+	}
+	return ctx.print(about, []string{"BUILD", "DATE", "DATABASE", "NODE TYPE"}, [][]interface{}{
+		{about.BuildVersion, about.BuildDate, about.DatabaseProvider, about.NodeType}})
+}
+
+func checkApps(args []string) error {
+	if len(args) == 0 {
+		return usageError{commands["apps"].usage}
+	}
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return usageError{"apps list"}
+		}
+	case "copy":
+		if len(args) != 3 {
+			return usageError{"apps copy <app> <name>"}
+		}
+	case "publish":
+		if len(args) < 3 || len(args) > 4 {
+			return usageError{"apps publish <app> <stream> [name]"}
+		}
+	case "export":
+		if len(args) != 3 {
+			return usageError{"apps export <app> <file.qvf>"}
+		}
+	case "import":
+		if len(args) < 2 || len(args) > 3 {
+			return usageError{"apps import <file.qvf> [name]"}
+		}
+	case "delete":
+		if len(args) != 2 {
+			return usageError{"apps delete <app>"}
+		}
+	default:
+		return usageError{commands["apps"].usage}
+	}
+	return nil
+}
+
+func apps(ctx *context, args []string) error {
+	switch args[0] {
+	case "list":
+		list, err := ctx.api.List()
+		if err != nil {
+			return err
+		}
+		return ctx.printApps(list...)
+	case "copy":
+		appId, err := ctx.resolveApp(args[1])
+		if err != nil {
+			return err
+		}
+		app, err := ctx.api.Copy(appId, args[2])
+		if err != nil {
+			return err
+		}
+		return ctx.printApps(app)
+	case "publish":
+		appId, err := ctx.resolveApp(args[1])
+		if err != nil {
+			return err
+		}
+		streamId, err := ctx.resolveStream(args[2])
+		if err != nil {
+			return err
+		}
+		name := ""
+		if len(args) == 4 {
+			name = args[3]
+		}
+		app, err := ctx.api.Publish(appId, streamId, name)
+		if err != nil {
+			return err
+		}
+		return ctx.printApps(app)
+	case "export":
+		appId, err := ctx.resolveApp(args[1])
+		if err != nil {
+			return err
+		}
+		file, err := os.Create(args[2])
+		if err != nil {
+			return err
+		}
+		err = ctx.api.Export(appId, file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(args[2])
+		}
+		return err
+	case "import":
+		name := strings.TrimSuffix(filepath.Base(args[1]), filepath.Ext(args[1]))
+		if len(args) == 3 {
+			name = args[2]
+		}
+		file, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		app, err := ctx.api.Upload(name, file)
+		if err != nil {
+			return err
+		}
+		return ctx.printApps(app)
+	case "delete":
+		appId, err := ctx.resolveApp(args[1])
+		if err != nil {
+			return err
+		}
+		return ctx.api.Delete(appId)
+	}
+	return usageError{commands["apps"].usage}
+}
+
+func streams(ctx *context, args []string) error {
+	list, err := ctx.api.Streams()
+	if err != nil {
+		return err
+	}
+	rows := [][]interface{}{}
+	for _, stream := range list {
+		rows = append(rows, []interface{}{stream.Id, stream.Name})
+	}
+	return ctx.print(list, []string{"ID", "NAME"}, rows)
+}
+
+type reloadResult struct {
+	AppId   string `json:"appId"`
+	Success bool   `json:"success"`
+}
+
+// parseReload parses the reload arguments, the flags may come before or after the app.
+func parseReload(args []string) (string, bool, error) {
+	flags := flag.NewFlagSet("reload", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	follow := flags.Bool("follow", false, "reload through the engine, streaming the script log until it finishes")
+	positional, err := parseInterleaved(flags, args)
+	if err != nil || len(positional) != 1 {
+		return "", false, usageError{commands["reload"].usage}
+	}
+	return positional[0], *follow, nil
+}
+
+// parseInterleaved parses flags mixed with positional arguments, flag.Parse alone stops
+// at the first positional one. The positional arguments are returned in order.
+func parseInterleaved(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func checkReload(args []string) error {
+	_, _, err := parseReload(args)
+	return err
+}
+
+func reload(ctx *context, args []string) error {
+	app, follow, err := parseReload(args)
+	if err != nil {
+		return err
+	}
+	appId, err := ctx.resolveApp(app)
+	if err != nil {
+		return err
+	}
+	if !follow {
+		// queued on the scheduler, returns once the reload was triggered
+		return ctx.api.Reload(appId)
+	}
+	doc, err := ctx.openDoc(appId)
+	if err != nil {
+		return err
+	}
+	defer ctx.api.CloseWebSocket()
+	success, err := doc.DoReloadWithProgress(glik.RELOAD_MODE_DEFAULT, false, time.Second, func(progress glik.ProgressData) {
+		if len(progress.PersistentProgress) > 0 {
+			fmt.Fprintln(ctx.stderr, strings.TrimRight(progress.PersistentProgress, "\r\n"))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if success {
+		err = doc.DoSave()
+		if err != nil {
+			return err
+		}
+	}
+	err = ctx.print(reloadResult{AppId: appId, Success: success}, []string{"APP", "SUCCESS"}, [][]interface{}{{appId, success}})
+	if err == nil && !success {
+		return errReloadFailed
+	}
+	return err
+}
+
+type scriptResult struct {
+	AppId  string `json:"appId"`
+	Script string `json:"script"`
+}
+
+func checkScript(args []string) error {
+	switch {
+	case len(args) == 2 && args[0] == "get":
+	case len(args) == 3 && (args[0] == "set" || args[0] == "check"):
+	default:
+		return usageError{commands["script"].usage}
+	}
+	return nil
+}
+
+func script(ctx *context, args []string) error {
+	switch {
+	case args[0] == "get":
+		appId, err := ctx.resolveApp(args[1])
+		if err != nil {
+			return err
+		}
+		doc, err := ctx.openDoc(appId)
+		if err != nil {
+			return err
+		}
+		defer ctx.api.CloseWebSocket()
+		script, err := doc.GetScript()
+		if err != nil {
+			return err
+		}
+		if ctx.output == OUTPUT_JSON {
+			return ctx.print(scriptResult{AppId: appId, Script: script}, nil, nil)
+		}
+		_, err = fmt.Fprint(ctx.stdout, script)
+		return err
+	case args[0] == "set" || args[0] == "check":
+		var script []byte
+		var err error
+		if args[2] == "-" {
+			script, err = ioutil.ReadAll(ctx.stdin)
+		} else {
+			script, err = ioutil.ReadFile(args[2])
+		}
+		if err != nil {
+			return err
+		}
+		appId, err := ctx.resolveApp(args[1])
+		if err != nil {
+			return err
+		}
+		doc, err := ctx.openDoc(appId)
+		if err != nil {
+			return err
+		}
+		defer ctx.api.CloseWebSocket()
+		if args[0] == "check" {
+			return ctx.checkScript(doc, string(script))
+		}
+		err = doc.SetScript(string(script))
+		if err != nil {
+			return err
+		}
+		return doc.DoSave()
+	}
+	return usageError{commands["script"].usage}
+}
+
+// checkScript prints the syntax errors of the script, the app's script is left as is.
+func (ctx *context) checkScript(doc *glik.Doc, script string) error {
+	err := doc.ValidateScript(script)
+	syntaxErr, ok := err.(*glik.ScriptSyntaxError)
+	if !ok {
+		return err
+	}
+	rows := [][]interface{}{}
+	for _, e := range syntaxErr.Errors {
+		rows = append(rows, []interface{}{e.Section, e.Line, e.Column, strings.TrimSpace(e.Text)})
+	}
+	err = ctx.print(syntaxErr.Errors, []string{"SECTION", "LINE", "COLUMN", "TEXT"}, rows)
+	if err != nil {
+		return err
+	}
+	return errScriptErrors
+}
+
+func checkTasks(args []string) error {
+	switch {
+	case len(args) == 1 && args[0] == "list":
+	case len(args) == 2 && args[0] == "start":
+	default:
+		return usageError{commands["tasks"].usage}
+	}
+	return nil
+}
+
+func tasks(ctx *context, args []string) error {
+	switch args[0] {
+	case "list":
+		list, err := ctx.api.ReloadTasks()
+		if err != nil {
+			return err
+		}
+		rows := [][]interface{}{}
+		for _, task := range list {
+			app := ""
+			if task.App != nil {
+				app = task.App.Name
+			}
+			rows = append(rows, []interface{}{task.Id, task.Name, app, task.Enabled})
+		}
+		return ctx.print(list, []string{"ID", "NAME", "APP", "ENABLED"}, rows)
+	case "start":
+		if guidPattern.MatchString(args[1]) {
+			return ctx.api.StartTask(args[1])
+		}
+		return ctx.api.StartTaskByName(args[1])
+	}
+	return usageError{commands["tasks"].usage}
+}
+
+func checkConnections(args []string) error {
+	switch {
+	case len(args) == 1 && args[0] == "list":
+	case len(args) > 1 && args[0] == "rewrite":
+		for _, arg := range args[1:] {
+			if strings.Index(arg, "=") <= 0 {
+				return usageError{commands["connections"].usage}
+			}
+		}
+	default:
+		return usageError{commands["connections"].usage}
+	}
+	return nil
+}
+
+// connections lists the repository's data connections, or rewrites their connection
+// strings when promoting apps, e.g. connections rewrite '\\dev-share=\\prod-share'.
+func connections(ctx *context, args []string) error {
+	switch args[0] {
+	case "list":
+		list, err := ctx.api.DataConnections()
+		if err != nil {
+			return err
+		}
+		rows := [][]interface{}{}
+		for _, connection := range list {
+			rows = append(rows, []interface{}{connection.Id, connection.Name, connection.Type, connection.ConnectionString})
+		}
+		return ctx.print(list, []string{"ID", "NAME", "TYPE", "CONNECTION STRING"}, rows)
+	case "rewrite":
+		replacements := map[string]string{}
+		for _, arg := range args[1:] {
+			i := strings.Index(arg, "=")
+			replacements[arg[:i]] = arg[i+1:]
+		}
+		list, err := ctx.api.RewriteDataConnections(replacements)
+		if err != nil {
+			return err
+		}
+		rows := [][]interface{}{}
+		for _, connection := range list {
+			rows = append(rows, []interface{}{connection.Id, connection.Name, connection.ConnectionString})
+		}
+		return ctx.print(list, []string{"ID", "NAME", "CONNECTION STRING"}, rows)
+	}
+	return usageError{commands["connections"].usage}
+}
+
+type evalResult struct {
+	AppId      string `json:"appId"`
+	Expression string `json:"expression"`
+	Value      string `json:"value"`
+}
+
+func eval(ctx *context, args []string) error {
+	appId, err := ctx.resolveApp(args[0])
+	if err != nil {
+		return err
+	}
+	expression := strings.Join(args[1:], " ")
+	doc, err := ctx.openDoc(appId)
+	if err != nil {
+		return err
+	}
+	defer ctx.api.CloseWebSocket()
+	value, err := doc.Evaluate(expression)
+	if err != nil {
+		return err
+	}
+	if ctx.output == OUTPUT_JSON {
+		return ctx.print(evalResult{AppId: appId, Expression: expression, Value: value}, nil, nil)
+	}
+	_, err = fmt.Fprintln(ctx.stdout, value)
+	return err
+}
+
+// unbuild writes the app to a directory, see glik.Unbuild.
+func unbuild(ctx *context, args []string) error {
+	appId, err := ctx.resolveApp(args[0])
+	if err != nil {
+		return err
+	}
+	doc, err := ctx.openDoc(appId)
+	if err != nil {
+		return err
+	}
+	defer ctx.api.CloseWebSocket()
+	return glik.Unbuild(doc, args[1])
+}
+
+// build recreates an unbuilt app into an existing app and saves it.
+func build(ctx *context, args []string) error {
+	appId, err := ctx.resolveApp(args[0])
+	if err != nil {
+		return err
+	}
+	doc, err := ctx.openDoc(appId)
+	if err != nil {
+		return err
+	}
+	defer ctx.api.CloseWebSocket()
+	err = glik.Build(doc, args[1])
+	if err != nil {
+		return err
+	}
+	return doc.DoSave()
+}
+
+// diff shows what changes from the first app to the second, e.g. from the published
+// app to its development copy.
+func diff(ctx *context, args []string) error {
+	appIds := []string{}
+	for _, app := range args {
+		appId, err := ctx.resolveApp(app)
+		if err != nil {
+			return err
+		}
+		appIds = append(appIds, appId)
+	}
+	// each app needs its own websocket
+	other := *ctx
+	doc, err := ctx.openDoc(appIds[0])
+	if err != nil {
+		return err
+	}
+	defer ctx.api.CloseWebSocket()
+	otherDoc, err := other.openDoc(appIds[1])
+	if err != nil {
+		return err
+	}
+	defer other.api.CloseWebSocket()
+	result, err := glik.DiffApps(doc, otherDoc)
+	if err != nil {
+		return err
+	}
+	if ctx.output == OUTPUT_JSON {
+		return ctx.print(result, nil, nil)
+	}
+	_, err = fmt.Fprintln(ctx.stdout, result.String())
+	return err
+}
+
+type modelIssue struct {
+	Kind   string   `json:"kind"`
+	Name   string   `json:"name"`
+	Tables []string `json:"tables"`
+}
+
+func checkModel(args []string) error {
+	switch {
+	case len(args) == 2 && (args[0] == "tables" || args[0] == "dot" || args[0] == "mermaid" || args[0] == "check"):
+	case len(args) == 3 && args[0] == "check":
+	default:
+		return usageError{commands["model"].usage}
+	}
+	return nil
+}
+
+// model shows the data model of an app as a table or a graph. model check fails on
+// circular references and on synthetic keys the baseline app, e.g. the published
+// app, does not have, so CI can reject reloads that add them.
+func model(ctx *context, args []string) error {
+	models := []*glik.DataModel{}
+	for _, app := range args[1:] {
+		appId, err := ctx.resolveApp(app)
+		if err != nil {
+			return err
+		}
+		doc, err := ctx.openDoc(appId)
+		if err != nil {
+			return err
+		}
+		dataModel, err := doc.DataModel()
+		ctx.api.CloseWebSocket()
+		if err != nil {
+			return err
+		}
+		models = append(models, dataModel)
+	}
+	dataModel := models[0]
+	switch args[0] {
+	case "tables":
+		rows := [][]interface{}{}
+		for _, table := range dataModel.Tables {
+			rows = append(rows, []interface{}{table.Name, table.Rows, len(table.Fields), strings.Join(table.KeyFields, ", ")})
+		}
+		return ctx.print(dataModel, []string{"TABLE", "ROWS", "FIELDS", "KEYS"}, rows)
+	case "dot":
+		_, err := fmt.Fprint(ctx.stdout, dataModel.DOT())
+		return err
+	case "mermaid":
+		_, err := fmt.Fprint(ctx.stdout, dataModel.Mermaid())
+		return err
+	case "check":
+		keys := dataModel.SyntheticKeys
+		if len(models) > 1 {
+			keys = dataModel.NewSyntheticKeys(models[1])
+		}
+		issues := []modelIssue{}
+		for _, key := range keys {
+			issues = append(issues, modelIssue{Kind: "synthetic key", Name: strings.Join(key.Fields, ", "), Tables: key.Tables})
+		}
+		for _, loop := range dataModel.CircularReferences {
+			issues = append(issues, modelIssue{Kind: "circular reference", Name: strings.Join(loop.Keys, ", "), Tables: loop.Tables})
+		}
+		if len(issues) == 0 {
+			return nil
+		}
+		rows := [][]interface{}{}
+		for _, issue := range issues {
+			rows = append(rows, []interface{}{issue.Kind, issue.Name, strings.Join(issue.Tables, ", ")})
+		}
+		err := ctx.print(issues, []string{"ISSUE", "FIELDS", "TABLES"}, rows)
+		if err != nil {
+			return err
+		}
+		return errModelIssues
+	}
+	return nil
+}
+
+// resolveApp accepts an app id or an app name, names must be unique.
+func (ctx *context) resolveApp(idOrName string) (string, error) {
+	if guidPattern.MatchString(idOrName) {
+		return idOrName, nil
+	}
+	list, err := ctx.api.List()
+	if err != nil {
+		return "", err
+	}
+	found := ""
+	for _, app := range list {
+		if app.Name == idOrName {
+			if len(found) > 0 {
+				return "", fmt.Errorf("more than one app is called %q, use its id", idOrName)
+			}
+			found = app.Id
+		}
+	}
+	if len(found) == 0 {
+		return "", glik.ErrDoesNotExist
+	}
+	return found, nil
+}
+
+// resolveStream accepts a stream id or a stream name.
+func (ctx *context) resolveStream(idOrName string) (string, error) {
+	if guidPattern.MatchString(idOrName) {
+		return idOrName, nil
+	}
+	list, err := ctx.api.Streams()
+	if err != nil {
+		return "", err
+	}
+	for _, stream := range list {
+		if stream.Name == idOrName {
+			return stream.Id, nil
+		}
+	}
+	return "", glik.ErrDoesNotExist
+}
+
+// openDoc opens the websocket against the app and the app on it, the caller closes the websocket.
+func (ctx *context) openDoc(appId string) (*glik.Doc, error) {
+	err := ctx.api.OpenAppWebSocket(appId)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := ctx.api.OpenDoc(appId)
+	if err != nil {
+		ctx.api.CloseWebSocket()
+		return nil, err
+	}
+	return doc, nil
+}
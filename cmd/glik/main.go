@@ -0,0 +1,185 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command glik administers Qlik Sense from the command line.
+//
+//	glik [-profile name] [-config path] [-o table|json] <command> [arguments]
+//
+// Connection settings come from a profile, see glik.LoadProfile. Results are printed
+// as a table, or as JSON with -o json. The exit code is 0 on success, 1 on error,
+// 2 on bad usage, 3 when the app, stream or task does not exist, 4 when a reload fails,
+// 5 when script check finds syntax errors and 6 when model check finds synthetic keys
+// or circular references.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/mattbaird/glik"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	EXIT_OK            = 0
+	EXIT_ERROR         = 1
+	EXIT_USAGE         = 2
+	EXIT_NOT_FOUND     = 3
+	EXIT_RELOAD_FAILED = 4
+	EXIT_SCRIPT_ERRORS = 5
+	EXIT_MODEL_ISSUES  = 6
+)
+
+const OUTPUT_TABLE = "table"
+const OUTPUT_JSON = "json"
+
+var errReloadFailed = errors.New("reload failed")
+var errScriptErrors = errors.New("script has syntax errors")
+var errModelIssues = errors.New("data model has new synthetic keys or circular references")
+
+type usageError struct {
+	usage string
+}
+
+func (e usageError) Error() string {
+	return "usage: glik " + e.usage
+}
+
+// context is what a command runs with.
+type context struct {
+	api    glik.API
+	output string
+	stdout io.Writer
+	stderr io.Writer
+	stdin  io.Reader
+}
+
+// command is a glik sub command. check validates the arguments before the profile is
+// loaded, so bad usage is reported without connecting.
+type command struct {
+	usage string
+	check func(args []string) error
+	run   func(ctx *context, args []string) error
+}
+
+var commands map[string]command
+
+// set up in init, the commands refer back to the map for their usage
+func init() {
+	commands = map[string]command{
+		"about":       {"about", arity("about", 0, 0), about},
+		"apps":        {"apps list|copy|publish|export|import|delete ...", checkApps, apps},
+		"streams":     {"streams", arity("streams", 0, 0), streams},
+		"reload":      {"reload [-follow] <app>", checkReload, reload},
+		"script":      {"script get <app> | script set|check <app> <file|->", checkScript, script},
+		"tasks":       {"tasks list | tasks start <task id or name>", checkTasks, tasks},
+		"eval":        {"eval <app> <expression>", arity("eval", 2, -1), eval},
+		"unbuild":     {"unbuild <app> <dir>", arity("unbuild", 2, 2), unbuild},
+		"build":       {"build <app> <dir>", arity("build", 2, 2), build},
+		"diff":        {"diff <app> <other app>", arity("diff", 2, 2), diff},
+		"connections": {"connections list | connections rewrite <old>=<new>...", checkConnections, connections},
+		"model":       {"model tables|dot|mermaid <app> | model check <app> [<baseline app>]", checkModel, model},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("glik", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	profileName := flags.String("profile", "", "profile to connect with, defaults to $"+glik.PROFILE_ENV+" or the config's default")
+	configPath := flags.String("config", glik.DefaultConfigPath(), "profile config file")
+	output := flags.String("o", OUTPUT_TABLE, "output format, table or json")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: glik [flags] <command> [arguments]\n\ncommands:")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(stderr, "  %s\n", commands[name].usage)
+		}
+		fmt.Fprintln(stderr, "\nflags:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+	if flags.NArg() == 0 || (*output != OUTPUT_TABLE && *output != OUTPUT_JSON) {
+		flags.Usage()
+		return EXIT_USAGE
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "glik: unknown command %q\n", flags.Arg(0))
+		flags.Usage()
+		return EXIT_USAGE
+	}
+	if err := cmd.check(flags.Args()[1:]); err != nil {
+		return exitCode(err, stderr)
+	}
+	profile, err := glik.LoadProfile(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintf(stderr, "glik: %v\n", err)
+		return EXIT_ERROR
+	}
+	api, err := profile.API()
+	if err != nil {
+		fmt.Fprintf(stderr, "glik: %v\n", err)
+		return EXIT_ERROR
+	}
+	ctx := &context{api: api, output: *output, stdout: stdout, stderr: stderr, stdin: stdin}
+	err = cmd.run(ctx, flags.Args()[1:])
+	return exitCode(err, stderr)
+}
+
+// arity checks a command gets between min and max arguments, any number above min
+// when max is negative.
+func arity(name string, min, max int) func(args []string) error {
+	return func(args []string) error {
+		if len(args) < min || (max >= 0 && len(args) > max) {
+			return usageError{commands[name].usage}
+		}
+		return nil
+	}
+}
+
+func exitCode(err error, stderr io.Writer) int {
+	if err == nil {
+		return EXIT_OK
+	}
+	fmt.Fprintf(stderr, "glik: %v\n", err)
+	switch {
+	case err == glik.ErrDoesNotExist:
+		return EXIT_NOT_FOUND
+	case err == errReloadFailed:
+		return EXIT_RELOAD_FAILED
+	case err == errScriptErrors:
+		return EXIT_SCRIPT_ERRORS
+	case err == errModelIssues:
+		return EXIT_MODEL_ISSUES
+	}
+	if _, ok := err.(usageError); ok {
+		return EXIT_USAGE
+	}
+	if engineErr, ok := err.(*glik.WebsocketError); ok {
+		switch engineErr.Code {
+		case glik.LOCERR_APP_NOT_FOUND, glik.LOCERR_GENERIC_NOT_FOUND:
+			return EXIT_NOT_FOUND
+		}
+	}
+	return EXIT_ERROR
+}
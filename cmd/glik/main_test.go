@@ -0,0 +1,232 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"github.com/mattbaird/glik/qrstest"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fixture is a fake QRS and Engine with a profile config pointing at them.
+type fixture struct {
+	store  *qrstest.Store
+	qrs    *qrstest.Server
+	engine *enginetest.Server
+	config string
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{store: qrstest.NewStore(), engine: enginetest.NewServer()}
+	f.qrs = qrstest.NewServer(f.store)
+	t.Cleanup(func() {
+		f.qrs.Close()
+		f.engine.Close()
+	})
+	profile := glik.Profile{Server: "127.0.0.1", QrsPort: port(f.qrs.Listener), AuthPort: port(f.qrs.Listener), WebsocketPort: port(f.engine.Listener)}
+	data, err := json.Marshal(glik.ProfileConfig{Default: "test", Profiles: map[string]glik.Profile{"test": profile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.config = filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(f.config, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func port(listener net.Listener) int {
+	_, p, _ := net.SplitHostPort(listener.Addr().String())
+	n, _ := strconv.Atoi(p)
+	return n
+}
+
+// addApp adds an app to the repository and the engine, engine docs are opened by id.
+func (f *fixture) addApp(name, script string) string {
+	app := f.store.AddApp(name)
+	f.engine.AddDoc(app.Id, script)
+	return app.Id
+}
+
+func (f *fixture) run(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(append([]string{"-config", f.config}, args...), strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestUsageExitsBeforeLoadingProfile(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	for _, args := range [][]string{
+		{},
+		{"bogus"},
+		{"-o", "xml", "about"},
+		{"about", "extra"},
+		{"apps"},
+		{"apps", "copy", "Sales"},
+		{"reload"},
+		{"reload", "Sales", "Marketing"},
+		{"reload", "Sales", "-bogus"},
+		{"script", "set", "Sales"},
+		{"tasks", "stop", "x"},
+		{"eval", "Sales"},
+		{"connections", "rewrite", "=x"},
+		{"model", "check"},
+	} {
+		var stdout, stderr bytes.Buffer
+		code := run(append([]string{"-config", missing}, args...), strings.NewReader(""), &stdout, &stderr)
+		if code != EXIT_USAGE {
+			t.Errorf("%v: got exit %v, want %v: %s", args, code, EXIT_USAGE, stderr.String())
+		}
+	}
+}
+
+func TestReloadFlagsAfterApp(t *testing.T) {
+	f := newFixture(t)
+	appId := f.addApp("Sales", "Load 1 as A AutoGenerate 1;")
+	for _, args := range [][]string{
+		{"reload", "-follow", "Sales"},
+		{"reload", "Sales", "--follow"},
+		{"-o", "json", "reload", "Sales", "-follow=true"},
+	} {
+		code, stdout, stderr := f.run("", args...)
+		if code != EXIT_OK || !strings.Contains(stdout, appId) || !strings.Contains(stdout, "true") {
+			t.Errorf("%v: got exit %v\n%s%s", args, code, stdout, stderr)
+		}
+	}
+	if len(f.store.Reloads) != 0 {
+		t.Errorf("followed reloads went through the scheduler: %v", f.store.Reloads)
+	}
+	code, _, stderr := f.run("", "reload", "Sales")
+	if code != EXIT_OK || len(f.store.Reloads) != 1 || f.store.Reloads[0] != appId {
+		t.Errorf("got exit %v, reloads %v: %s", code, f.store.Reloads, stderr)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	f := newFixture(t)
+	f.addApp("Sales", "Load 1 as A AutoGenerate 1;")
+	f.engine.Handle("DoReload", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qReturn": false}, nil
+	})
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"about"}, EXIT_OK},
+		{[]string{"apps", "list"}, EXIT_OK},
+		{[]string{"reload", "Nope"}, EXIT_NOT_FOUND},
+		{[]string{"apps", "delete", "Nope"}, EXIT_NOT_FOUND},
+		{[]string{"reload", "Sales", "-follow"}, EXIT_RELOAD_FAILED},
+		{[]string{"-profile", "other", "about"}, EXIT_ERROR},
+	}
+	for _, test := range tests {
+		if code, stdout, stderr := f.run("", test.args...); code != test.want {
+			t.Errorf("%v: got exit %v, want %v\n%s%s", test.args, code, test.want, stdout, stderr)
+		}
+	}
+}
+
+func TestScriptRoundTrip(t *testing.T) {
+	f := newFixture(t)
+	f.addApp("Sales", "Load 1 as A AutoGenerate 1;")
+	if code, _, stderr := f.run("Load 2 as B AutoGenerate 1;", "script", "set", "Sales", "-"); code != EXIT_OK {
+		t.Fatalf("got exit %v: %s", code, stderr)
+	}
+	code, stdout, stderr := f.run("", "script", "get", "Sales")
+	if code != EXIT_OK || stdout != "Load 2 as B AutoGenerate 1;" {
+		t.Errorf("got exit %v, %q: %s", code, stdout, stderr)
+	}
+	code, stdout, _ = f.run("", "-o", "json", "apps", "list")
+	var apps []glik.ApplicationResult
+	if err := json.Unmarshal([]byte(stdout), &apps); code != EXIT_OK || err != nil || len(apps) != 1 || apps[0].Name != "Sales" {
+		t.Errorf("got exit %v, %v: %s", code, err, stdout)
+	}
+}
+
+func TestImportApp(t *testing.T) {
+	f := newFixture(t)
+	qvf := filepath.Join(t.TempDir(), "Sales 2016.QVF")
+	if err := ioutil.WriteFile(qvf, []byte("qvf content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, stderr := f.run("", "apps", "import", qvf); code != EXIT_OK {
+		t.Fatalf("got exit %v: %s", code, stderr)
+	}
+	if code, _, stderr := f.run("", "apps", "import", qvf, "Budget"); code != EXIT_OK {
+		t.Fatalf("got exit %v: %s", code, stderr)
+	}
+	if len(f.store.Apps) != 2 || f.store.Apps[0].Name != "Sales 2016" || f.store.Apps[1].Name != "Budget" {
+		t.Fatalf("got %+v", f.store.Apps)
+	}
+	if content := string(f.store.Files[f.store.Apps[0].Id]); content != "qvf content" {
+		t.Errorf("got %q", content)
+	}
+}
+
+func TestParseInterleaved(t *testing.T) {
+	for _, test := range []struct {
+		args   []string
+		app    string
+		follow bool
+	}{
+		{[]string{"Sales"}, "Sales", false},
+		{[]string{"-follow", "Sales"}, "Sales", true},
+		{[]string{"Sales", "-follow"}, "Sales", true},
+		{[]string{"Sales", "-follow=false"}, "Sales", false},
+	} {
+		app, follow, err := parseReload(test.args)
+		if err != nil || app != test.app || follow != test.follow {
+			t.Errorf("%v: got %q, %v, %v", test.args, app, follow, err)
+		}
+	}
+}
+
+func TestModelCheck(t *testing.T) {
+	f := newFixture(t)
+	sales := f.addApp("Sales", "")
+	f.addApp("Published", "")
+	field := func(name string) glik.FieldInTableData {
+		return glik.FieldInTableData{Name: name, IsSynthetic: strings.HasPrefix(name, glik.SYNTHETIC_KEY_PREFIX)}
+	}
+	f.engine.Handle("GetTablesAndKeys", func(call *enginetest.Call) (interface{}, error) {
+		tables := []glik.TableRecord{
+			{Name: "Budget", Fields: []glik.FieldInTableData{field("$Syn 1"), field("Budget")}},
+			{Name: "Actuals", Fields: []glik.FieldInTableData{field("$Syn 1"), field("Actual")}},
+			{Name: "$Syn 1 Table", IsSynthetic: true, Fields: []glik.FieldInTableData{field("Year"), field("Month"), field("$Syn 1")}},
+		}
+		if call.Doc().ID == sales {
+			tables = append(tables, glik.TableRecord{Name: "Forecast", Fields: []glik.FieldInTableData{field("$Syn 2"), field("Forecast")}},
+				glik.TableRecord{Name: "$Syn 2 Table", IsSynthetic: true, Fields: []glik.FieldInTableData{field("Actual"), field("Month"), field("$Syn 2")}})
+			tables[1].Fields = append(tables[1].Fields, field("$Syn 2"))
+		}
+		return map[string]interface{}{"qtr": tables, "qk": []glik.SourceKeyRecord{}}, nil
+	})
+	code, stdout, stderr := f.run("", "model", "check", "Sales", "Published")
+	if code != EXIT_MODEL_ISSUES || !strings.Contains(stdout, "Actual, Month") || strings.Contains(stdout, "Month, Year") {
+		t.Errorf("got exit %v, %q: %s", code, stdout, stderr)
+	}
+	if code, stdout, stderr := f.run("", "model", "check", "Published", "Published"); code != EXIT_OK {
+		t.Errorf("got exit %v, %q: %s", code, stdout, stderr)
+	}
+	code, stdout, _ = f.run("", "model", "tables", "Published")
+	if code != EXIT_OK || !strings.Contains(stdout, "Budget") || strings.Contains(stdout, "$Syn") {
+		t.Errorf("got exit %v, %q", code, stdout)
+	}
+}
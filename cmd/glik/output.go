@@ -0,0 +1,54 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mattbaird/glik"
+	"strings"
+	"text/tabwriter"
+)
+
+// print writes value as indented JSON, or header and rows as an aligned table.
+func (ctx *context) print(value interface{}, header []string, rows [][]interface{}) error {
+	if ctx.output == OUTPUT_JSON {
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(ctx.stdout, string(data))
+		return err
+	}
+	w := tabwriter.NewWriter(ctx.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = fmt.Sprintf("%v", cell)
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	return w.Flush()
+}
+
+func (ctx *context) printApps(apps ...glik.ApplicationResult) error {
+	rows := [][]interface{}{}
+	for _, app := range apps {
+		stream := ""
+		if app.Stream != nil {
+			stream = app.Stream.Name
+		}
+		rows = append(rows, []interface{}{app.Id, app.Name, app.Published, stream, app.LastReloadTime})
+	}
+	return ctx.print(apps, []string{"ID", "NAME", "PUBLISHED", "STREAM", "LAST RELOAD"}, rows)
+}
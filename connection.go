@@ -0,0 +1,294 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// connection types, custom connectors are typed by their provider, e.g. "QvRestConnector.exe"
+const (
+	CONNECTION_FOLDER = "folder"
+	CONNECTION_ODBC   = "ODBC"
+	CONNECTION_OLEDB  = "OLEDB"
+)
+
+// Secret is a password or other credential. It marshals as is to be sent, but prints
+// masked so it stays out of logs and error messages.
+type Secret string
+
+func (s Secret) String() string {
+	if len(s) == 0 {
+		return ""
+	}
+	return "********"
+}
+
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+type ConnectionMeta struct {
+	Name string `json:"qName,omitempty"`
+}
+
+// Connection is a data connection of an app, see the Connection type of the engine api.
+// The engine never returns passwords, Password is only set to create or modify one.
+type Connection struct {
+	Id               string          `json:"qId,omitempty"`
+	Name             string          `json:"qName"`
+	ConnectionString string          `json:"qConnectionString"`
+	Type             string          `json:"qType"`
+	UserName         string          `json:"qUserName,omitempty"`
+	Password         Secret          `json:"qPassword,omitempty"`
+	ModifiedDate     string          `json:"qModifiedDate,omitempty"`
+	Meta             *ConnectionMeta `json:"qMeta,omitempty"`
+}
+
+// NewFolderConnection defines a connection to a folder, scripts read its files as
+// "lib://<name>/<file>".
+func NewFolderConnection(name, path string) Connection {
+	return Connection{Name: name, ConnectionString: path, Type: CONNECTION_FOLDER}
+}
+
+// NewODBCConnection defines a connection to an ODBC data source name.
+func NewODBCConnection(name, dsn, userName string, password Secret) Connection {
+	return Connection{Name: name, ConnectionString: "ODBC CONNECT TO " + quotePath(dsn), Type: CONNECTION_ODBC, UserName: userName, Password: password}
+}
+
+// NewOLEDBConnection defines a connection through an OLE DB provider, connectionString
+// being e.g. "Provider=SQLOLEDB.1;Data Source=db01;Initial Catalog=Sales".
+func NewOLEDBConnection(name, connectionString, userName string, password Secret) Connection {
+	return Connection{Name: name, ConnectionString: "OLEDB CONNECT TO " + quotePath(connectionString), Type: CONNECTION_OLEDB, UserName: userName, Password: password}
+}
+
+// NewCustomConnection defines a connection through a connector, provider being its
+// executable, e.g. "QvRestConnector.exe", and connectionString its settings as
+// "key=value;" pairs.
+func NewCustomConnection(name, provider, connectionString, userName string, password Secret) Connection {
+	settings := "provider=" + provider + ";" + strings.TrimPrefix(connectionString, ";")
+	return Connection{Name: name, ConnectionString: "CUSTOM CONNECT TO " + `"` + strings.Replace(settings, `"`, `""`, -1) + `"`, Type: provider, UserName: userName, Password: password}
+}
+
+// CreateConnection creates a data connection, returning its id.
+func (d *Doc) CreateConnection(connection Connection) (string, error) {
+	var result struct {
+		ConnectionId string `json:"qConnectionId"`
+	}
+	err := d.call("CreateConnection", []interface{}{connection}, &result)
+	return result.ConnectionId, err
+}
+
+// ModifyConnection replaces the data connection with the id. The connection's user name
+// and password are only changed if overrideCredentials is true.
+func (d *Doc) ModifyConnection(id string, connection Connection, overrideCredentials bool) error {
+	return d.call("ModifyConnection", []interface{}{id, connection, overrideCredentials}, nil)
+}
+
+func (d *Doc) DeleteConnection(id string) error {
+	return d.call("DeleteConnection", []interface{}{id}, nil)
+}
+
+func (d *Doc) GetConnection(id string) (Connection, error) {
+	var result struct {
+		Connection Connection `json:"qConnection"`
+	}
+	err := d.call("GetConnection", []interface{}{id}, &result)
+	return result.Connection, err
+}
+
+// GetConnections lists the data connections the app's user can use.
+func (d *Doc) GetConnections() ([]Connection, error) {
+	var result struct {
+		Connections []Connection `json:"qConnections"`
+	}
+	err := d.call("GetConnections", nil, &result)
+	return result.Connections, err
+}
+
+// GetConnectionByName returns ErrDoesNotExist if there is no data connection with the
+// name, compared case insensitively like the engine does.
+func (d *Doc) GetConnectionByName(name string) (Connection, error) {
+	connections, err := d.GetConnections()
+	if err != nil {
+		return Connection{}, err
+	}
+	for _, connection := range connections {
+		if strings.EqualFold(connection.Name, name) {
+			return connection, nil
+		}
+	}
+	return Connection{}, ErrDoesNotExist
+}
+
+// RewriteConnections replaces text in the connection strings of the app's data
+// connections, e.g. {"\\\\dev-share": "\\\\prod-share"} when promoting an app, returning
+// the connections changed. Credentials are left alone.
+func (d *Doc) RewriteConnections(replacements map[string]string) ([]Connection, error) {
+	connections, err := d.GetConnections()
+	if err != nil {
+		return nil, err
+	}
+	retval := []Connection{}
+	for _, connection := range connections {
+		rewritten := rewriteConnectionString(connection.ConnectionString, replacements)
+		if rewritten == connection.ConnectionString {
+			continue
+		}
+		connection.ConnectionString = rewritten
+		err = d.ModifyConnection(connection.Id, connection, false)
+		if err != nil {
+			return retval, fmt.Errorf("error rewriting connection [%s]:%v", connection.Name, err)
+		}
+		retval = append(retval, connection)
+	}
+	return retval, nil
+}
+
+// rewriteConnectionString replaces the longest texts first, so replacements of both
+// "db" and "db01" do what is meant.
+func rewriteConnectionString(connectionString string, replacements map[string]string) string {
+	olds := []string{}
+	for old := range replacements {
+		if len(old) > 0 {
+			olds = append(olds, old)
+		}
+	}
+	sort.Slice(olds, func(i, j int) bool {
+		if len(olds[i]) != len(olds[j]) {
+			return len(olds[i]) > len(olds[j])
+		}
+		return olds[i] < olds[j]
+	})
+	pairs := []string{}
+	for _, old := range olds {
+		pairs = append(pairs, old, replacements[old])
+	}
+	return strings.NewReplacer(pairs...).Replace(connectionString)
+}
+
+// DataConnection is a data connection as stored by the repository. The QRS never
+// returns passwords, Password is only set to create or update one.
+type DataConnection struct {
+	Id               string `json:"id,omitempty"`
+	CreatedDate      string `json:"createdDate,omitempty"`
+	ModifiedDate     string `json:"modifiedDate,omitempty"`
+	Name             string `json:"name,omitempty"`
+	ConnectionString string `json:"connectionstring,omitempty"`
+	Type             string `json:"type,omitempty"`
+	UserName         string `json:"username,omitempty"`
+	Password         Secret `json:"password,omitempty"`
+	Architecture     int    `json:"architecture,omitempty"`
+	LogOn            int    `json:"logOn,omitempty"`
+	Tags             []Tag  `json:"tags,omitempty"`
+	Owner            *Owner `json:"owner,omitempty"`
+	SchemaPath       string `json:"schemaPath,omitempty"`
+}
+
+// DataConnections lists the connections condensed, without their dates, tags or owner.
+// Read a connection with DataConnection before updating it.
+func (api *API) DataConnections() ([]DataConnection, error) {
+	xrfKey := makeXrfKey()
+	url := api.qrsUrl("dataconnection", xrfQuery(xrfKey))
+	var retval []DataConnection
+	headers := make(map[string]string)
+	headers[xrf_header] = xrfKey
+	headers[qlik_user_header] = api.makeQlikUserHeader()
+	headers[content_type_header] = application_json_content_type
+	err := api.makeRequest(url, GET, nil, &retval, headers, connectTimeOut, readWriteTimeout)
+	return retval, err
+}
+
+func (api *API) DataConnection(id string) (DataConnection, error) {
+	xrfKey := makeXrfKey()
+	url := api.qrsUrl("dataconnection/"+id, xrfQuery(xrfKey))
+	var retval DataConnection
+	headers := make(map[string]string)
+	headers[xrf_header] = xrfKey
+	headers[qlik_user_header] = api.makeQlikUserHeader()
+	headers[content_type_header] = application_json_content_type
+	err := api.makeRequest(url, GET, nil, &retval, headers, connectTimeOut, readWriteTimeout)
+	return retval, err
+}
+
+func (api *API) CreateDataConnection(connection DataConnection) (DataConnection, error) {
+	var retval DataConnection
+	payload, err := json.Marshal(connection)
+	if err != nil {
+		return retval, err
+	}
+	xrfKey := makeXrfKey()
+	url := api.qrsUrl("dataconnection", xrfQuery(xrfKey))
+	headers := make(map[string]string)
+	headers[xrf_header] = xrfKey
+	headers[qlik_user_header] = api.makeQlikUserHeader()
+	headers[content_type_header] = application_json_content_type
+	err = api.makeRequest(url, POST, payload, &retval, headers, connectTimeOut, readWriteTimeout)
+	return retval, err
+}
+
+// UpdateDataConnection saves a connection read by DataConnection(s). The QRS refuses
+// the update if the connection was modified since, as told by its ModifiedDate.
+func (api *API) UpdateDataConnection(connection DataConnection) (DataConnection, error) {
+	var retval DataConnection
+	payload, err := json.Marshal(connection)
+	if err != nil {
+		return retval, err
+	}
+	xrfKey := makeXrfKey()
+	url := api.qrsUrl("dataconnection/"+connection.Id, xrfQuery(xrfKey))
+	headers := make(map[string]string)
+	headers[xrf_header] = xrfKey
+	headers[qlik_user_header] = api.makeQlikUserHeader()
+	headers[content_type_header] = application_json_content_type
+	err = api.makeRequest(url, PUT, payload, &retval, headers, connectTimeOut, readWriteTimeout)
+	return retval, err
+}
+
+func (api *API) DeleteDataConnection(id string) error {
+	xrfKey := makeXrfKey()
+	url := api.qrsUrl("dataconnection/"+id, xrfQuery(xrfKey))
+	headers := make(map[string]string)
+	headers[xrf_header] = xrfKey
+	headers[qlik_user_header] = api.makeQlikUserHeader()
+	headers[content_type_header] = application_json_content_type
+	return api.makeRequest(url, DELETE, nil, nil, headers, connectTimeOut, readWriteTimeout)
+}
+
+// RewriteDataConnections is RewriteConnections for all connections of the repository.
+func (api *API) RewriteDataConnections(replacements map[string]string) ([]DataConnection, error) {
+	connections, err := api.DataConnections()
+	if err != nil {
+		return nil, err
+	}
+	retval := []DataConnection{}
+	for _, condensed := range connections {
+		if rewriteConnectionString(condensed.ConnectionString, replacements) == condensed.ConnectionString {
+			continue
+		}
+		// the update needs the full connection, the list being condensed
+		connection, err := api.DataConnection(condensed.Id)
+		if err != nil {
+			return retval, fmt.Errorf("error rewriting data connection [%s]:%v", condensed.Name, err)
+		}
+		connection.ConnectionString = rewriteConnectionString(connection.ConnectionString, replacements)
+		updated, err := api.UpdateDataConnection(connection)
+		if err != nil {
+			return retval, fmt.Errorf("error rewriting data connection [%s]:%v", connection.Name, err)
+		}
+		retval = append(retval, updated)
+	}
+	return retval, nil
+}
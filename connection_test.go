@@ -0,0 +1,163 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"github.com/mattbaird/glik/qrstest"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSecretMasked(t *testing.T) {
+	connection := glik.NewODBCConnection("Sales DB", "dev-dsn", "etl", "hunter2")
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		if text := fmt.Sprintf(format, connection); strings.Contains(text, "hunter2") {
+			t.Errorf("%s printed the password: %s", format, text)
+		}
+	}
+	if connection.ConnectionString != "ODBC CONNECT TO [dev-dsn]" || string(connection.Password) != "hunter2" {
+		t.Errorf("got %+v", connection)
+	}
+	custom := glik.NewCustomConnection("Rest", "QvRestConnector.exe", `url="http://dev/api";`, "", "")
+	if custom.ConnectionString != `CUSTOM CONNECT TO "provider=QvRestConnector.exe;url=""http://dev/api"";"` || custom.Type != "QvRestConnector.exe" {
+		t.Errorf("got %+v", custom)
+	}
+}
+
+func TestConnections(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	doc := openTestDoc(t, server, "Sales.qvf")
+	id, err := doc.CreateConnection(glik.NewODBCConnection("Sales DB", "dev-dsn", "etl", "hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.CreateConnection(glik.NewODBCConnection("Sales DB", "dev-dsn", "", "")); err == nil {
+		t.Error("expected an error creating a connection twice")
+	}
+	if _, err := doc.CreateConnection(glik.NewFolderConnection("Data", `\\dev-share\data`)); err != nil {
+		t.Fatal(err)
+	}
+	if connection, err := doc.GetConnectionByName("data"); err != nil || connection.ConnectionString != `\\dev-share\data` {
+		t.Errorf("got %+v, %v", connection, err)
+	}
+	if _, err := doc.GetConnectionByName("Missing"); err != glik.ErrDoesNotExist {
+		t.Errorf("got %v", err)
+	}
+	changed, err := doc.RewriteConnections(map[string]string{"dev": "prod", "dev-dsn": "prod-dsn-01"})
+	if err != nil || len(changed) != 2 {
+		t.Fatalf("got %+v, %v", changed, err)
+	}
+	if connection, err := doc.GetConnection(id); err != nil || connection.ConnectionString != "ODBC CONNECT TO [prod-dsn-01]" || len(connection.Password) != 0 {
+		t.Errorf("got %+v, %v", connection, err)
+	}
+	// the credentials were left alone
+	for _, connection := range server.Connections() {
+		if connection.Id == id && (connection.UserName != "etl" || connection.Password != "hunter2") {
+			t.Errorf("got %+v", connection)
+		}
+	}
+	if err := doc.DeleteConnection(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.GetConnection(id); err == nil {
+		t.Error("expected an error getting a deleted connection")
+	}
+}
+
+func TestDataConnections(t *testing.T) {
+	store := qrstest.NewStore()
+	data := store.AddDataConnection("Data", `\\dev-share\data`, glik.CONNECTION_FOLDER)
+	data.Tags = []glik.Tag{*store.AddTag("finance")}
+	store.AddDataConnection("Archive", `\\archive\data`, glik.CONNECTION_FOLDER)
+	server := qrstest.NewServer(store)
+	defer server.Close()
+	api := server.API()
+	created, err := api.CreateDataConnection(glik.DataConnection{Name: "Sales DB", ConnectionString: "ODBC CONNECT TO [dev-dsn]", Type: glik.CONNECTION_ODBC, UserName: "etl", Password: "hunter2"})
+	if err != nil || len(created.Id) == 0 || len(created.Password) != 0 {
+		t.Fatalf("got %+v, %v", created, err)
+	}
+	list, err := api.DataConnections()
+	if err != nil || len(list) != 3 {
+		t.Fatalf("got %+v, %v", list, err)
+	}
+	// the list is condensed, so it cannot be saved back
+	if len(list[0].ModifiedDate) != 0 || len(list[0].Tags) != 0 {
+		t.Errorf("got %+v", list[0])
+	}
+	if _, err := api.UpdateDataConnection(list[0]); err == nil {
+		t.Error("expected an error updating a condensed connection")
+	}
+	changed, err := api.RewriteDataConnections(map[string]string{"dev": "prod"})
+	if err != nil || len(changed) != 2 {
+		t.Fatalf("got %+v, %v", changed, err)
+	}
+	if stored := store.DataConnection(data.Id); stored.ConnectionString != `\\prod-share\data` || len(stored.Tags) != 1 {
+		t.Errorf("got %+v", stored)
+	}
+	if stored := store.DataConnection(created.Id); stored.ConnectionString != "ODBC CONNECT TO [prod-dsn]" || stored.Password != "hunter2" {
+		t.Errorf("got %+v", stored)
+	}
+	if err := api.DeleteDataConnection(created.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.DataConnection(created.Id); err != glik.ErrDoesNotExist {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestRewriteTaggedDataConnection(t *testing.T) {
+	var decoded glik.DataConnection
+	if err := json.Unmarshal([]byte(`{"name":"Data","tags":[{"id":"t1","name":"finance"}]}`), &decoded); err != nil || len(decoded.Tags) != 1 || decoded.Tags[0].Name != "finance" {
+		t.Fatalf("got %+v, %v", decoded, err)
+	}
+	store := qrstest.NewStore()
+	finance := store.AddTag("finance")
+	data := store.AddDataConnection("Data", `\\dev-share\data`, glik.CONNECTION_FOLDER)
+	data.Tags = []glik.Tag{*finance}
+	server := qrstest.NewServer(store)
+	defer server.Close()
+	api := server.API()
+	if connection, err := api.DataConnection(data.Id); err != nil || len(connection.Tags) != 1 || connection.Tags[0] != *finance {
+		t.Fatalf("got %+v, %v", connection, err)
+	}
+	changed, err := api.RewriteDataConnections(map[string]string{"dev": "prod"})
+	if err != nil || len(changed) != 1 || len(changed[0].Tags) != 1 {
+		t.Fatalf("got %+v, %v", changed, err)
+	}
+	// the tags were sent back with the update rather than dropped
+	if stored := store.DataConnection(data.Id); stored.ConnectionString != `\\prod-share\data` || len(stored.Tags) != 1 || stored.Tags[0] != *finance {
+		t.Errorf("got %+v", stored)
+	}
+}
+
+func TestRewriteDataConnectionsReadError(t *testing.T) {
+	store := qrstest.NewStore()
+	data := store.AddDataConnection("Data", `\\dev-share\data`, glik.CONNECTION_FOLDER)
+	server := qrstest.NewServer(store)
+	defer server.Close()
+	server.InjectError("GET", "/qrs/dataconnection/"+data.Id, http.StatusInternalServerError, 1)
+	api := server.API()
+	changed, err := api.RewriteDataConnections(map[string]string{"dev": "prod"})
+	if err == nil || !strings.Contains(err.Error(), "[Data]") || len(changed) != 0 {
+		t.Errorf("got %+v, %v", changed, err)
+	}
+	if stored := store.DataConnection(data.Id); stored.ConnectionString != `\\dev-share\data` {
+		t.Errorf("got %+v", stored)
+	}
+}
@@ -0,0 +1,485 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// key types of FieldInTableData
+const (
+	KEY_TYPE_NOT_KEY     = "NOT_KEY"
+	KEY_TYPE_ANY_KEY     = "ANY_KEY"
+	KEY_TYPE_PRIMARY_KEY = "PRIMARY_KEY"
+	KEY_TYPE_PERFECT_KEY = "PERFECT_KEY"
+)
+
+// the engine names synthetic keys "$Syn 1", "$Syn 2", ... and their tables "$Syn 1 Table"
+const SYNTHETIC_KEY_PREFIX = "$Syn "
+
+type FieldInTableData struct {
+	Name                  string   `json:"qName"`
+	OriginalFields        []string `json:"qOriginalFields,omitempty"`
+	Present               bool     `json:"qPresent"`
+	HasNull               bool     `json:"qHasNull"`
+	HasWild               bool     `json:"qHasWild"`
+	HasDuplicates         bool     `json:"qHasDuplicates"`
+	IsSynthetic           bool     `json:"qIsSynthetic"`
+	InformationDensity    float64  `json:"qInformationDensity"`
+	NonNulls              int      `json:"qnNonNulls"`
+	Rows                  int      `json:"qnRows"`
+	SubsetRatio           float64  `json:"qSubsetRatio"`
+	TotalDistinctValues   int      `json:"qnTotalDistinctValues"`
+	PresentDistinctValues int      `json:"qnPresentDistinctValues"`
+	KeyType               string   `json:"qKeyType"`
+	Comment               string   `json:"qComment,omitempty"`
+	Tags                  []string `json:"qTags,omitempty"`
+}
+
+// TableRecord is a table of the data model. Loose tables are those the engine cut off
+// to break a circular reference.
+type TableRecord struct {
+	Name              string             `json:"qName"`
+	Loose             bool               `json:"qLoose"`
+	NoOfRows          int                `json:"qNoOfRows"`
+	Fields            []FieldInTableData `json:"qFields"`
+	Comment           string             `json:"qComment,omitempty"`
+	IsDirectDiscovery bool               `json:"qIsDirectDiscovery"`
+	IsSynthetic       bool               `json:"qIsSynthetic"`
+}
+
+// SourceKeyRecord is a key, the fields associating the tables.
+type SourceKeyRecord struct {
+	KeyFields []string `json:"qKeyFields"`
+	Tables    []string `json:"qTables"`
+}
+
+// GetTablesAndKeys returns the tables and keys of the data model, as the data model
+// viewer shows them. In synthetic mode synthetic keys are tables of their own.
+func (d *Doc) GetTablesAndKeys(syntheticMode, includeSysVars bool) ([]TableRecord, []SourceKeyRecord, error) {
+	var result struct {
+		Tables []TableRecord     `json:"qtr"`
+		Keys   []SourceKeyRecord `json:"qk"`
+	}
+	err := d.call("GetTablesAndKeys", []interface{}{NxSize{}, NxSize{}, 0, syntheticMode, includeSysVars}, &result)
+	return result.Tables, result.Keys, err
+}
+
+// GetTableData returns rows of a table of the data model, starting at offset.
+func (d *Doc) GetTableData(table string, offset, rows int, syntheticMode bool) ([][]FieldValue, error) {
+	var result struct {
+		Data []struct {
+			Value []FieldValue `json:"qValue"`
+		} `json:"qData"`
+	}
+	err := d.call("GetTableData", []interface{}{offset, rows, syntheticMode, table}, &result)
+	if err != nil {
+		return nil, err
+	}
+	retval := [][]FieldValue{}
+	for _, row := range result.Data {
+		retval = append(retval, row.Value)
+	}
+	return retval, nil
+}
+
+// ModelTable is a table of a DataModel, KeyFields being its fields shared with other
+// tables.
+type ModelTable struct {
+	Name      string
+	Rows      int
+	Loose     bool
+	Fields    []string
+	KeyFields []string
+}
+
+// ModelKey is a field associating tables, or for synthetic keys the fields two or more
+// tables all share, which the engine combines into a synthetic key table.
+type ModelKey struct {
+	Name      string
+	Fields    []string
+	Tables    []string
+	Synthetic bool
+}
+
+// CircularReference is a loop of tables associated through the keys, which makes the
+// engine cut one of the tables loose.
+type CircularReference struct {
+	Tables []string
+	Keys   []string
+}
+
+func (c CircularReference) String() string {
+	return strings.Join(c.Tables, " - ") + " (" + strings.Join(c.Keys, ", ") + ")"
+}
+
+// DataModel is the associative model of an app's data as a graph of tables linked by
+// keys, see Doc.DataModel.
+type DataModel struct {
+	Tables             []ModelTable
+	Keys               []ModelKey
+	SyntheticKeys      []ModelKey
+	CircularReferences []CircularReference
+}
+
+// DataModel reads the data model of the app as its last reload left it. Rows of its
+// tables are read with GetTableData.
+func (d *Doc) DataModel() (*DataModel, error) {
+	tables, keys, err := d.GetTablesAndKeys(true, false)
+	if err != nil {
+		return nil, err
+	}
+	return NewDataModel(tables, keys), nil
+}
+
+// NewDataModel builds the model from the tables and keys of GetTablesAndKeys in
+// synthetic mode, where each synthetic key is a table of its own, "$Syn 1 Table", holding
+// the fields it combines and the "$Syn 1" field that replaces them in the tables it
+// links. Circular references are worked out from the keys.
+func NewDataModel(tables []TableRecord, keys []SourceKeyRecord) *DataModel {
+	model := &DataModel{Tables: []ModelTable{}, Keys: []ModelKey{}, SyntheticKeys: syntheticKeys(tables), CircularReferences: []CircularReference{}}
+	synthetic := map[string]ModelKey{}
+	syntheticTables := map[string]ModelKey{}
+	for _, key := range model.SyntheticKeys {
+		synthetic[key.Name] = key
+	}
+	syntheticFields := map[string]bool{}
+	for _, table := range tables {
+		for _, field := range table.Fields {
+			syntheticFields[field.Name] = syntheticFields[field.Name] || field.IsSynthetic
+			if key, ok := synthetic[field.Name]; ok && table.IsSynthetic {
+				syntheticTables[table.Name] = key
+			}
+		}
+	}
+	for _, record := range keys {
+		combined := false
+		for _, field := range record.KeyFields {
+			combined = combined || syntheticFields[field]
+		}
+		if combined {
+			continue
+		}
+		key := ModelKey{Name: strings.Join(record.KeyFields, ", "), Fields: record.KeyFields, Tables: []string{}}
+		for _, table := range record.Tables {
+			if syntheticKey, ok := syntheticTables[table]; ok {
+				key.Tables = appendMissing(key.Tables, syntheticKey.Tables...)
+			} else {
+				key.Tables = appendMissing(key.Tables, table)
+			}
+		}
+		if len(key.Tables) < 2 {
+			continue
+		}
+		sort.Strings(key.Tables)
+		model.Keys = append(model.Keys, key)
+	}
+	sort.Slice(model.Keys, func(i, j int) bool { return model.Keys[i].Name < model.Keys[j].Name })
+	for _, table := range tables {
+		if table.IsSynthetic {
+			continue
+		}
+		modelTable := ModelTable{Name: table.Name, Rows: table.NoOfRows, Loose: table.Loose, Fields: []string{}, KeyFields: []string{}}
+		for _, field := range table.Fields {
+			if key, ok := synthetic[field.Name]; ok {
+				modelTable.Fields = appendMissing(modelTable.Fields, key.Fields...)
+				modelTable.KeyFields = appendMissing(modelTable.KeyFields, key.Fields...)
+			} else if !field.IsSynthetic {
+				modelTable.Fields = appendMissing(modelTable.Fields, field.Name)
+			}
+		}
+		for _, key := range model.Keys {
+			for _, name := range key.Tables {
+				if name == table.Name {
+					modelTable.KeyFields = appendMissing(modelTable.KeyFields, key.Fields...)
+				}
+			}
+		}
+		model.Tables = append(model.Tables, modelTable)
+	}
+	model.CircularReferences = circularReferences(model)
+	return model
+}
+
+// syntheticKeys reads the synthetic keys off the engine's synthetic tables, keeping the
+// engine's names, and links each to the tables having its "$Syn" field.
+func syntheticKeys(tables []TableRecord) []ModelKey {
+	retval := []ModelKey{}
+	for _, table := range tables {
+		if !table.IsSynthetic {
+			continue
+		}
+		key := ModelKey{Fields: []string{}, Tables: []string{}, Synthetic: true}
+		for _, field := range table.Fields {
+			if field.IsSynthetic {
+				key.Name = field.Name
+			} else {
+				key.Fields = append(key.Fields, field.Name)
+			}
+		}
+		if len(key.Name) == 0 {
+			key.Name = strings.TrimSuffix(table.Name, " Table")
+		}
+		for _, other := range tables {
+			if other.IsSynthetic {
+				continue
+			}
+			for _, field := range other.Fields {
+				if field.Name == key.Name {
+					key.Tables = appendMissing(key.Tables, other.Name)
+				}
+			}
+		}
+		sort.Strings(key.Fields)
+		sort.Strings(key.Tables)
+		retval = append(retval, key)
+	}
+	return retval
+}
+
+// modelGraph is the data model as the engine links it: tables and keys are nodes,
+// a table's fields that are part of a synthetic key being linked through the synthetic
+// key. Node ids are "t<table index>" and "k<key index>", synthetic keys coming first.
+type modelGraph struct {
+	nodes []string
+	// links of each key node, to tables and synthetic keys
+	links map[string][]string
+	keys  []string
+}
+
+func newModelGraph(model *DataModel) *modelGraph {
+	graph := &modelGraph{links: map[string][]string{}}
+	tableIds := map[string]string{}
+	for i, table := range model.Tables {
+		id := "t" + strconv.Itoa(i)
+		tableIds[table.Name] = id
+		graph.nodes = append(graph.nodes, id)
+	}
+	covered := map[string]string{}
+	for i, key := range model.SyntheticKeys {
+		id := "k" + strconv.Itoa(i)
+		graph.nodes = append(graph.nodes, id)
+		graph.keys = append(graph.keys, id)
+		for _, table := range key.Tables {
+			graph.links[id] = append(graph.links[id], tableIds[table])
+			for _, field := range key.Fields {
+				if _, ok := covered[table+"\x00"+field]; !ok {
+					covered[table+"\x00"+field] = id
+				}
+			}
+		}
+	}
+	for i, key := range model.Keys {
+		members := []string{}
+		for _, table := range key.Tables {
+			member, ok := covered[table+"\x00"+key.Name]
+			if !ok {
+				member = tableIds[table]
+			}
+			members = appendMissing(members, member)
+		}
+		if len(members) < 2 {
+			continue
+		}
+		id := "k" + strconv.Itoa(len(model.SyntheticKeys)+i)
+		graph.nodes = append(graph.nodes, id)
+		graph.keys = append(graph.keys, id)
+		graph.links[id] = members
+	}
+	return graph
+}
+
+// key returns the key of a key node.
+func (g *modelGraph) key(model *DataModel, id string) ModelKey {
+	i, _ := strconv.Atoi(id[1:])
+	if i < len(model.SyntheticKeys) {
+		return model.SyntheticKeys[i]
+	}
+	return model.Keys[i-len(model.SyntheticKeys)]
+}
+
+// circularReferences finds the links closing loops, through a spanning forest of the
+// model graph, and reports each loop.
+func circularReferences(model *DataModel) []CircularReference {
+	graph := newModelGraph(model)
+	parent := map[string]string{}
+	var root func(id string) string
+	root = func(id string) string {
+		if p, ok := parent[id]; ok && p != id {
+			parent[id] = root(p)
+			return parent[id]
+		}
+		return id
+	}
+	tree := map[string][]string{}
+	retval := []CircularReference{}
+	for _, key := range graph.keys {
+		for _, member := range graph.links[key] {
+			if root(key) != root(member) {
+				parent[root(key)] = root(member)
+				tree[key] = append(tree[key], member)
+				tree[member] = append(tree[member], key)
+				continue
+			}
+			loop := CircularReference{Tables: []string{}, Keys: []string{}}
+			for _, id := range treePath(tree, member, key) {
+				if strings.HasPrefix(id, "t") {
+					i, _ := strconv.Atoi(id[1:])
+					loop.Tables = append(loop.Tables, model.Tables[i].Name)
+				} else {
+					loop.Keys = append(loop.Keys, graph.key(model, id).Name)
+				}
+			}
+			retval = append(retval, loop)
+		}
+	}
+	return retval
+}
+
+// treePath returns the nodes on the path from one node to another in a forest.
+func treePath(tree map[string][]string, from, to string) []string {
+	previous := map[string]string{from: from}
+	queue := []string{from}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if node == to {
+			break
+		}
+		for _, next := range tree[node] {
+			if _, seen := previous[next]; !seen {
+				previous[next] = node
+				queue = append(queue, next)
+			}
+		}
+	}
+	retval := []string{to}
+	for node := to; node != from; {
+		node = previous[node]
+		retval = append([]string{node}, retval...)
+	}
+	return retval
+}
+
+// NewSyntheticKeys returns the synthetic keys of the model that the baseline, e.g. the
+// model of the previous release, does not have. Keys are matched by their fields.
+func (m *DataModel) NewSyntheticKeys(baseline *DataModel) []ModelKey {
+	known := map[string]bool{}
+	for _, key := range baseline.SyntheticKeys {
+		known[strings.Join(key.Fields, "\x00")] = true
+	}
+	retval := []ModelKey{}
+	for _, key := range m.SyntheticKeys {
+		if !known[strings.Join(key.Fields, "\x00")] {
+			retval = append(retval, key)
+		}
+	}
+	return retval
+}
+
+// DOT writes the model as a Graphviz graph, e.g. for dot -Tsvg. Keys linking two tables
+// are edges, others nodes of their own. Synthetic keys and loose tables are red.
+func (m *DataModel) DOT() string {
+	graph := newModelGraph(m)
+	lines := []string{"graph DataModel {", "\tnode [shape=box];"}
+	for i, table := range m.Tables {
+		attributes := ""
+		if table.Loose {
+			attributes = ", color=red, style=dashed"
+		}
+		label := table.Name + "\n" + rowCount(table.Rows)
+		lines = append(lines, fmt.Sprintf("\tt%d [label=%s%s];", i, dotQuote(label), attributes))
+	}
+	for _, id := range graph.keys {
+		key := graph.key(m, id)
+		members := graph.links[id]
+		if !key.Synthetic && len(members) == 2 {
+			lines = append(lines, fmt.Sprintf("\t%s -- %s [label=%s];", members[0], members[1], dotQuote(key.Name)))
+			continue
+		}
+		if key.Synthetic {
+			lines = append(lines, fmt.Sprintf("\t%s [label=%s, shape=diamond, color=red];", id, dotQuote(key.Name+"\n"+strings.Join(key.Fields, ", "))))
+		} else {
+			lines = append(lines, fmt.Sprintf("\t%s [label=%s, shape=ellipse];", id, dotQuote(key.Name)))
+		}
+		for _, member := range members {
+			lines = append(lines, fmt.Sprintf("\t%s -- %s;", id, member))
+		}
+	}
+	lines = append(lines, "}")
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Mermaid writes the model as a Mermaid flowchart, which GitHub renders in markdown.
+func (m *DataModel) Mermaid() string {
+	graph := newModelGraph(m)
+	lines := []string{"flowchart LR"}
+	for i, table := range m.Tables {
+		lines = append(lines, fmt.Sprintf("    t%d[%s]", i, mermaidQuote(table.Name+"<br/>"+rowCount(table.Rows))))
+		if table.Loose {
+			lines = append(lines, fmt.Sprintf("    style t%d stroke:red,stroke-dasharray:5", i))
+		}
+	}
+	for _, id := range graph.keys {
+		key := graph.key(m, id)
+		members := graph.links[id]
+		if !key.Synthetic && len(members) == 2 {
+			lines = append(lines, fmt.Sprintf("    %s ---|%s| %s", members[0], mermaidQuote(key.Name), members[1]))
+			continue
+		}
+		if key.Synthetic {
+			lines = append(lines, fmt.Sprintf("    %s{{%s}}", id, mermaidQuote(key.Name+"<br/>"+strings.Join(key.Fields, ", "))))
+			lines = append(lines, fmt.Sprintf("    style %s stroke:red", id))
+		} else {
+			lines = append(lines, fmt.Sprintf("    %s((%s))", id, mermaidQuote(key.Name)))
+		}
+		for _, member := range members {
+			lines = append(lines, fmt.Sprintf("    %s --- %s", id, member))
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func rowCount(rows int) string {
+	if rows == 1 {
+		return "1 row"
+	}
+	return strconv.Itoa(rows) + " rows"
+}
+
+func dotQuote(label string) string {
+	return `"` + strings.Replace(strings.Replace(strings.Replace(label, `\`, `\\`, -1), `"`, `\"`, -1), "\n", `\n`, -1) + `"`
+}
+
+// mermaidQuote quotes a label, the quotes in it written as entities.
+func mermaidQuote(label string) string {
+	return `"` + strings.Replace(label, `"`, "#quot;", -1) + `"`
+}
+
+func appendMissing(values []string, more ...string) []string {
+	for _, value := range more {
+		found := false
+		for _, existing := range values {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,192 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"fmt"
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// tableRecord is a table as GetTablesAndKeys returns it in synthetic mode, "$Syn"
+// fields being synthetic.
+func tableRecord(name string, rows int, fields ...string) glik.TableRecord {
+	table := glik.TableRecord{Name: name, NoOfRows: rows, IsSynthetic: strings.HasPrefix(name, glik.SYNTHETIC_KEY_PREFIX)}
+	for _, field := range fields {
+		table.Fields = append(table.Fields, glik.FieldInTableData{Name: field, IsSynthetic: strings.HasPrefix(field, glik.SYNTHETIC_KEY_PREFIX), KeyType: glik.KEY_TYPE_NOT_KEY})
+	}
+	return table
+}
+
+// salesModel has a loop of orders, customers and products, and two synthetic keys the
+// engine numbered unlike their fields sort.
+func salesModel() ([]glik.TableRecord, []glik.SourceKeyRecord) {
+	tables := []glik.TableRecord{
+		tableRecord("Orders", 100, "OrderId", "CustomerId", "ProductId"),
+		tableRecord("Customers", 10, "CustomerId", "RegionId", "Name"),
+		tableRecord("Products", 5, "ProductId", "RegionId"),
+		tableRecord("Budget", 1, "$Syn 1", "Budget"),
+		tableRecord("Actuals", 12, "$Syn 1", "$Syn 2", "Actual"),
+		tableRecord("Ledger", 40, "$Syn 2", "Amount"),
+		tableRecord("Entities", 3, "Entity", "Entity Name"),
+		tableRecord("$Syn 1 Table", 12, "Year", "Month", "$Syn 1"),
+		tableRecord("$Syn 2 Table", 6, "Entity", "Account", "$Syn 2"),
+	}
+	keys := []glik.SourceKeyRecord{
+		{KeyFields: []string{"CustomerId"}, Tables: []string{"Orders", "Customers"}},
+		{KeyFields: []string{"ProductId"}, Tables: []string{"Orders", "Products"}},
+		{KeyFields: []string{"RegionId"}, Tables: []string{"Customers", "Products"}},
+		{KeyFields: []string{"$Syn 1"}, Tables: []string{"Budget", "Actuals", "$Syn 1 Table"}},
+		{KeyFields: []string{"$Syn 2"}, Tables: []string{"Actuals", "Ledger", "$Syn 2 Table"}},
+		{KeyFields: []string{"Entity"}, Tables: []string{"$Syn 2 Table", "Entities"}},
+	}
+	return tables, keys
+}
+
+func TestNewDataModel(t *testing.T) {
+	model := glik.NewDataModel(salesModel())
+	if fmt.Sprint(model.SyntheticKeys) != "[{$Syn 1 [Month Year] [Actuals Budget] true} {$Syn 2 [Account Entity] [Actuals Ledger] true}]" {
+		t.Errorf("got synthetic keys %v", model.SyntheticKeys)
+	}
+	if fmt.Sprint(model.Keys) != "[{CustomerId [CustomerId] [Customers Orders] false} {Entity [Entity] [Actuals Entities Ledger] false} {ProductId [ProductId] [Orders Products] false} {RegionId [RegionId] [Customers Products] false}]" {
+		t.Errorf("got keys %v", model.Keys)
+	}
+	if len(model.Tables) != 7 {
+		t.Fatalf("got tables %+v", model.Tables)
+	}
+	actuals := model.Tables[4]
+	if actuals.Name != "Actuals" || fmt.Sprint(actuals.Fields) != "[Month Year Account Entity Actual]" || fmt.Sprint(actuals.KeyFields) != "[Month Year Account Entity]" {
+		t.Errorf("got %+v", actuals)
+	}
+	if entities := model.Tables[6]; fmt.Sprint(entities.KeyFields) != "[Entity]" {
+		t.Errorf("got %+v", entities)
+	}
+	if len(model.CircularReferences) != 1 {
+		t.Fatalf("got %v", model.CircularReferences)
+	}
+	loop := model.CircularReferences[0]
+	tables, keys := append([]string{}, loop.Tables...), append([]string{}, loop.Keys...)
+	sort.Strings(tables)
+	sort.Strings(keys)
+	if fmt.Sprint(tables) != "[Customers Orders Products]" || fmt.Sprint(keys) != "[CustomerId ProductId RegionId]" {
+		t.Errorf("got %v", loop)
+	}
+}
+
+func TestCircularReferenceThroughSyntheticKey(t *testing.T) {
+	tables := []glik.TableRecord{
+		tableRecord("Budget", 1, "$Syn 1", "Region"),
+		tableRecord("Actuals", 12, "$Syn 1", "Store"),
+		tableRecord("Stores", 4, "Store", "Region"),
+		tableRecord("$Syn 1 Table", 12, "Year", "Month", "$Syn 1"),
+	}
+	keys := []glik.SourceKeyRecord{
+		{KeyFields: []string{"$Syn 1"}, Tables: []string{"Budget", "Actuals", "$Syn 1 Table"}},
+		{KeyFields: []string{"Region"}, Tables: []string{"Budget", "Stores"}},
+		{KeyFields: []string{"Store"}, Tables: []string{"Actuals", "Stores"}},
+	}
+	model := glik.NewDataModel(tables, keys)
+	if len(model.CircularReferences) != 1 {
+		t.Fatalf("got %v", model.CircularReferences)
+	}
+	loop := model.CircularReferences[0]
+	if len(loop.Tables) != 3 || !strings.Contains(loop.String(), "$Syn 1") {
+		t.Errorf("got %v", loop)
+	}
+	// without the stores there is no loop
+	model = glik.NewDataModel(append(tables[:2:2], tables[3]), keys[:1])
+	if len(model.CircularReferences) != 0 || len(model.SyntheticKeys) != 1 {
+		t.Errorf("got %+v", model)
+	}
+}
+
+func TestNewSyntheticKeys(t *testing.T) {
+	model := glik.NewDataModel(salesModel())
+	tables, keys := salesModel()
+	baseline := glik.NewDataModel(append(tables[:5:5], tables[7]), keys[:4])
+	added := model.NewSyntheticKeys(baseline)
+	if len(added) != 1 || fmt.Sprint(added[0].Fields) != "[Account Entity]" {
+		t.Errorf("got %v", added)
+	}
+	if added := model.NewSyntheticKeys(model); len(added) != 0 {
+		t.Errorf("got %v", added)
+	}
+}
+
+func TestDataModelGraphs(t *testing.T) {
+	model := glik.NewDataModel(salesModel())
+	dot := model.DOT()
+	for _, line := range []string{
+		"graph DataModel {",
+		`	t0 [label="Orders\n100 rows"];`,
+		`	t3 [label="Budget\n1 row"];`,
+		`	t1 -- t0 [label="CustomerId"];`,
+		`	k0 [label="$Syn 1\nMonth, Year", shape=diamond, color=red];`,
+		"	k0 -- t4;",
+	} {
+		if !strings.Contains(dot, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, dot)
+		}
+	}
+	mermaid := model.Mermaid()
+	for _, line := range []string{
+		"flowchart LR",
+		`    t0["Orders<br/>100 rows"]`,
+		`    k1{{"$Syn 2<br/>Account, Entity"}}`,
+		"    style k1 stroke:red",
+		`    k1 ---|"Entity"| t6`,
+	} {
+		if !strings.Contains(mermaid, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, mermaid)
+		}
+	}
+}
+
+func TestDocDataModel(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	tables, keys := salesModel()
+	server.Handle("Doc.GetTablesAndKeys", func(call *enginetest.Call) (interface{}, error) {
+		var syntheticMode bool
+		if err := call.Arg(3, "qSyntheticMode", &syntheticMode); err != nil || !syntheticMode {
+			return nil, &enginetest.Error{Code: enginetest.LOCERR_GENERIC_INVALID_PARAMETERS, Message: "expected synthetic mode"}
+		}
+		return map[string]interface{}{"qtr": tables, "qk": keys}, nil
+	})
+	server.Handle("Doc.GetTableData", func(call *enginetest.Call) (interface{}, error) {
+		var table string
+		if err := call.Arg(3, "qTableName", &table); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"qData": []map[string]interface{}{
+			{"qValue": []glik.FieldValue{{Text: table}, {Text: "1", IsNumeric: true, Number: 1}}},
+		}}, nil
+	})
+	doc := openTestDoc(t, server, "Sales.qvf")
+	model, err := doc.DataModel()
+	if err != nil || len(model.Tables) != 7 || len(model.SyntheticKeys) != 2 || len(model.CircularReferences) != 1 {
+		t.Fatalf("got %+v, %v", model, err)
+	}
+	rows, err := doc.GetTableData("Orders", 10, 1, false)
+	if err != nil || len(rows) != 1 || rows[0][0].Text != "Orders" || rows[0][1].Number != 1 {
+		t.Errorf("got %+v, %v", rows, err)
+	}
+	for _, request := range server.Requests() {
+		if request.Method == "GetTableData" && string(request.Params) != `[10,1,false,"Orders"]` {
+			t.Errorf("got %s", request.Params)
+		}
+	}
+}
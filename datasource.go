@@ -0,0 +1,306 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"fmt"
+	"strings"
+)
+
+// file types of FileDataFormat
+const (
+	FILE_TYPE_CSV         = "CSV"
+	FILE_TYPE_FIXED       = "FIXED"
+	FILE_TYPE_DIF         = "DIF"
+	FILE_TYPE_EXCEL_BIFF  = "EXCEL_BIFF"
+	FILE_TYPE_EXCEL_OOXML = "EXCEL_OOXML"
+	FILE_TYPE_HTML        = "HTML"
+	FILE_TYPE_QVD         = "QVD"
+	FILE_TYPE_XML         = "XML"
+	FILE_TYPE_QVX         = "QVX"
+	FILE_TYPE_JSON        = "JSON"
+	FILE_TYPE_KML         = "KML"
+	FILE_TYPE_PARQUET     = "PARQUET"
+)
+
+// types of FolderItems
+const (
+	FOLDER_ITEM_FOLDER = "FOLDER"
+	FOLDER_ITEM_FILE   = "FILE"
+	FOLDER_ITEM_OTHER  = "OTHER"
+)
+
+// the lib:// path of a file of a folder connection, see FileTableScript
+const LIB_PREFIX = "lib://"
+
+type Database struct {
+	Name      string `json:"qName"`
+	IsDefault bool   `json:"qIsDefault"`
+}
+
+type DatabaseOwner struct {
+	Name string `json:"qName"`
+}
+
+// DataTable is a table of a database or file, Type being e.g. "TABLE" or "VIEW" for
+// databases.
+type DataTable struct {
+	Name string `json:"qName"`
+	Type string `json:"qType,omitempty"`
+}
+
+type DataField struct {
+	Name              string `json:"qName"`
+	IsKey             bool   `json:"qIsKey"`
+	OriginalFieldName string `json:"qOriginalFieldName,omitempty"`
+}
+
+// DataRecord is a row of a table preview, the first ones being the field names.
+type DataRecord struct {
+	Values []string `json:"qValues"`
+}
+
+type FolderItem struct {
+	Name string `json:"qName"`
+	Type string `json:"qType"`
+}
+
+type DelimiterInfo struct {
+	Name       string `json:"qName"`
+	ScriptCode string `json:"qScriptCode"`
+	Number     int    `json:"qNumber"`
+	IsMultiple bool   `json:"qIsMultiple"`
+}
+
+// FileDataFormat is how a file is read, as guessed by GuessFileType. Label is
+// "embedded labels" or "no labels", Quote "msq", "standard" or "none".
+type FileDataFormat struct {
+	Type                 string        `json:"qType"`
+	Label                string        `json:"qLabel"`
+	Quote                string        `json:"qQuote"`
+	Comment              string        `json:"qComment"`
+	Delimiter            DelimiterInfo `json:"qDelimiter"`
+	CodePage             int           `json:"qCodePage"`
+	HeaderSize           int           `json:"qHeaderSize"`
+	RecordSize           int           `json:"qRecordSize"`
+	TabSize              int           `json:"qTabSize"`
+	IgnoreEOF            bool          `json:"qIgnoreEOF"`
+	FixedWidthDelimiters string        `json:"qFixedWidthDelimiters"`
+}
+
+// GetDatabases lists the databases of an ODBC, OLEDB or custom connection.
+func (d *Doc) GetDatabases(connectionId string) ([]Database, error) {
+	var result struct {
+		Databases []Database `json:"qDatabases"`
+	}
+	err := d.call("GetDatabases", []interface{}{connectionId}, &result)
+	return result.Databases, err
+}
+
+// GetDatabaseOwners lists the owners (schemas) of a database, the connection's default
+// database if database is empty.
+func (d *Doc) GetDatabaseOwners(connectionId, database string) ([]DatabaseOwner, error) {
+	var result struct {
+		Owners []DatabaseOwner `json:"qOwners"`
+	}
+	err := d.call("GetDatabaseOwners", []interface{}{connectionId, database}, &result)
+	return result.Owners, err
+}
+
+// GetDatabaseTables lists the tables and views of a database, database and owner being
+// optional for databases without them.
+func (d *Doc) GetDatabaseTables(connectionId, database, owner string) ([]DataTable, error) {
+	var result struct {
+		Tables []DataTable `json:"qTables"`
+	}
+	err := d.call("GetDatabaseTables", []interface{}{connectionId, database, owner}, &result)
+	return result.Tables, err
+}
+
+func (d *Doc) GetDatabaseTableFields(connectionId, database, owner, table string) ([]DataField, error) {
+	var result struct {
+		Fields []DataField `json:"qFields"`
+	}
+	err := d.call("GetDatabaseTableFields", []interface{}{connectionId, database, owner, table}, &result)
+	return result.Fields, err
+}
+
+// GetDatabaseTablePreview returns the first rows of a table.
+func (d *Doc) GetDatabaseTablePreview(connectionId, database, owner, table string) ([]DataRecord, error) {
+	var result struct {
+		Preview []DataRecord `json:"qPreview"`
+	}
+	err := d.call("GetDatabaseTablePreview", []interface{}{connectionId, database, owner, table}, &result)
+	return result.Preview, err
+}
+
+// GetFolderItemsForConnection lists the files and folders at relativePath of a folder
+// connection, its root if relativePath is empty.
+func (d *Doc) GetFolderItemsForConnection(connectionId, relativePath string) ([]FolderItem, error) {
+	var result struct {
+		FolderItems []FolderItem `json:"qFolderItems"`
+	}
+	err := d.call("GetFolderItemsForConnection", []interface{}{connectionId, relativePath}, &result)
+	return result.FolderItems, err
+}
+
+func (d *Doc) GuessFileType(connectionId, relativePath string) (FileDataFormat, error) {
+	var result struct {
+		DataFormat FileDataFormat `json:"qDataFormat"`
+	}
+	err := d.call("GuessFileType", []interface{}{connectionId, relativePath}, &result)
+	return result.DataFormat, err
+}
+
+// GetFileTables lists the tables of a file, e.g. the sheets of an Excel file.
+func (d *Doc) GetFileTables(connectionId, relativePath string, format FileDataFormat) ([]DataTable, error) {
+	var result struct {
+		Tables []DataTable `json:"qTables"`
+	}
+	err := d.call("GetFileTables", []interface{}{connectionId, relativePath, format}, &result)
+	return result.Tables, err
+}
+
+// GetFileTableFields returns the fields of a table of a file, with the format
+// specification loading it, e.g. "(txt, utf8, embedded labels, delimiter is ',', msq)".
+func (d *Doc) GetFileTableFields(connectionId, relativePath string, format FileDataFormat, table string) ([]DataField, string, error) {
+	var result struct {
+		Fields     []DataField `json:"qFields"`
+		FormatSpec string      `json:"qFormatSpec"`
+	}
+	err := d.call("GetFileTableFields", []interface{}{connectionId, relativePath, format, table}, &result)
+	return result.Fields, result.FormatSpec, err
+}
+
+// GetFileTablePreview returns the first rows of a table of a file, with the format
+// specification loading it.
+func (d *Doc) GetFileTablePreview(connectionId, relativePath string, format FileDataFormat, table string) ([]DataRecord, string, error) {
+	var result struct {
+		Preview    []DataRecord `json:"qPreview"`
+		FormatSpec string       `json:"qFormatSpec"`
+	}
+	err := d.call("GetFileTablePreview", []interface{}{connectionId, relativePath, format, table}, &result)
+	return result.Preview, result.FormatSpec, err
+}
+
+// SQLSelect writes a SQL SELECT of the fields of a table, all fields (*) if there are
+// none. database and owner qualify the table name when set.
+func SQLSelect(database, owner, table string, fields ...string) string {
+	columns := " *"
+	if len(fields) > 0 {
+		quoted := []string{}
+		for _, field := range fields {
+			quoted = append(quoted, quoteIdentifier(field))
+		}
+		columns = SCRIPT_NEWLINE + "\t" + strings.Join(quoted, ","+SCRIPT_NEWLINE+"\t")
+	}
+	from := []string{}
+	for _, name := range []string{database, owner} {
+		if len(name) > 0 {
+			from = append(from, quoteIdentifier(name))
+		}
+	}
+	from = append(from, quoteIdentifier(table))
+	return "SQL SELECT" + columns + SCRIPT_NEWLINE + "FROM " + strings.Join(from, ".") + ";"
+}
+
+// quoteIdentifier double quotes a database name, as the data load editor does.
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// DatabaseTableScript generates the statements loading fields of a database table, all
+// if fields is empty, as picked from GetDatabaseTables and GetDatabaseTableFields:
+//
+//	LIB CONNECT TO 'Sales DB';
+//
+//	Orders:
+//	LOAD
+//		OrderId,
+//		Amount;
+//	SQL SELECT
+//		"OrderId",
+//		"Amount"
+//	FROM "Sales"."dbo"."Orders";
+//
+// It returns an error for fields the table does not have.
+func (d *Doc) DatabaseTableScript(connectionId, database, owner, table string, fields []string) (*ScriptBuilder, error) {
+	connection, err := d.GetConnection(connectionId)
+	if err != nil {
+		return nil, err
+	}
+	tableFields, err := d.GetDatabaseTableFields(connectionId, database, owner, table)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTableFields(table, tableFields, fields)
+	if err != nil {
+		return nil, err
+	}
+	load := Load(loadFields(fields)...).Label(table)
+	return NewScriptBuilder().LibConnect(connection.Name).Statement(load.String() + SCRIPT_NEWLINE + SQLSelect(database, owner, table, fields...)), nil
+}
+
+// FileTableScript generates the LOAD of fields of a table of a file of a folder
+// connection, all if fields is empty, reading the file as GuessFileType tells:
+//
+//	sales:
+//	LOAD
+//		OrderId,
+//		Amount
+//	FROM [lib://Data/sales.csv]
+//	(txt, utf8, embedded labels, delimiter is ',', msq);
+//
+// It returns an error for fields the table does not have.
+func (d *Doc) FileTableScript(connectionId, relativePath, table string, fields []string) (*ScriptBuilder, error) {
+	connection, err := d.GetConnection(connectionId)
+	if err != nil {
+		return nil, err
+	}
+	format, err := d.GuessFileType(connectionId, relativePath)
+	if err != nil {
+		return nil, err
+	}
+	tableFields, formatSpec, err := d.GetFileTableFields(connectionId, relativePath, format, table)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTableFields(table, tableFields, fields)
+	if err != nil {
+		return nil, err
+	}
+	path := LIB_PREFIX + connection.Name + "/" + strings.TrimLeft(strings.Replace(relativePath, "\\", "/", -1), "/")
+	formatSpec = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(formatSpec), "("), ")")
+	load := Load(loadFields(fields)...).Label(table).From(path, formatSpec)
+	return NewScriptBuilder().Load(load), nil
+}
+
+func loadFields(fields []string) []ScriptField {
+	retval := []ScriptField{}
+	for _, field := range fields {
+		retval = append(retval, LoadField(field))
+	}
+	return retval
+}
+
+func checkTableFields(table string, tableFields []DataField, fields []string) error {
+	names := map[string]bool{}
+	for _, field := range tableFields {
+		names[field.Name] = true
+	}
+	for _, field := range fields {
+		if !names[field] {
+			return fmt.Errorf("error loading table [%s]:it has no field [%s]", table, field)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"strings"
+	"testing"
+)
+
+// serveDataSources scripts a Sales database with a dbo.Orders table, and a folder
+// holding sales.csv in a sub folder.
+func serveDataSources(server *enginetest.Server) {
+	server.Handle("Doc.GetDatabases", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qDatabases": []glik.Database{{Name: "Sales", IsDefault: true}, {Name: "master"}}}, nil
+	})
+	server.Handle("Doc.GetDatabaseOwners", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qOwners": []glik.DatabaseOwner{{Name: "dbo"}}}, nil
+	})
+	server.Handle("Doc.GetDatabaseTables", func(call *enginetest.Call) (interface{}, error) {
+		var owner string
+		if err := call.Arg(2, "qOwner", &owner); err != nil {
+			return nil, err
+		}
+		tables := []glik.DataTable{}
+		if owner == "dbo" {
+			tables = append(tables, glik.DataTable{Name: "Orders", Type: "TABLE"}, glik.DataTable{Name: "Open Orders", Type: "VIEW"})
+		}
+		return map[string]interface{}{"qTables": tables}, nil
+	})
+	server.Handle("Doc.GetDatabaseTableFields", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qFields": []glik.DataField{{Name: "OrderId", IsKey: true}, {Name: "Amount"}, {Name: "Order Date"}}}, nil
+	})
+	server.Handle("Doc.GetDatabaseTablePreview", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qPreview": []glik.DataRecord{{Values: []string{"OrderId", "Amount", "Order Date"}}, {Values: []string{"1", "10.5", "2016-01-02"}}}}, nil
+	})
+	server.Handle("Doc.GetFolderItemsForConnection", func(call *enginetest.Call) (interface{}, error) {
+		var path string
+		if err := call.Arg(1, "qRelativePath", &path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return map[string]interface{}{"qFolderItems": []glik.FolderItem{{Name: "sub", Type: glik.FOLDER_ITEM_FOLDER}, {Name: "readme.txt", Type: glik.FOLDER_ITEM_FILE}}}, nil
+		}
+		return map[string]interface{}{"qFolderItems": []glik.FolderItem{{Name: "sales.csv", Type: glik.FOLDER_ITEM_FILE}}}, nil
+	})
+	server.Handle("Doc.GuessFileType", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qDataFormat": glik.FileDataFormat{Type: glik.FILE_TYPE_CSV, Label: "embedded labels", Quote: "msq", Delimiter: glik.DelimiterInfo{Name: "Comma", ScriptCode: "','"}}}, nil
+	})
+	server.Handle("Doc.GetFileTables", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qTables": []glik.DataTable{{Name: "sales"}}}, nil
+	})
+	fileFields := func(call *enginetest.Call) (interface{}, error) {
+		var format glik.FileDataFormat
+		if err := call.Arg(2, "qDataFormat", &format); err != nil {
+			return nil, err
+		}
+		if format.Type != glik.FILE_TYPE_CSV {
+			return nil, &enginetest.Error{Code: enginetest.LOCERR_GENERIC_INVALID_PARAMETERS, Message: "Unknown format"}
+		}
+		return map[string]interface{}{
+			"qFields":     []glik.DataField{{Name: "OrderId"}, {Name: "Amount"}},
+			"qPreview":    []glik.DataRecord{{Values: []string{"OrderId", "Amount"}}, {Values: []string{"1", "10.5"}}},
+			"qFormatSpec": "(txt, utf8, embedded labels, delimiter is ',', msq)",
+		}, nil
+	}
+	server.Handle("Doc.GetFileTableFields", fileFields)
+	server.Handle("Doc.GetFileTablePreview", fileFields)
+}
+
+func TestBrowseDatabase(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	serveDataSources(server)
+	id := server.AddConnection(glik.NewODBCConnection("Sales DB", "dsn", "", ""))
+	doc := openTestDoc(t, server, "Sales.qvf")
+	if databases, err := doc.GetDatabases(id); err != nil || len(databases) != 2 || !databases[0].IsDefault {
+		t.Errorf("got %+v, %v", databases, err)
+	}
+	if owners, err := doc.GetDatabaseOwners(id, "Sales"); err != nil || len(owners) != 1 || owners[0].Name != "dbo" {
+		t.Errorf("got %+v, %v", owners, err)
+	}
+	if tables, err := doc.GetDatabaseTables(id, "Sales", "dbo"); err != nil || len(tables) != 2 || tables[1].Type != "VIEW" {
+		t.Errorf("got %+v, %v", tables, err)
+	}
+	if fields, err := doc.GetDatabaseTableFields(id, "Sales", "dbo", "Orders"); err != nil || len(fields) != 3 || !fields[0].IsKey {
+		t.Errorf("got %+v, %v", fields, err)
+	}
+	if preview, err := doc.GetDatabaseTablePreview(id, "Sales", "dbo", "Orders"); err != nil || len(preview) != 2 || preview[1].Values[1] != "10.5" {
+		t.Errorf("got %+v, %v", preview, err)
+	}
+	for _, request := range server.Requests() {
+		if request.Method == "GetDatabaseTables" && string(request.Params) != `["`+id+`","Sales","dbo"]` {
+			t.Errorf("got %s", request.Params)
+		}
+	}
+}
+
+func TestBrowseFolder(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	serveDataSources(server)
+	id := server.AddConnection(glik.NewFolderConnection("Data", `C:\data`))
+	doc := openTestDoc(t, server, "Sales.qvf")
+	items, err := doc.GetFolderItemsForConnection(id, "")
+	if err != nil || len(items) != 2 || items[0].Type != glik.FOLDER_ITEM_FOLDER {
+		t.Fatalf("got %+v, %v", items, err)
+	}
+	if items, err := doc.GetFolderItemsForConnection(id, "sub"); err != nil || len(items) != 1 || items[0].Name != "sales.csv" {
+		t.Errorf("got %+v, %v", items, err)
+	}
+	format, err := doc.GuessFileType(id, "sub/sales.csv")
+	if err != nil || format.Type != glik.FILE_TYPE_CSV || format.Delimiter.ScriptCode != "','" {
+		t.Fatalf("got %+v, %v", format, err)
+	}
+	if tables, err := doc.GetFileTables(id, "sub/sales.csv", format); err != nil || len(tables) != 1 {
+		t.Errorf("got %+v, %v", tables, err)
+	}
+	fields, spec, err := doc.GetFileTableFields(id, "sub/sales.csv", format, "sales")
+	if err != nil || len(fields) != 2 || spec != "(txt, utf8, embedded labels, delimiter is ',', msq)" {
+		t.Errorf("got %+v, %q, %v", fields, spec, err)
+	}
+	if preview, _, err := doc.GetFileTablePreview(id, "sub/sales.csv", format, "sales"); err != nil || len(preview) != 2 {
+		t.Errorf("got %+v, %v", preview, err)
+	}
+	if _, _, err := doc.GetFileTableFields(id, "sub/sales.csv", glik.FileDataFormat{Type: glik.FILE_TYPE_QVD}, "sales"); err == nil {
+		t.Error("expected an error for the wrong format")
+	}
+}
+
+func TestSQLSelect(t *testing.T) {
+	tests := []struct {
+		database, owner, table string
+		fields                 []string
+		want                   string
+	}{
+		{"", "", "Orders", nil, `SQL SELECT *` + "\r\n" + `FROM "Orders";`},
+		{"Sales", "dbo", "Orders", []string{"OrderId", "Order Date"}, "SQL SELECT\r\n\t\"OrderId\",\r\n\t\"Order Date\"\r\nFROM \"Sales\".\"dbo\".\"Orders\";"},
+		{"", "dbo", `Say "hi"`, nil, "SQL SELECT *\r\nFROM \"dbo\".\"Say \"\"hi\"\"\";"},
+	}
+	for _, test := range tests {
+		if got := glik.SQLSelect(test.database, test.owner, test.table, test.fields...); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestDatabaseTableScript(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	serveDataSources(server)
+	id := server.AddConnection(glik.NewODBCConnection("Sales DB", "dsn", "", ""))
+	doc := openTestDoc(t, server, "Sales.qvf")
+	script, err := doc.DatabaseTableScript(id, "Sales", "dbo", "Orders", []string{"OrderId", "Order Date"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "LIB CONNECT TO 'Sales DB';\r\n\r\nOrders:\r\nLOAD\r\n\tOrderId,\r\n\t[Order Date];\r\nSQL SELECT\r\n\t\"OrderId\",\r\n\t\"Order Date\"\r\nFROM \"Sales\".\"dbo\".\"Orders\";\r\n"
+	if script.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", script, want)
+	}
+	if _, err := doc.DatabaseTableScript(id, "", "", "Orders", []string{"Missing"}); err == nil || !strings.Contains(err.Error(), "[Missing]") {
+		t.Errorf("got %v", err)
+	}
+	if _, err := doc.DatabaseTableScript("missing", "", "", "Orders", nil); err == nil {
+		t.Error("expected an error for a missing connection")
+	}
+}
+
+func TestFileTableScript(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	serveDataSources(server)
+	id := server.AddConnection(glik.NewFolderConnection("Data", `C:\data`))
+	doc := openTestDoc(t, server, "Sales.qvf")
+	script, err := doc.FileTableScript(id, `\sub\sales.csv`, "sales", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "sales:\r\nLOAD *\r\nFROM [lib://Data/sub/sales.csv]\r\n(txt, utf8, embedded labels, delimiter is ',', msq);\r\n"
+	if script.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", script, want)
+	}
+	script, err = doc.FileTableScript(id, "sub/sales.csv", "sales", []string{"Amount"})
+	if err != nil || !strings.Contains(script.String(), "LOAD\r\n\tAmount\r\nFROM") {
+		t.Errorf("got %v, %v", script, err)
+	}
+	if _, err := doc.FileTableScript(id, "sub/sales.csv", "sales", []string{"Region"}); err == nil {
+		t.Error("expected an error for a field the file does not have")
+	}
+}
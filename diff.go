@@ -0,0 +1,414 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DIFF_ADDED   = "added"
+	DIFF_REMOVED = "removed"
+	DIFF_CHANGED = "changed"
+)
+
+// the Kind of AppChanges of load script sections
+const SCRIPT_SECTION_TYPE = "script section"
+
+// values longer than this are cut short in the text of a diff
+const MAX_DIFF_VALUE = 80
+
+// PropertyChange is a property that differs, Path being its JSON pointer, e.g.
+// "/qMeasure/qDef". Objects of a sheet are at "/qChildren/<id>" rather than at their
+// index. Old is nil for added properties and New for removed ones.
+type PropertyChange struct {
+	Action string
+	Path   string
+	Old    interface{}
+	New    interface{}
+}
+
+func (c PropertyChange) String() string {
+	switch c.Action {
+	case DIFF_ADDED:
+		return fmt.Sprintf("+ %s: %s", c.Path, diffValue(c.New))
+	case DIFF_REMOVED:
+		return fmt.Sprintf("- %s: %s", c.Path, diffValue(c.Old))
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, diffValue(c.Old), diffValue(c.New))
+}
+
+// AppChange is an item added to, removed from or changed in the second app. Changed
+// items list their Properties, or for script sections the Lines removed, starting with
+// "-", and added, starting with "+".
+type AppChange struct {
+	Action     string
+	Kind       string
+	Id         string
+	Title      string
+	Properties []PropertyChange
+	Lines      []string
+}
+
+func (c AppChange) String() string {
+	retval := fmt.Sprintf("%s %s %s", c.Action, c.Kind, c.Id)
+	if len(c.Title) > 0 && c.Title != c.Id {
+		retval += " (" + c.Title + ")"
+	}
+	for _, property := range c.Properties {
+		retval += "\n    " + property.String()
+	}
+	for _, line := range c.Lines {
+		retval += "\n    " + line
+	}
+	return retval
+}
+
+type AppDiff struct {
+	Changes []AppChange
+}
+
+func (d AppDiff) String() string {
+	if len(d.Changes) == 0 {
+		return "no changes"
+	}
+	lines := []string{}
+	for _, change := range d.Changes {
+		lines = append(lines, change.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DiffApps compares the load script sections, variables, master items, master objects,
+// sheets with their objects and bookmarks of two apps, reporting what changes from a
+// to b. Items are matched by id, variables by name and script sections by tab name.
+func DiffApps(a, b *Doc) (AppDiff, error) {
+	var diff AppDiff
+	before, err := takeSnapshot(a)
+	if err != nil {
+		return diff, err
+	}
+	after, err := takeSnapshot(b)
+	if err != nil {
+		return diff, err
+	}
+	diff.Changes = append(diff.Changes, diffScripts(before.script, after.script)...)
+	variables, err := diffVariables(before.variables, after.variables)
+	if err != nil {
+		return diff, err
+	}
+	diff.Changes = append(diff.Changes, variables...)
+	for _, sub := range appDirs {
+		diff.Changes = append(diff.Changes, diffItems(sub.kind, before.items[sub.kind], after.items[sub.kind])...)
+	}
+	return diff, nil
+}
+
+func diffScripts(before, after string) []AppChange {
+	retval := []AppChange{}
+	beforeScript, afterScript := ParseScript(before), ParseScript(after)
+	for _, section := range beforeScript.Sections {
+		if afterScript.Index(section.Name) < 0 {
+			retval = append(retval, AppChange{Action: DIFF_REMOVED, Kind: SCRIPT_SECTION_TYPE, Id: section.Name})
+		}
+	}
+	for _, section := range afterScript.Sections {
+		body, ok := beforeScript.Section(section.Name)
+		if !ok {
+			retval = append(retval, AppChange{Action: DIFF_ADDED, Kind: SCRIPT_SECTION_TYPE, Id: section.Name})
+			continue
+		}
+		changed := diffLines(strings.Split(body, SCRIPT_NEWLINE), strings.Split(section.Body, SCRIPT_NEWLINE))
+		if len(changed) > 0 {
+			retval = append(retval, AppChange{Action: DIFF_CHANGED, Kind: SCRIPT_SECTION_TYPE, Id: section.Name, Lines: changed})
+		}
+	}
+	return retval
+}
+
+// diffLines lists the lines removed from a and added to b, through their longest
+// common subsequence, the removals before the additions between common lines.
+func diffLines(a, b []string) []string {
+	retval := []string{}
+	i, j := 0, 0
+	for _, match := range commonLines(a, b, 0, 0) {
+		for ; i < match[0]; i++ {
+			retval = append(retval, "-"+a[i])
+		}
+		for ; j < match[1]; j++ {
+			retval = append(retval, "+"+b[j])
+		}
+		i, j = i+1, j+1
+	}
+	for ; i < len(a); i++ {
+		retval = append(retval, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		retval = append(retval, "+"+b[j])
+	}
+	return retval
+}
+
+// commonLines returns the index pairs of a longest common subsequence of a and b,
+// offset by aStart and bStart. Scripts run to thousands of lines, so rather than a
+// table of every pair of lines, a is split in half and b where the halves' common
+// subsequences are longest, keeping two rows of lengths (Hirschberg's algorithm).
+func commonLines(a, b []string, aStart, bStart int) [][2]int {
+	retval := [][2]int{}
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		retval = append(retval, [2]int{aStart, bStart})
+		a, b = a[1:], b[1:]
+		aStart, bStart = aStart+1, bStart+1
+	}
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+	switch {
+	case len(a) == 0 || len(b) == 0:
+	case len(a) == 1:
+		for j := range b {
+			if b[j] == a[0] {
+				retval = append(retval, [2]int{aStart, bStart + j})
+				break
+			}
+		}
+	default:
+		half := len(a) / 2
+		forward := commonLengths(a[:half], b, false)
+		backward := commonLengths(a[half:], b, true)
+		split, longest := 0, -1
+		for j := 0; j <= len(b); j++ {
+			if length := forward[j] + backward[len(b)-j]; length > longest {
+				split, longest = j, length
+			}
+		}
+		retval = append(retval, commonLines(a[:half], b[:split], aStart, bStart)...)
+		retval = append(retval, commonLines(a[half:], b[split:], aStart+half, bStart+split)...)
+	}
+	for k := 0; k < suffix; k++ {
+		retval = append(retval, [2]int{aStart + len(a) + k, bStart + len(b) + k})
+	}
+	return retval
+}
+
+// commonLengths returns the length of the longest common subsequence of a and each
+// prefix of b, or when reversed of a and each suffix of b, by the prefix's length.
+func commonLengths(a, b []string, reversed bool) []int {
+	previous, current := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		line := a[i]
+		if reversed {
+			line = a[len(a)-1-i]
+		}
+		for j := 1; j <= len(b); j++ {
+			other := b[j-1]
+			if reversed {
+				other = b[len(b)-j]
+			}
+			switch {
+			case line == other:
+				current[j] = previous[j-1] + 1
+			case previous[j] >= current[j-1]:
+				current[j] = previous[j]
+			default:
+				current[j] = current[j-1]
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous
+}
+
+// diffVariables matches variables by name, ignoring their ids.
+func diffVariables(before, after []GenericVariableProperties) ([]AppChange, error) {
+	byName := func(variables []GenericVariableProperties) (map[string]interface{}, error) {
+		retval := map[string]interface{}{}
+		for _, variable := range variables {
+			variable.Info = NxInfo{Type: variable.Info.Type}
+			tree, err := genericJSON(variable)
+			if err != nil {
+				return nil, err
+			}
+			retval[variable.Name] = tree
+		}
+		return retval, nil
+	}
+	beforeItems, err := byName(before)
+	if err != nil {
+		return nil, err
+	}
+	afterItems, err := byName(after)
+	if err != nil {
+		return nil, err
+	}
+	return diffItems(VARIABLE_TYPE, beforeItems, afterItems), nil
+}
+
+func diffItems(kind string, before, after map[string]interface{}) []AppChange {
+	ids := []string{}
+	for id := range before {
+		ids = append(ids, id)
+	}
+	for id := range after {
+		if _, ok := before[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	retval := []AppChange{}
+	for _, id := range ids {
+		a, inBefore := before[id]
+		b, inAfter := after[id]
+		switch {
+		case !inAfter:
+			retval = append(retval, AppChange{Action: DIFF_REMOVED, Kind: kind, Id: id, Title: itemTitle(a)})
+		case !inBefore:
+			retval = append(retval, AppChange{Action: DIFF_ADDED, Kind: kind, Id: id, Title: itemTitle(b)})
+		default:
+			properties := []PropertyChange{}
+			diffJSON("", objectTree(a), objectTree(b), &properties)
+			if len(properties) > 0 {
+				retval = append(retval, AppChange{Action: DIFF_CHANGED, Kind: kind, Id: id, Title: itemTitle(b), Properties: properties})
+			}
+		}
+	}
+	return retval
+}
+
+// objectTree turns a full property tree into the object's properties, with its
+// children in qChildren keyed by id so they diff by id. Other values are left alone.
+func objectTree(value interface{}) interface{} {
+	entry, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	properties, ok := entry["qProperty"].(map[string]interface{})
+	if !ok {
+		return value
+	}
+	retval := map[string]interface{}{}
+	for key, property := range properties {
+		retval[key] = property
+	}
+	children, _ := entry["qChildren"].([]interface{})
+	if len(children) > 0 {
+		byId := map[string]interface{}{}
+		for i, child := range children {
+			child := objectTree(child)
+			id := strconv.Itoa(i)
+			if properties, ok := child.(map[string]interface{}); ok {
+				if info, ok := properties["qInfo"].(map[string]interface{}); ok {
+					if childId, ok := info["qId"].(string); ok && len(childId) > 0 {
+						id = childId
+					}
+				}
+			}
+			byId[id] = child
+		}
+		retval["qChildren"] = byId
+	}
+	return retval
+}
+
+func diffJSON(path string, a, b interface{}, changes *[]PropertyChange) {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := []string{}
+		for key := range a {
+			keys = append(keys, key)
+		}
+		for key := range b {
+			if _, ok := a[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := path + "/" + strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+			valueA, inA := a[key]
+			valueB, inB := b[key]
+			switch {
+			case !inB:
+				*changes = append(*changes, PropertyChange{Action: DIFF_REMOVED, Path: child, Old: valueA})
+			case !inA:
+				*changes = append(*changes, PropertyChange{Action: DIFF_ADDED, Path: child, New: valueB})
+			default:
+				diffJSON(child, valueA, valueB, changes)
+			}
+		}
+		return
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(a) || i < len(b); i++ {
+			child := path + "/" + strconv.Itoa(i)
+			switch {
+			case i >= len(b):
+				*changes = append(*changes, PropertyChange{Action: DIFF_REMOVED, Path: child, Old: a[i]})
+			case i >= len(a):
+				*changes = append(*changes, PropertyChange{Action: DIFF_ADDED, Path: child, New: b[i]})
+			default:
+				diffJSON(child, a[i], b[i], changes)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		if len(path) == 0 {
+			path = "/"
+		}
+		*changes = append(*changes, PropertyChange{Action: DIFF_CHANGED, Path: path, Old: a, New: b})
+	}
+}
+
+// itemTitle finds the title in properties, property trees and bookmark files.
+func itemTitle(value interface{}) string {
+	properties, ok := objectTree(value).(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if bookmark, ok := properties["qProp"].(map[string]interface{}); ok {
+		properties = bookmark
+	}
+	if meta, ok := properties["qMetaDef"].(map[string]interface{}); ok {
+		if title, ok := meta["title"].(string); ok && len(title) > 0 {
+			return title
+		}
+	}
+	title, _ := properties["title"].(string)
+	return title
+}
+
+func diffValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	retval := []rune(string(data))
+	if len(retval) > MAX_DIFF_VALUE {
+		return string(retval[:MAX_DIFF_VALUE-3]) + "..."
+	}
+	return string(retval)
+}
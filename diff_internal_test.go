@@ -0,0 +1,52 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"a b c", "a b c", ""},
+		{"a b c", "a c", "-b"},
+		{"a c", "a b c", "+b"},
+		{"a b c", "a x c", "-b +x"},
+		{"", "a", "+a"},
+		{"a", "", "-a"},
+		{"a b c d", "b c e", "-a -d +e"},
+		{"a b c d e", "x b d y", "-a +x -c -e +y"},
+	}
+	for _, test := range tests {
+		got := diffLines(strings.Fields(test.a), strings.Fields(test.b))
+		if strings.Join(got, " ") != test.want {
+			t.Errorf("%q to %q: got %q, want %q", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestDiffJSONChildrenById(t *testing.T) {
+	entry := func(children ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"qProperty": map[string]interface{}{"qInfo": map[string]interface{}{"qId": "sheet"}}, "qChildren": children}
+	}
+	child := func(id, title string) map[string]interface{} {
+		return map[string]interface{}{"qProperty": map[string]interface{}{"qInfo": map[string]interface{}{"qId": id}, "title": title}}
+	}
+	changes := []PropertyChange{}
+	diffJSON("", objectTree(entry(child("a", "A"), child("b", "B"))), objectTree(entry(child("b", "B2"))), &changes)
+	if len(changes) != 2 || changes[0].String() != `- /qChildren/a: {"qInfo":{"qId":"a"},"title":"A"}` || changes[1].String() != `~ /qChildren/b/title: "B" -> "B2"` {
+		t.Errorf("got %v", changes)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"testing"
+)
+
+func TestDiffApps(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("A.qvf", "///$tab Main\r\nSET a=1;\r\nLOAD 1 as x AutoGenerate 1;\r\n///$tab Old\r\nx;")
+	server.AddDoc("B.qvf", "///$tab Main\r\nSET a=2;\r\nLOAD 1 as x AutoGenerate 1;\r\n///$tab New\r\ny;")
+	a, b := openTestDoc(t, server, "A.qvf"), openTestDoc(t, server, "B.qvf")
+	for i, doc := range []*glik.Doc{a, b} {
+		if _, err := doc.CreateMeasure(glik.NewMeasureProperties("kpi-revenue", "Revenue", []string{"Sum(Sales)", "Sum(Net)"}[i])); err != nil {
+			t.Fatal(err)
+		}
+		sheet := doc.NewSheet("landing", "Overview").Add(glik.KPI("Revenue", glik.MasterMeasure("kpi-revenue")), 0, 0, 6, 3)
+		if i == 1 {
+			sheet.Add(glik.FilterPane("", glik.FieldDimension("Region")), 0, 3, 6, 9)
+		}
+		if _, err := sheet.Create(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := b.CreateDimension(glik.NewDimensionProperties("dim-region", "Region", "Region")); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := glik.DiffApps(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string]glik.AppChange{}
+	for _, change := range diff.Changes {
+		kinds[change.Action+" "+change.Kind+" "+change.Id] = change
+	}
+	if len(diff.Changes) != 6 {
+		t.Errorf("got\n%s", diff)
+	}
+	for _, key := range []string{"removed script section Old", "added script section New", "added dimension dim-region"} {
+		if _, ok := kinds[key]; !ok {
+			t.Errorf("missing %q in\n%s", key, diff)
+		}
+	}
+	if main := kinds["changed script section Main"]; len(main.Lines) != 2 || main.Lines[0] != "-SET a=1;" || main.Lines[1] != "+SET a=2;" {
+		t.Errorf("got %+v", main)
+	}
+	measure := kinds["changed measure kpi-revenue"]
+	if measure.Title != "Revenue" || len(measure.Properties) != 1 || measure.Properties[0].String() != `~ /qMeasure/qDef: "Sum(Sales)" -> "Sum(Net)"` {
+		t.Errorf("got %+v", measure)
+	}
+	sheet := kinds["changed sheet landing"]
+	if sheet.Title != "Overview" || len(sheet.Properties) == 0 {
+		t.Errorf("got %+v", sheet)
+	}
+	if diff, err := glik.DiffApps(a, a); err != nil || diff.String() != "no changes" {
+		t.Errorf("got %v, %v", diff, err)
+	}
+}
+
+func TestPropertyChangeString(t *testing.T) {
+	long := make([]rune, 100)
+	for i := range long {
+		long[i] = 'é'
+	}
+	for _, test := range []struct {
+		change glik.PropertyChange
+		want   string
+	}{
+		{glik.PropertyChange{Action: glik.DIFF_ADDED, Path: "/qMetaDef/tags", New: []string{"kpi"}}, `+ /qMetaDef/tags: ["kpi"]`},
+		{glik.PropertyChange{Action: glik.DIFF_REMOVED, Path: "/title", Old: "Revenue"}, `- /title: "Revenue"`},
+		{glik.PropertyChange{Action: glik.DIFF_CHANGED, Path: "/rank", Old: 1, New: 2}, `~ /rank: 1 -> 2`},
+		{glik.PropertyChange{Action: glik.DIFF_ADDED, Path: "/a", New: string(long)}, `+ /a: "` + string(long[:glik.MAX_DIFF_VALUE-4]) + "..."},
+	} {
+		if got := test.change.String(); got != test.want {
+			t.Errorf("got %s, want %s", got, test.want)
+		}
+	}
+}
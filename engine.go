@@ -0,0 +1,330 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"sync"
+	"time"
+)
+
+const GLOBAL_HANDLE = -1
+
+var ErrWebsocketClosed = errors.New("websocket is not open")
+
+// engineRpc multiplexes JSON-RPC calls over the Engine connection. Every request gets
+// its own id and a reader delivers responses by id, so long running calls such as
+// DoReload can be in flight while GetProgress is polled. Notifications are dropped.
+type engineRpc struct {
+	conn    EngineConn
+	mu      sync.Mutex
+	writeMu sync.Mutex
+	nextId  int
+	pending map[int]chan []byte
+	err     error
+}
+
+type rpcMessage struct {
+	Id     *int            `json:"id"`
+	Method string          `json:"method,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *WebsocketError `json:"error,omitempty"`
+}
+
+func newEngineRpc(conn EngineConn) *engineRpc {
+	rpc := &engineRpc{conn: conn, pending: make(map[int]chan []byte)}
+	go rpc.read()
+	return rpc
+}
+
+func (rpc *engineRpc) read() {
+	for {
+		_, data, err := rpc.conn.ReadMessage()
+		if err != nil {
+			rpc.mu.Lock()
+			rpc.err = err
+			for id, ch := range rpc.pending {
+				close(ch)
+				delete(rpc.pending, id)
+			}
+			rpc.mu.Unlock()
+			return
+		}
+		if debug {
+			fmt.Printf("Websocket response:%v\n", string(data))
+		}
+		var message rpcMessage
+		if json.Unmarshal(data, &message) != nil || message.Id == nil {
+			continue
+		}
+		rpc.mu.Lock()
+		ch, ok := rpc.pending[*message.Id]
+		delete(rpc.pending, *message.Id)
+		rpc.mu.Unlock()
+		if ok {
+			ch <- data
+		}
+	}
+}
+
+// send writes the request with a fresh id, the raw response arrives on the returned channel,
+// which is closed without a value if the connection drops.
+func (rpc *engineRpc) send(request Request) (int, chan []byte, error) {
+	rpc.mu.Lock()
+	if rpc.err != nil {
+		rpc.mu.Unlock()
+		return 0, nil, rpc.err
+	}
+	rpc.nextId++
+	request.Id = rpc.nextId
+	ch := make(chan []byte, 1)
+	rpc.pending[request.Id] = ch
+	rpc.mu.Unlock()
+	data, err := json.Marshal(request)
+	if err == nil {
+		if debug {
+			fmt.Printf("Websocket request:%v\n", string(data))
+		}
+		rpc.writeMu.Lock()
+		err = rpc.conn.WriteMessage(websocket.TextMessage, data)
+		rpc.writeMu.Unlock()
+	}
+	if err != nil {
+		rpc.mu.Lock()
+		delete(rpc.pending, request.Id)
+		rpc.mu.Unlock()
+		return 0, nil, err
+	}
+	return request.Id, ch, nil
+}
+
+func (rpc *engineRpc) wait(ch chan []byte) ([]byte, error) {
+	data, ok := <-ch
+	if !ok {
+		return nil, rpc.failure()
+	}
+	return data, nil
+}
+
+// failure is the error that stopped the reader.
+func (rpc *engineRpc) failure() error {
+	rpc.mu.Lock()
+	defer rpc.mu.Unlock()
+	return rpc.err
+}
+
+// decodeResult unmarshals the result of a raw response into result, or returns its error.
+func decodeResult(data []byte, result interface{}) error {
+	var message rpcMessage
+	err := json.Unmarshal(data, &message)
+	if err != nil {
+		return err
+	}
+	if message.Error != nil {
+		return message.Error.GetError()
+	}
+	if result == nil || len(message.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(message.Result, result)
+}
+
+// rpcMu guards setting up the multiplexer, API is copied by value so it can't hold the lock.
+var rpcMu sync.Mutex
+
+func (api *API) engineRpc() (*engineRpc, error) {
+	rpcMu.Lock()
+	defer rpcMu.Unlock()
+	if api.rpc == nil {
+		conn := api.engineConnection()
+		if conn == nil {
+			return nil, ErrWebsocketClosed
+		}
+		api.rpc = newEngineRpc(conn)
+	}
+	return api.rpc, nil
+}
+
+// call invokes method on the handle and unmarshals the result into result.
+func (api *API) call(handle int, method string, params interface{}, result interface{}) error {
+	rpc, err := api.engineRpc()
+	if err != nil {
+		return err
+	}
+	if params == nil {
+		params = []interface{}{}
+	}
+	_, ch, err := rpc.send(Request{JsonRPCVersion: "2.0", Method: method, Handle: handle, Params: params})
+	if err != nil {
+		return err
+	}
+	data, err := rpc.wait(ch)
+	if err != nil {
+		return err
+	}
+	return decodeResult(data, result)
+}
+
+type returnResult struct {
+	Return Return `json:"qReturn"`
+}
+
+// callForHandle invokes a method returning a new handle in qReturn, e.g. OpenDoc or GetObject.
+func (api *API) callForHandle(handle int, method string, params interface{}) (Return, error) {
+	var result returnResult
+	err := api.call(handle, method, params, &result)
+	if err != nil {
+		return result.Return, err
+	}
+	if result.Return.Handle == 0 {
+		return result.Return, ErrDoesNotExist
+	}
+	return result.Return, nil
+}
+
+// Doc is an app opened on the Engine websocket, see the Doc class of the engine api.
+type Doc struct {
+	api    *API
+	Handle int
+	AppId  string
+}
+
+// OpenDoc opens the app on the Engine websocket, which must already be open.
+func (api *API) OpenDoc(appId string) (*Doc, error) {
+	handle, err := api.callForHandle(GLOBAL_HANDLE, "OpenDoc", []interface{}{appId})
+	if err != nil {
+		return nil, err
+	}
+	return &Doc{api: api, Handle: handle.Handle, AppId: appId}, nil
+}
+
+// ActiveDoc returns the app already opened on the websocket.
+func (api *API) ActiveDoc() (*Doc, error) {
+	handle, err := api.callForHandle(GLOBAL_HANDLE, "GetActiveDoc", nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Doc{api: api, Handle: handle.Handle}, nil
+}
+
+func (d *Doc) call(method string, params interface{}, result interface{}) error {
+	return d.api.call(d.Handle, method, params, result)
+}
+
+func (d *Doc) GetScript() (string, error) {
+	var result struct {
+		Script string `json:"qScript"`
+	}
+	err := d.call("GetScript", nil, &result)
+	return result.Script, err
+}
+
+func (d *Doc) SetScript(script string) error {
+	return d.call("SetScript", []interface{}{script}, nil)
+}
+
+// DoSave persists the app.
+func (d *Doc) DoSave() error {
+	return d.call("DoSave", nil, nil)
+}
+
+// Evaluate evaluates an expression in the app, e.g. "Sum(Sales)", as text.
+func (d *Doc) Evaluate(expression string) (string, error) {
+	var result struct {
+		Return string `json:"qReturn"`
+	}
+	err := d.call("Evaluate", []interface{}{expression}, &result)
+	return result.Return, err
+}
+
+const (
+	RELOAD_MODE_DEFAULT = 0
+	RELOAD_MODE_ABEND   = 1
+	RELOAD_MODE_IGNORE  = 2
+)
+
+// DoReload reloads the app, returning false if the script failed.
+func (d *Doc) DoReload(mode int, partial bool) (bool, error) {
+	var result struct {
+		Return bool `json:"qReturn"`
+	}
+	err := d.call("DoReload", []interface{}{mode, partial, false}, &result)
+	return result.Return, err
+}
+
+type ProgressMessage struct {
+	MessageCode       int      `json:"qMessageCode"`
+	MessageParameters []string `json:"qMessageParameters,omitempty"`
+}
+
+// ProgressData is the progress of a request as reported by Global.GetProgress.
+// PersistentProgress holds the script log lines produced since the previous call.
+type ProgressData struct {
+	Started                    bool              `json:"qStarted,omitempty"`
+	Finished                   bool              `json:"qFinished,omitempty"`
+	Completed                  int               `json:"qCompleted,omitempty"`
+	Total                      int               `json:"qTotal,omitempty"`
+	KB                         int               `json:"qKB,omitempty"`
+	Millisecs                  int               `json:"qMillisecs,omitempty"`
+	UserInteractionWanted      bool              `json:"qUserInteractionWanted,omitempty"`
+	PersistentProgress         string            `json:"qPersistentProgress,omitempty"`
+	TransientProgress          string            `json:"qTransientProgress,omitempty"`
+	PersistentProgressMessages []ProgressMessage `json:"qPersistentProgressMessages,omitempty"`
+	TransientProgressMessage   *ProgressMessage  `json:"qTransientProgressMessage,omitempty"`
+}
+
+// DoReloadWithProgress reloads the app like DoReload, calling progress with the reload's
+// GetProgress data every interval until it completes.
+func (d *Doc) DoReloadWithProgress(mode int, partial bool, interval time.Duration, progress func(ProgressData)) (bool, error) {
+	rpc, err := d.api.engineRpc()
+	if err != nil {
+		return false, err
+	}
+	id, ch, err := rpc.send(Request{JsonRPCVersion: "2.0", Method: "DoReload", Handle: d.Handle, Params: []interface{}{mode, partial, false}})
+	if err != nil {
+		return false, err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case data, ok := <-ch:
+			if !ok {
+				return false, rpc.failure()
+			}
+			// pick up the log lines written since the last poll
+			var last struct {
+				Progress ProgressData `json:"qProgressData"`
+			}
+			if d.api.call(GLOBAL_HANDLE, "GetProgress", []interface{}{id}, &last) == nil {
+				progress(last.Progress)
+			}
+			var result struct {
+				Return bool `json:"qReturn"`
+			}
+			err = decodeResult(data, &result)
+			return result.Return, err
+		case <-ticker.C:
+			var result struct {
+				Progress ProgressData `json:"qProgressData"`
+			}
+			err := d.api.call(GLOBAL_HANDLE, "GetProgress", []interface{}{id}, &result)
+			if err != nil {
+				return false, err
+			}
+			progress(result.Progress)
+		}
+	}
+}
@@ -71,7 +71,7 @@ func GetActiveDoc() Request {
 }
 
 func NewRequest(id int, method string, handle int, params interface{}) Request {
-	if params != nil {
+	if debug && params != nil {
 		fmt.Printf("NewRequest Params:%v\n", params)
 	}
 	return Request{JsonRPCVersion: "2.0", Id: id, Method: method, Handle: handle, Params: params}
@@ -121,14 +121,30 @@ type Result struct {
 }
 
 type Return struct {
-	Type   string `json:"qType,omitempty"`
-	Handle int    `json:"qHandle,omitempty"`
+	Type        string `json:"qType,omitempty"`
+	Handle      int    `json:"qHandle,omitempty"`
+	GenericType string `json:"qGenericType,omitempty"`
+	GenericId   string `json:"qGenericId,omitempty"`
 }
 
 func (e *WebsocketError) GetError() error {
-	return fmt.Errorf("Error [%v]: %s - %s", e.Code, e.Message, e.Parameter)
+	return e
 }
 
+func (e *WebsocketError) Error() string {
+	return fmt.Sprintf("Error [%v]: %s - %s", e.Code, e.Message, e.Parameter)
+}
+
+// Engine error codes, see LocalizedErrorCode in api_spec.json
+const (
+	LOCERR_GENERIC_NOT_FOUND          = 2
+	LOCERR_GENERIC_ALREADY_EXISTS     = 3
+	LOCERR_GENERIC_ACCESS_DENIED      = 5
+	LOCERR_GENERIC_INVALID_PARAMETERS = 8
+	LOCERR_APP_ALREADY_EXISTS         = 1000
+	LOCERR_APP_NOT_FOUND              = 1003
+)
+
 type EngineStream struct {
 	Id   string `json:"qId,omitempty"`
 	Name string `json:"qName,omitempty"`
@@ -158,7 +174,7 @@ type SheetParamsEx struct {
 
 func CreateSheetParamsEx(title, description, id string) SheetParamsEx {
 	params := SheetParamsEx{Title: title, Description: description}
-	params.Info = &Info{ID: "SH01", Type: "sheet"}
+	params.Info = &Info{ID: id, Type: "sheet"}
 	params.ChildListDef = &ChildListDef{}
 	params.ChildListDef.Data = &Data{Title: "/title",
 		Description: "/description",
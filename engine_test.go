@@ -0,0 +1,185 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// pipeConn is an EngineConn whose requests are answered by the test.
+type pipeConn struct {
+	requests  chan []byte
+	responses chan []byte
+	closed    chan struct{}
+	once      sync.Once
+}
+
+func newPipeConn() *pipeConn {
+	return &pipeConn{requests: make(chan []byte, 16), responses: make(chan []byte, 16), closed: make(chan struct{})}
+}
+
+func (p *pipeConn) WriteMessage(messageType int, data []byte) error {
+	p.requests <- data
+	return nil
+}
+
+func (p *pipeConn) ReadMessage() (int, []byte, error) {
+	select {
+	case data := <-p.responses:
+		return 1, data, nil
+	case <-p.closed:
+		return 0, nil, errors.New("connection closed")
+	}
+}
+
+func (p *pipeConn) Close() error {
+	p.once.Do(func() { close(p.closed) })
+	return nil
+}
+
+func (p *pipeConn) request(t *testing.T) rpcRequestFrame {
+	var request rpcRequestFrame
+	if err := json.Unmarshal(<-p.requests, &request); err != nil {
+		t.Fatal(err)
+	}
+	return request
+}
+
+type rpcRequestFrame struct {
+	Id     int             `json:"id"`
+	Method string          `json:"method"`
+	Handle int             `json:"handle"`
+	Params json.RawMessage `json:"params"`
+}
+
+func TestEngineRpcResponsesById(t *testing.T) {
+	conn := newPipeConn()
+	api := API{engine: conn}
+	results := make(chan string, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			var result struct {
+				Return string `json:"qReturn"`
+			}
+			if err := api.call(1, "Evaluate", nil, &result); err != nil {
+				results <- err.Error()
+				return
+			}
+			results <- result.Return
+		}()
+	}
+	first, second := conn.request(t), conn.request(t)
+	if first.Id == second.Id || first.Handle != 1 || first.Method != "Evaluate" || string(first.Params) != "[]" {
+		t.Fatalf("got requests %+v %+v", first, second)
+	}
+	// answer out of order, with a notification in between
+	conn.responses <- []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%v,"result":{"qReturn":"second"}}`, second.Id))
+	conn.responses <- []byte(`{"jsonrpc":"2.0","method":"OnConnected","params":{}}`)
+	conn.responses <- []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%v,"error":{"code":2,"parameter":"x","message":"Not found"}}`, first.Id))
+	got := map[string]bool{<-results: true, <-results: true}
+	if !got["second"] || !got["Error [2]: Not found - x"] {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestEngineRpcConnectionDrop(t *testing.T) {
+	conn := newPipeConn()
+	api := API{engine: conn}
+	done := make(chan error, 1)
+	go func() {
+		done <- api.call(1, "DoReload", nil, nil)
+	}()
+	conn.request(t)
+	conn.Close()
+	if err := <-done; err == nil || err.Error() != "connection closed" {
+		t.Errorf("got %v for a pending call", err)
+	}
+	if err := api.call(1, "DoSave", nil, nil); err == nil || err.Error() != "connection closed" {
+		t.Errorf("got %v after the drop", err)
+	}
+	var closed API
+	if err := closed.call(1, "DoSave", nil, nil); err != ErrWebsocketClosed {
+		t.Errorf("got %v without a connection", err)
+	}
+}
+
+func TestCallForHandle(t *testing.T) {
+	conn := newPipeConn()
+	api := API{engine: conn}
+	done := make(chan error, 1)
+	var handle Return
+	go func() {
+		var err error
+		handle, err = api.callForHandle(GLOBAL_HANDLE, "OpenDoc", []interface{}{"Sales.qvf"})
+		done <- err
+	}()
+	request := conn.request(t)
+	conn.responses <- []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%v,"result":{"qReturn":{"qType":"Doc","qHandle":1}}}`, request.Id))
+	if err := <-done; err != nil || handle.Handle != 1 || handle.Type != "Doc" {
+		t.Errorf("got %+v, %v", handle, err)
+	}
+	go func() {
+		_, err := api.callForHandle(1, "GetObject", []interface{}{"missing"})
+		done <- err
+	}()
+	request = conn.request(t)
+	conn.responses <- []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%v,"result":{"qReturn":{"qType":"GenericObject","qHandle":null}}}`, request.Id))
+	if err := <-done; err != ErrDoesNotExist {
+		t.Errorf("got %v for an empty handle", err)
+	}
+}
+
+func TestCloseWebSocket(t *testing.T) {
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	websocketPort, _ := strconv.Atoi(port)
+	api := NewAPI(host, DEFAULT_DIR, DEFAULT_USER, 0, 0, websocketPort)
+	if err := api.OpenWebSocket(); err != nil {
+		t.Fatal(err)
+	}
+	if api.WebsocketConnection == nil {
+		t.Fatal("expected the dialed connection to be set")
+	}
+	if err := api.CloseWebSocket(); err != nil {
+		t.Fatal(err)
+	}
+	// the closed connection is not picked up again by the next call
+	doc := &Doc{api: &api, Handle: 1}
+	if _, err := doc.GetScript(); err != ErrWebsocketClosed {
+		t.Errorf("got %v after closing", err)
+	}
+	if err := api.CloseWebSocket(); err != ErrWebsocketClosed {
+		t.Errorf("got %v closing twice", err)
+	}
+}
@@ -0,0 +1,688 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enginetest
+
+import (
+	"encoding/json"
+	"github.com/mattbaird/glik"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// builtins is the default behavior of the fake engine, keyed by "Type.Method".
+var builtins = map[string]HandlerFunc{
+	"Global.OpenDoc":                       openDoc,
+	"Global.CreateApp":                     createApp,
+	"Global.GetActiveDoc":                  getActiveDoc,
+	"Global.CreateSessionApp":              createSessionApp,
+	"Global.CreateSessionAppFromApp":       createSessionApp,
+	"Global.GetDocList":                    getDocList,
+	"Doc.GetScript":                        getScript,
+	"Doc.SetScript":                        setScript,
+	"Doc.DoReload":                         doReload,
+	"Doc.DoSave":                           doSave,
+	"Doc.CreateObject":                     createObject,
+	"Doc.CreateSessionObject":              createObject,
+	"Doc.GetObject":                        getObject,
+	"Doc.CreateDimension":                  createItem("GenericDimension"),
+	"Doc.GetDimension":                     getItem("GenericDimension"),
+	"Doc.DestroyDimension":                 destroyObject,
+	"Doc.CreateMeasure":                    createItem("GenericMeasure"),
+	"Doc.GetMeasure":                       getItem("GenericMeasure"),
+	"Doc.DestroyMeasure":                   destroyObject,
+	"Doc.CreateBookmark":                   createItem("GenericBookmark"),
+	"Doc.GetBookmark":                      getItem("GenericBookmark"),
+	"Doc.DestroyBookmark":                  destroyObject,
+	"Doc.DestroyObject":                    destroyObject,
+	"Doc.DestroySessionObject":             destroyObject,
+	"Doc.CreateVariableEx":                 createVariable,
+	"Doc.CreateSessionVariable":            createVariable,
+	"Doc.GetVariableByName":                getVariableByName,
+	"Doc.GetVariableById":                  getItem("GenericVariable"),
+	"Doc.DestroyVariableByName":            destroyVariableByName,
+	"Doc.DestroyVariableById":              destroyObject,
+	"Doc.DestroySessionVariable":           destroyObject,
+	"Doc.GetField":                         getField,
+	"Doc.EvaluateEx":                       evaluateEx,
+	"Doc.CheckExpression":                  checkExpression,
+	"Doc.CheckNumberOrExpression":          checkExpression,
+	"Doc.CreateConnection":                 createConnection,
+	"Doc.ModifyConnection":                 modifyConnection,
+	"Doc.DeleteConnection":                 deleteConnection,
+	"Doc.GetConnection":                    getConnection,
+	"Doc.GetConnections":                   getConnections,
+	"GenericObject.GetLayout":              getLayout,
+	"GenericObject.GetProperties":          getProperties,
+	"GenericObject.SetProperties":          setProperties,
+	"GenericObject.GetInfo":                getInfo,
+	"GenericObject.GetEffectiveProperties": getProperties,
+	"GenericObject.CreateChild":            createChild,
+	"GenericObject.GetChildInfos":          getChildInfos,
+	"GenericObject.GetFullPropertyTree":    getFullPropertyTree,
+	"GenericObject.SetFullPropertyTree":    setFullPropertyTree,
+	"GenericDimension.GetLayout":           getLayout,
+	"GenericDimension.GetProperties":       getProperties,
+	"GenericDimension.SetProperties":       setProperties,
+	"GenericMeasure.GetLayout":             getLayout,
+	"GenericMeasure.GetProperties":         getProperties,
+	"GenericMeasure.SetProperties":         setProperties,
+	"GenericBookmark.GetLayout":            getLayout,
+	"GenericBookmark.GetProperties":        getProperties,
+	"GenericBookmark.SetProperties":        setProperties,
+	"GenericVariable.GetLayout":            getVariableLayout,
+	"GenericVariable.GetProperties":        getProperties,
+	"GenericVariable.SetProperties":        setProperties,
+	"GenericVariable.SetStringValue":       setStringValue,
+	"GenericVariable.SetNumValue":          setNumValue,
+	"Field.Select":                         fieldSelection,
+	"Field.ToggleSelect":                   fieldSelection,
+	"Field.SelectValues":                   fieldSelection,
+	"Field.LowLevelSelect":                 fieldSelection,
+	"Field.SelectPossible":                 fieldSelection,
+	"Field.SelectAll":                      fieldSelection,
+	"Field.Clear":                          fieldSelection,
+	"Field.Lock":                           fieldSelection,
+	"Field.Unlock":                         fieldSelection,
+	"Field.SetNxProperties":                fieldSelection,
+}
+
+// list object definitions computed by GetLayout, with the property their items go to
+var lists = map[string]string{
+	"qAppObjectListDef": "qAppObjectList",
+	"qDimensionListDef": "qDimensionList",
+	"qMeasureListDef":   "qMeasureList",
+	"qBookmarkListDef":  "qBookmarkList",
+}
+
+func openDoc(call *Call) (interface{}, error) {
+	var name string
+	if err := call.Arg(0, "qDocName", &name); err != nil {
+		return nil, err
+	}
+	doc := call.Session.server.findDoc(name)
+	if doc == nil {
+		return nil, &Error{Code: LOCERR_APP_NOT_FOUND, Parameter: name, Message: "App not found"}
+	}
+	call.Session.doc = doc
+	return map[string]interface{}{"qReturn": call.Session.NewHandle("Doc", doc, nil)}, nil
+}
+
+func createApp(call *Call) (interface{}, error) {
+	var name string
+	if err := call.Arg(0, "qAppName", &name); err != nil {
+		return nil, err
+	}
+	section := "Main"
+	call.Arg(1, "qLocalizedScriptMainSection", &section)
+	doc := call.Session.server.addDoc(call.NewId("app-"), name, "///$tab "+section+"\r\n")
+	return map[string]interface{}{"qSuccess": true, "qAppId": doc.ID}, nil
+}
+
+// createSessionApp opens an app only the connection sees, copying the script and
+// objects of the source app for CreateSessionAppFromApp.
+func createSessionApp(call *Call) (interface{}, error) {
+	doc := &Doc{ID: call.NewId("SessionApp_"), Objects: make(map[string]*Object)}
+	doc.Name = doc.ID
+	if call.Method == "CreateSessionAppFromApp" {
+		var srcAppId string
+		if err := call.Arg(0, "qSrcAppId", &srcAppId); err != nil {
+			return nil, err
+		}
+		src := call.Session.server.findDoc(srcAppId)
+		if src == nil {
+			return nil, &Error{Code: LOCERR_APP_NOT_FOUND, Parameter: srcAppId, Message: "App not found"}
+		}
+		doc.Script = src.Script
+		for id, object := range src.Objects {
+			copied := *object
+			copied.Properties = copyProperties(object.Properties)
+			doc.Objects[id] = &copied
+		}
+	}
+	call.Session.doc = doc
+	return map[string]interface{}{"qSessionAppId": doc.ID, "qReturn": call.Session.NewHandle("Doc", doc, nil)}, nil
+}
+
+func getActiveDoc(call *Call) (interface{}, error) {
+	doc := call.Session.Doc()
+	if doc == nil {
+		return nil, &Error{Code: LOCERR_APP_NOT_FOUND, Message: "No active document"}
+	}
+	return map[string]interface{}{"qReturn": call.Session.NewHandle("Doc", doc, nil)}, nil
+}
+
+func getDocList(call *Call) (interface{}, error) {
+	docList := []map[string]interface{}{}
+	for _, doc := range call.Session.server.docs {
+		docList = append(docList, map[string]interface{}{"qDocName": doc.Name, "qDocId": doc.ID})
+	}
+	return map[string]interface{}{"qDocList": docList}, nil
+}
+
+func getScript(call *Call) (interface{}, error) {
+	return map[string]interface{}{"qScript": call.Doc().Script}, nil
+}
+
+func setScript(call *Call) (interface{}, error) {
+	var script string
+	if err := call.Arg(0, "qScript", &script); err != nil {
+		return nil, err
+	}
+	call.Doc().Script = script
+	return nil, nil
+}
+
+func doReload(call *Call) (interface{}, error) {
+	return map[string]interface{}{"qReturn": true}, nil
+}
+
+func doSave(call *Call) (interface{}, error) {
+	return nil, nil
+}
+
+func createObject(call *Call) (interface{}, error) {
+	object, info, err := newObject(call, "")
+	if err != nil {
+		return nil, err
+	}
+	qReturn := call.Session.NewHandle("GenericObject", call.Doc(), object)
+	if object.Session {
+		return map[string]interface{}{"qReturn": qReturn}, nil
+	}
+	return map[string]interface{}{"qInfo": info, "qReturn": qReturn}, nil
+}
+
+// newObject adds an object to the doc from the qProp argument, owned by parent if set.
+func newObject(call *Call, parent string) (*Object, map[string]interface{}, error) {
+	var properties map[string]interface{}
+	if err := call.Arg(0, "qProp", &properties); err != nil {
+		return nil, nil, err
+	}
+	info, _ := properties["qInfo"].(map[string]interface{})
+	if info == nil {
+		info = map[string]interface{}{}
+	}
+	id, _ := info["qId"].(string)
+	if len(id) == 0 {
+		id = call.NewId("obj-")
+	}
+	objectType, _ := info["qType"].(string)
+	info["qId"] = id
+	info["qType"] = objectType
+	properties["qInfo"] = info
+	session := call.Method == "CreateSessionObject" || call.Method == "CreateSessionVariable"
+	object := &Object{ID: id, Type: objectType, Parent: parent, Session: session, Properties: properties}
+	if object.Session {
+		object.owner = call.Session
+	}
+	call.Doc().Objects[id] = object
+	return object, info, nil
+}
+
+func createChild(call *Call) (interface{}, error) {
+	object, info, err := newObject(call, call.Object().ID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"qInfo": info, "qReturn": call.Session.NewHandle("GenericObject", call.Doc(), object)}, nil
+}
+
+func getChildInfos(call *Call) (interface{}, error) {
+	infos := []map[string]interface{}{}
+	for _, object := range call.Doc().Objects {
+		if object.Parent == call.Object().ID {
+			infos = append(infos, map[string]interface{}{"qId": object.ID, "qType": object.Type})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i]["qId"].(string) < infos[j]["qId"].(string) })
+	return map[string]interface{}{"qInfos": infos}, nil
+}
+
+func getObject(call *Call) (interface{}, error) {
+	return getItem("GenericObject")(call)
+}
+
+// createItem creates a master item or bookmark, kept as an object of the doc.
+func createItem(handleType string) HandlerFunc {
+	return func(call *Call) (interface{}, error) {
+		object, info, err := newObject(call, "")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"qInfo": info, "qReturn": call.Session.NewHandle(handleType, call.Doc(), object)}, nil
+	}
+}
+
+func getItem(handleType string) HandlerFunc {
+	return func(call *Call) (interface{}, error) {
+		var id string
+		if err := call.Arg(0, "qId", &id); err != nil {
+			return nil, err
+		}
+		object, ok := call.Doc().Objects[id]
+		if !ok {
+			// the engine returns an empty qReturn rather than an error for unknown ids
+			return map[string]interface{}{"qReturn": map[string]interface{}{"qType": handleType, "qHandle": nil}}, nil
+		}
+		return map[string]interface{}{"qReturn": call.Session.NewHandle(handleType, call.Doc(), object)}, nil
+	}
+}
+
+func destroyObject(call *Call) (interface{}, error) {
+	var id string
+	if err := call.Arg(0, "qId", &id); err != nil {
+		return nil, err
+	}
+	_, ok := call.Doc().Objects[id]
+	removeObject(call, id)
+	return map[string]interface{}{"qSuccess": ok}, nil
+}
+
+// removeObject removes an object with its children, as the engine does, and closes
+// the connection's handles on them.
+func removeObject(call *Call, id string) {
+	call.Doc().remove(id)
+	for handle, entry := range call.Session.handles {
+		if entry.Object != nil && entry.Doc == call.Doc() && call.Doc().Objects[entry.Object.ID] != entry.Object {
+			delete(call.Session.handles, handle)
+		}
+	}
+}
+
+func getLayout(call *Call) (interface{}, error) {
+	layout := copyProperties(call.Object().Properties)
+	for defKey, layoutKey := range lists {
+		if def, ok := layout[defKey].(map[string]interface{}); ok {
+			layout[layoutKey] = objectList(call.Doc(), def)
+		}
+	}
+	if _, ok := layout["qVariableListDef"]; ok {
+		layout["qVariableList"] = variableList(call.Doc())
+	}
+	return map[string]interface{}{"qLayout": layout}, nil
+}
+
+// variableList lists the doc's variables by name, the fake has no reserved or config
+// variables to show.
+func variableList(doc *Doc) map[string]interface{} {
+	items := []map[string]interface{}{}
+	for _, object := range doc.Objects {
+		if object.Type != glik.VARIABLE_TYPE {
+			continue
+		}
+		properties := variableProperties(object)
+		items = append(items, map[string]interface{}{"qInfo": properties.Info, "qName": properties.Name, "qDefinition": properties.Definition, "qDescription": properties.Comment})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i]["qName"].(string) < items[j]["qName"].(string) })
+	return map[string]interface{}{"qItems": items}
+}
+
+// objectList lists the doc's objects of the def's qType, with qData resolved from
+// the objects' properties by the paths of the def's qData.
+func objectList(doc *Doc, def map[string]interface{}) map[string]interface{} {
+	objectType, _ := def["qType"].(string)
+	paths, _ := def["qData"].(map[string]interface{})
+	items := []map[string]interface{}{}
+	for _, object := range doc.Objects {
+		if object.Type != objectType || object.Session {
+			continue
+		}
+		data := map[string]interface{}{}
+		for key, path := range paths {
+			if path, ok := path.(string); ok {
+				data[key] = lookup(object.Properties, path)
+			}
+		}
+		items = append(items, map[string]interface{}{"qInfo": map[string]interface{}{"qId": object.ID, "qType": object.Type}, "qData": data})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i]["qInfo"].(map[string]interface{})["qId"].(string) < items[j]["qInfo"].(map[string]interface{})["qId"].(string)
+	})
+	return map[string]interface{}{"qItems": items}
+}
+
+// lookup resolves a path such as "/qMetaDef/title" in a property tree.
+func lookup(properties map[string]interface{}, path string) interface{} {
+	var retval interface{} = properties
+	for _, key := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		node, ok := retval.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		retval = node[key]
+	}
+	return retval
+}
+
+func getFullPropertyTree(call *Call) (interface{}, error) {
+	return map[string]interface{}{"qPropEntry": propertyTree(call.Doc(), call.Object())}, nil
+}
+
+func setFullPropertyTree(call *Call) (interface{}, error) {
+	var entry propertyEntry
+	if err := call.Arg(0, "qPropEntry", &entry); err != nil {
+		return nil, err
+	}
+	object := call.Object()
+	for _, child := range call.Doc().Objects {
+		if child.Parent == object.ID {
+			removeObject(call, child.ID)
+		}
+	}
+	setEntry(call, object, entry)
+	return nil, nil
+}
+
+type propertyEntry struct {
+	Property map[string]interface{} `json:"qProperty"`
+	Children []propertyEntry        `json:"qChildren"`
+}
+
+// setEntry sets the object's properties, keeping its qInfo, and adds its children.
+func setEntry(call *Call, object *Object, entry propertyEntry) {
+	if entry.Property == nil {
+		entry.Property = map[string]interface{}{}
+	}
+	entry.Property["qInfo"] = map[string]interface{}{"qId": object.ID, "qType": object.Type}
+	object.Properties = entry.Property
+	for _, child := range entry.Children {
+		info, _ := child.Property["qInfo"].(map[string]interface{})
+		id, _ := info["qId"].(string)
+		if len(id) == 0 {
+			id = call.NewId("obj-")
+		}
+		childType, _ := info["qType"].(string)
+		childObject := &Object{ID: id, Type: childType, Parent: object.ID}
+		call.Doc().Objects[id] = childObject
+		setEntry(call, childObject, child)
+	}
+}
+
+func propertyTree(doc *Doc, object *Object) map[string]interface{} {
+	children := []map[string]interface{}{}
+	ids := []string{}
+	for _, child := range doc.Objects {
+		if child.Parent == object.ID {
+			ids = append(ids, child.ID)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		children = append(children, propertyTree(doc, doc.Objects[id]))
+	}
+	return map[string]interface{}{"qProperty": copyProperties(object.Properties), "qChildren": children}
+}
+
+func getProperties(call *Call) (interface{}, error) {
+	return map[string]interface{}{"qProp": copyProperties(call.Object().Properties)}, nil
+}
+
+func setProperties(call *Call) (interface{}, error) {
+	var properties map[string]interface{}
+	if err := call.Arg(0, "qProp", &properties); err != nil {
+		return nil, err
+	}
+	object := call.Object()
+	properties["qInfo"] = map[string]interface{}{"qId": object.ID, "qType": object.Type}
+	object.Properties = properties
+	return nil, nil
+}
+
+func getInfo(call *Call) (interface{}, error) {
+	object := call.Object()
+	return map[string]interface{}{"qInfo": map[string]interface{}{"qId": object.ID, "qType": object.Type}}, nil
+}
+
+// createVariable creates a variable, kept as an object of the doc. Variable names are
+// unique in an app.
+func createVariable(call *Call) (interface{}, error) {
+	var properties glik.GenericVariableProperties
+	if err := call.Arg(0, "qProp", &properties); err != nil {
+		return nil, err
+	}
+	if findVariable(call.Doc(), properties.Name) != nil {
+		return nil, &Error{Code: LOCERR_GENERIC_ALREADY_EXISTS, Parameter: properties.Name, Message: "Variable already exists"}
+	}
+	object, info, err := newObject(call, "")
+	if err != nil {
+		return nil, err
+	}
+	object.Type = glik.VARIABLE_TYPE
+	info["qType"] = object.Type
+	return map[string]interface{}{"qInfo": info, "qReturn": call.Session.NewHandle("GenericVariable", call.Doc(), object)}, nil
+}
+
+func getVariableByName(call *Call) (interface{}, error) {
+	var name string
+	if err := call.Arg(0, "qName", &name); err != nil {
+		return nil, err
+	}
+	object := findVariable(call.Doc(), name)
+	if object == nil {
+		return map[string]interface{}{"qReturn": map[string]interface{}{"qType": "GenericVariable", "qHandle": nil}}, nil
+	}
+	return map[string]interface{}{"qReturn": call.Session.NewHandle("GenericVariable", call.Doc(), object)}, nil
+}
+
+func destroyVariableByName(call *Call) (interface{}, error) {
+	var name string
+	if err := call.Arg(0, "qName", &name); err != nil {
+		return nil, err
+	}
+	object := findVariable(call.Doc(), name)
+	if object != nil {
+		removeObject(call, object.ID)
+	}
+	return map[string]interface{}{"qSuccess": object != nil}, nil
+}
+
+func findVariable(doc *Doc, name string) *Object {
+	for _, object := range doc.Objects {
+		if object.Type == glik.VARIABLE_TYPE && object.Properties["qName"] == name {
+			return object
+		}
+	}
+	return nil
+}
+
+func variableProperties(object *Object) glik.GenericVariableProperties {
+	var retval glik.GenericVariableProperties
+	data, _ := json.Marshal(object.Properties)
+	json.Unmarshal(data, &retval)
+	return retval
+}
+
+// getVariableLayout evaluates a variable to its definition, "=" definitions are not
+// calculated.
+func getVariableLayout(call *Call) (interface{}, error) {
+	properties := variableProperties(call.Object())
+	num := glik.NxNum(math.NaN())
+	if value, err := strconv.ParseFloat(properties.Definition, 64); err == nil {
+		num = glik.NxNum(value)
+	}
+	return map[string]interface{}{"qLayout": glik.VariableLayout{Info: properties.Info, Name: properties.Name, Text: properties.Definition, Num: num}}, nil
+}
+
+func setStringValue(call *Call) (interface{}, error) {
+	var value string
+	if err := call.Arg(0, "qVal", &value); err != nil {
+		return nil, err
+	}
+	call.Object().Properties["qDefinition"] = value
+	return nil, nil
+}
+
+func setNumValue(call *Call) (interface{}, error) {
+	var value float64
+	if err := call.Arg(0, "qVal", &value); err != nil {
+		return nil, err
+	}
+	call.Object().Properties["qDefinition"] = strconv.FormatFloat(value, 'f', -1, 64)
+	return nil, nil
+}
+
+func getField(call *Call) (interface{}, error) {
+	var name string
+	if err := call.Arg(0, "qFieldName", &name); err != nil {
+		return nil, err
+	}
+	if call.Doc().hasField(name) {
+		return map[string]interface{}{"qReturn": call.Session.NewHandle("Field", call.Doc(), nil)}, nil
+	}
+	// like unknown object ids, unknown fields get an empty qReturn
+	return map[string]interface{}{"qReturn": map[string]interface{}{"qType": "Field", "qHandle": nil}}, nil
+}
+
+// fieldSelection reports every selection as changing the field, the fake holding no
+// field values to select from.
+func fieldSelection(call *Call) (interface{}, error) {
+	return map[string]interface{}{"qReturn": true}, nil
+}
+
+func evaluateEx(call *Call) (interface{}, error) {
+	var expression string
+	if err := call.Arg(0, "qExpression", &expression); err != nil {
+		return nil, err
+	}
+	value, ok := call.Doc().Values[expression]
+	if !ok {
+		value = glik.FieldValue{Text: "Error: Bad field name"}
+	}
+	return map[string]interface{}{"qValue": value}, nil
+}
+
+// checkExpression reports unbalanced parentheses as a syntax error, and the arguments
+// of Sum that are not fields of the doc as bad field names, e.g. "Cost" in "Sum(Cost)".
+func checkExpression(call *Call) (interface{}, error) {
+	var expression string
+	if err := call.Arg(0, "qExpr", &expression); err != nil {
+		return nil, err
+	}
+	if strings.Count(expression, "(") != strings.Count(expression, ")") {
+		return map[string]interface{}{"qErrorMsg": "Error in expression: ')' expected"}, nil
+	}
+	bad := []glik.NxRange{}
+	runes := []rune(expression)
+	for i := 0; i+4 < len(runes); i++ {
+		if string(runes[i:i+4]) != "Sum(" {
+			continue
+		}
+		end := i + 4
+		for end < len(runes) && runes[end] != ')' {
+			end++
+		}
+		if !call.Doc().hasField(string(runes[i+4 : end])) {
+			bad = append(bad, glik.NxRange{From: i + 4, Count: end - i - 4})
+		}
+	}
+	return map[string]interface{}{"qErrorMsg": "", "qBadFieldNames": bad}, nil
+}
+
+func createConnection(call *Call) (interface{}, error) {
+	var connection glik.Connection
+	if err := call.Arg(0, "qConnection", &connection); err != nil {
+		return nil, err
+	}
+	server := call.Session.server
+	for _, existing := range server.connections {
+		if strings.EqualFold(existing.Name, connection.Name) {
+			return nil, &Error{Code: LOCERR_GENERIC_ALREADY_EXISTS, Parameter: connection.Name, Message: "Connection already exists"}
+		}
+	}
+	connection.Id = call.NewId("conn-")
+	server.connections = append(server.connections, &connection)
+	return map[string]interface{}{"qConnectionId": connection.Id}, nil
+}
+
+// modifyConnection keeps the credentials unless qOverrideCredentials is set, as the
+// engine does.
+func modifyConnection(call *Call) (interface{}, error) {
+	var id string
+	var connection glik.Connection
+	if err := call.Arg(0, "qConnectionId", &id); err != nil {
+		return nil, err
+	}
+	if err := call.Arg(1, "qConnection", &connection); err != nil {
+		return nil, err
+	}
+	overrideCredentials := false
+	call.Arg(2, "qOverrideCredentials", &overrideCredentials)
+	existing, err := findConnection(call, id)
+	if err != nil {
+		return nil, err
+	}
+	if !overrideCredentials {
+		connection.UserName = existing.UserName
+		connection.Password = existing.Password
+	}
+	connection.Id = id
+	*existing = connection
+	return nil, nil
+}
+
+func deleteConnection(call *Call) (interface{}, error) {
+	var id string
+	if err := call.Arg(0, "qConnectionId", &id); err != nil {
+		return nil, err
+	}
+	server := call.Session.server
+	for i, connection := range server.connections {
+		if connection.Id == id {
+			server.connections = append(server.connections[:i], server.connections[i+1:]...)
+			return nil, nil
+		}
+	}
+	return nil, &Error{Code: LOCERR_GENERIC_NOT_FOUND, Parameter: id, Message: "Connection not found"}
+}
+
+func getConnection(call *Call) (interface{}, error) {
+	var id string
+	if err := call.Arg(0, "qConnectionId", &id); err != nil {
+		return nil, err
+	}
+	connection, err := findConnection(call, id)
+	if err != nil {
+		return nil, err
+	}
+	retval := *connection
+	retval.Password = ""
+	return map[string]interface{}{"qConnection": retval}, nil
+}
+
+func getConnections(call *Call) (interface{}, error) {
+	connections := []glik.Connection{}
+	for _, connection := range call.Session.server.connections {
+		retval := *connection
+		retval.Password = ""
+		connections = append(connections, retval)
+	}
+	return map[string]interface{}{"qConnections": connections}, nil
+}
+
+func findConnection(call *Call, id string) (*glik.Connection, error) {
+	for _, connection := range call.Session.server.connections {
+		if connection.Id == id {
+			return connection, nil
+		}
+	}
+	return nil, &Error{Code: LOCERR_GENERIC_NOT_FOUND, Parameter: id, Message: "Connection not found"}
+}
+
+// copyProperties deep copies a property tree so responses don't alias server state.
+func copyProperties(properties map[string]interface{}) map[string]interface{} {
+	var retval map[string]interface{}
+	data, _ := json.Marshal(properties)
+	json.Unmarshal(data, &retval)
+	return retval
+}
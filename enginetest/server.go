@@ -0,0 +1,423 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package enginetest provides an in-process fake of the Qlik Sense Engine API, so code
+// built on glik can be tested without a Qlik Sense server.
+//
+//	server := enginetest.NewServer()
+//	defer server.Close()
+//	server.AddDoc("Sales.qvf", "Load 1 as A AutoGenerate 1;")
+//	api := server.API()
+//	err := api.OpenWebSocket()
+//
+// The server speaks JSON-RPC over a TLS websocket, allocates handles per connection the
+// way the engine does and has built in behavior for the common Global, Doc, GenericObject,
+// GenericVariable and Field methods. Any method can be scripted, or the built ins
+// overridden, with Handle.
+package enginetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/mattbaird/glik"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+)
+
+const GLOBAL_HANDLE = -1
+
+// Engine error codes, see LocalizedErrorCode in the engine api spec.
+const (
+	LOCERR_INTERNAL_ERROR             = -128
+	LOCERR_GENERIC_NOT_FOUND          = 2
+	LOCERR_GENERIC_ALREADY_EXISTS     = 3
+	LOCERR_GENERIC_INVALID_PARAMETERS = 8
+	LOCERR_APP_NOT_FOUND              = 1003
+	JSON_RPC_METHOD_NOT_FOUND         = -32601
+	JSON_RPC_INVALID_HANDLE           = -32602
+)
+
+// HandlerFunc serves one JSON-RPC method call. The returned value is marshalled as the
+// "result" of the response, an error is returned as the "error", use *Error to control the code.
+type HandlerFunc func(call *Call) (interface{}, error)
+
+// Error is a JSON-RPC error as sent by the engine.
+type Error struct {
+	Code      int    `json:"code"`
+	Parameter string `json:"parameter,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Error [%v]: %s - %s", e.Code, e.Message, e.Parameter)
+}
+
+// Doc is an app held by the fake engine. Docs survive across websocket connections.
+// Fields are the names of the fields in its data model, which GetField and the
+// expression checks answer for. Values are what EvaluateEx returns by expression, the
+// fake does not calculate.
+type Doc struct {
+	ID      string
+	Name    string
+	Script  string
+	Fields  []string
+	Values  map[string]glik.FieldValue
+	Objects map[string]*Object
+}
+
+// Object is a generic object in a Doc, Properties is the JSON object set by
+// CreateObject/SetProperties with qInfo filled in. Parent is the id of the object
+// owning it, for objects made by CreateChild.
+type Object struct {
+	ID         string
+	Type       string
+	Parent     string
+	Session    bool
+	Properties map[string]interface{}
+	owner      *Session
+}
+
+// Handle is an entry in a connection's handle table.
+type Handle struct {
+	Handle int
+	Type   string
+	Doc    *Doc
+	Object *Object
+}
+
+// Request is a method call received by the server, kept for assertions.
+type Request struct {
+	Method string
+	Handle int
+	Params json.RawMessage
+}
+
+type Server struct {
+	*httptest.Server
+	mu          sync.Mutex
+	handlers    map[string]HandlerFunc
+	docs        map[string]*Doc
+	connections []*glik.Connection
+	requests    []Request
+	nextId      int
+	conns       map[*websocket.Conn]bool
+}
+
+// NewServer starts a TLS server accepting Engine websocket connections on any path.
+func NewServer() *Server {
+	s := &Server{handlers: make(map[string]HandlerFunc), docs: make(map[string]*Doc), conns: make(map[*websocket.Conn]bool)}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serveWebsocket))
+	return s
+}
+
+// API returns a glik API pointed at the server, ready for OpenWebSocket.
+func (s *Server) API() glik.API {
+	host, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+	websocketPort, _ := strconv.Atoi(port)
+	return glik.NewAPI(host, glik.DEFAULT_DIR, glik.DEFAULT_USER, 0, 0, websocketPort)
+}
+
+// Close closes open websocket connections and shuts the server down.
+func (s *Server) Close() {
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.Server.Close()
+}
+
+// Handle scripts a method. method is either "Method", matching any handle type, or
+// "Type.Method" (e.g. "GenericObject.GetLayout") which takes precedence. Handlers
+// registered here replace the built in behavior.
+func (s *Server) Handle(method string, handler HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = handler
+}
+
+// AddDoc adds an app the engine can open by name or id, the id is the name.
+func (s *Server) AddDoc(name, script string) *Doc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addDoc(name, name, script)
+}
+
+// Doc returns the app with the given id or name.
+func (s *Server) Doc(idOrName string) *Doc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.findDoc(idOrName)
+}
+
+// AddConnection adds a data connection every app can use, returning its id.
+func (s *Server) AddConnection(connection glik.Connection) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	connection.Id = s.newId("conn-")
+	s.connections = append(s.connections, &connection)
+	return connection.Id
+}
+
+// Connections returns the data connections, with the credentials they were given.
+func (s *Server) Connections() []glik.Connection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	retval := []glik.Connection{}
+	for _, connection := range s.connections {
+		retval = append(retval, *connection)
+	}
+	return retval
+}
+
+// Requests returns the method calls received so far, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) addDoc(id, name, script string) *Doc {
+	doc := &Doc{ID: id, Name: name, Script: script, Objects: make(map[string]*Object)}
+	s.docs[id] = doc
+	return doc
+}
+
+func (s *Server) findDoc(idOrName string) *Doc {
+	if doc, ok := s.docs[idOrName]; ok {
+		return doc
+	}
+	for _, doc := range s.docs {
+		if doc.Name == idOrName {
+			return doc
+		}
+	}
+	return nil
+}
+
+func (s *Server) newId(prefix string) string {
+	s.nextId++
+	return fmt.Sprintf("%s%v", prefix, s.nextId)
+}
+
+var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+
+func (s *Server) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.conns[conn] = true
+	s.mu.Unlock()
+	session := &Session{server: s, handles: map[int]*Handle{GLOBAL_HANDLE: {Handle: GLOBAL_HANDLE, Type: "Global"}}, next: 1}
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		session.close()
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		response := session.dispatch(message)
+		if response == nil {
+			continue
+		}
+		if err := conn.WriteJSON(response); err != nil {
+			return
+		}
+	}
+}
+
+type rpcRequest struct {
+	Id     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Handle int             `json:"handle"`
+	Params json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	JsonRPCVersion string          `json:"jsonrpc"`
+	Id             json.RawMessage `json:"id"`
+	Result         interface{}     `json:"result,omitempty"`
+	Error          *Error          `json:"error,omitempty"`
+}
+
+// Session is the state of one websocket connection: its handle table and open doc.
+type Session struct {
+	server  *Server
+	handles map[int]*Handle
+	next    int
+	doc     *Doc
+}
+
+// NewHandle allocates a handle on the connection and returns the qReturn object
+// describing it, as returned by OpenDoc, GetObject and friends.
+func (session *Session) NewHandle(handleType string, doc *Doc, object *Object) map[string]interface{} {
+	handle := &Handle{Handle: session.next, Type: handleType, Doc: doc, Object: object}
+	session.handles[handle.Handle] = handle
+	session.next++
+	qReturn := map[string]interface{}{"qType": handleType, "qHandle": handle.Handle}
+	if object != nil {
+		qReturn["qGenericType"] = object.Type
+		qReturn["qGenericId"] = object.ID
+	}
+	return qReturn
+}
+
+// Doc returns the doc opened on this connection, if any.
+func (session *Session) Doc() *Doc {
+	return session.doc
+}
+
+// close removes the session objects the connection created in shared docs, the
+// engine drops them with the session that owns them.
+func (session *Session) close() {
+	for _, doc := range session.server.docs {
+		for id, object := range doc.Objects {
+			if object.owner == session {
+				doc.remove(id)
+			}
+		}
+	}
+}
+
+// remove removes an object with its children.
+func (doc *Doc) remove(id string) {
+	delete(doc.Objects, id)
+	for _, object := range doc.Objects {
+		if object.Parent == id {
+			doc.remove(object.ID)
+		}
+	}
+}
+
+func (doc *Doc) hasField(name string) bool {
+	for _, field := range doc.Fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (session *Session) dispatch(message []byte) *rpcResponse {
+	var request rpcRequest
+	if err := json.Unmarshal(message, &request); err != nil {
+		return &rpcResponse{JsonRPCVersion: "2.0", Id: json.RawMessage("null"), Error: &Error{Code: -32700, Message: "Parse error"}}
+	}
+	response := &rpcResponse{JsonRPCVersion: "2.0", Id: request.Id}
+	if len(response.Id) == 0 {
+		response.Id = json.RawMessage("0")
+	}
+	s := session.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{Method: request.Method, Handle: request.Handle, Params: request.Params})
+	handle, ok := session.handles[request.Handle]
+	if !ok {
+		response.Error = &Error{Code: JSON_RPC_INVALID_HANDLE, Parameter: strconv.Itoa(request.Handle), Message: "Invalid handle"}
+		return response
+	}
+	handler, ok := s.handlers[handle.Type+"."+request.Method]
+	if !ok {
+		handler, ok = s.handlers[request.Method]
+	}
+	if !ok {
+		handler, ok = builtins[handle.Type+"."+request.Method]
+	}
+	if !ok {
+		response.Error = &Error{Code: JSON_RPC_METHOD_NOT_FOUND, Parameter: request.Method, Message: "Method not found"}
+		return response
+	}
+	call := &Call{Session: session, Method: request.Method, Handle: handle, Params: request.Params}
+	result, err := handler(call)
+	if err != nil {
+		if rpcErr, ok := err.(*Error); ok {
+			response.Error = rpcErr
+		} else {
+			response.Error = &Error{Code: LOCERR_INTERNAL_ERROR, Message: err.Error()}
+		}
+		return response
+	}
+	if result == nil {
+		result = map[string]interface{}{}
+	}
+	response.Result = result
+	return response
+}
+
+// Call is a method call being served. Handlers run with the server locked, so they may
+// read and modify Docs and Objects freely but must not call back into the Server.
+type Call struct {
+	Session *Session
+	Method  string
+	Handle  *Handle
+	Params  json.RawMessage
+}
+
+// Arg decodes a parameter into v. Params may be sent positionally or by name, index is
+// the position and name the qName of the parameter. A missing parameter is an error.
+func (call *Call) Arg(index int, name string, v interface{}) error {
+	raw, ok := call.arg(index, name)
+	if !ok {
+		return &Error{Code: LOCERR_GENERIC_INVALID_PARAMETERS, Parameter: name, Message: "Missing parameter"}
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &Error{Code: LOCERR_GENERIC_INVALID_PARAMETERS, Parameter: name, Message: err.Error()}
+	}
+	return nil
+}
+
+// HasArg reports whether an optional parameter was sent.
+func (call *Call) HasArg(index int, name string) bool {
+	_, ok := call.arg(index, name)
+	return ok
+}
+
+func (call *Call) arg(index int, name string) (json.RawMessage, bool) {
+	var positional []json.RawMessage
+	if err := json.Unmarshal(call.Params, &positional); err == nil {
+		if index < len(positional) {
+			return positional[index], true
+		}
+		return nil, false
+	}
+	var named map[string]json.RawMessage
+	if err := json.Unmarshal(call.Params, &named); err == nil {
+		raw, ok := named[name]
+		return raw, ok
+	}
+	return nil, false
+}
+
+// Doc is the doc the call's handle belongs to.
+func (call *Call) Doc() *Doc {
+	return call.Handle.Doc
+}
+
+// Object is the generic object behind the call's handle, nil for Global and Doc handles.
+func (call *Call) Object() *Object {
+	return call.Handle.Object
+}
+
+// NewId returns an id unique to the server, for apps and objects created by handlers.
+func (call *Call) NewId(prefix string) string {
+	return call.Session.server.newId(prefix)
+}
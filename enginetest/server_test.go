@@ -0,0 +1,185 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enginetest_test
+
+import (
+	"errors"
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"testing"
+	"time"
+)
+
+func openDoc(t *testing.T, server *enginetest.Server, name string) (*glik.API, *glik.Doc) {
+	api := server.API()
+	if err := api.OpenWebSocket(); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := api.OpenDoc(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &api, doc
+}
+
+func TestHandleAllocation(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "Load 1 as A AutoGenerate 1;")
+	api, doc := openDoc(t, server, "Sales.qvf")
+	defer api.CloseWebSocket()
+	if doc.Handle != 1 {
+		t.Errorf("doc handle %v, want 1", doc.Handle)
+	}
+	first, err := doc.CreateObject(map[string]interface{}{"qInfo": map[string]interface{}{"qType": "chart"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := doc.GetObject(first.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Handle != 2 || second.Handle != 3 || second.Id != first.Id || second.Type != "chart" {
+		t.Errorf("got handles %+v %+v", first, second)
+	}
+	if _, err := doc.GetObject("missing"); err != glik.ErrDoesNotExist {
+		t.Errorf("got %v for an unknown object", err)
+	}
+	// handles are per connection
+	other, otherDoc := openDoc(t, server, "Sales.qvf")
+	defer other.CloseWebSocket()
+	if otherDoc.Handle != 1 {
+		t.Errorf("second connection doc handle %v, want 1", otherDoc.Handle)
+	}
+	script, err := doc.GetScript()
+	if err != nil || script != "Load 1 as A AutoGenerate 1;" {
+		t.Errorf("got %q, %v", script, err)
+	}
+}
+
+func TestErrorMapping(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	server.Handle("Doc.Evaluate", func(call *enginetest.Call) (interface{}, error) {
+		var expression string
+		if err := call.Arg(0, "qExpression", &expression); err != nil {
+			return nil, err
+		}
+		if expression == "fail" {
+			return nil, errors.New("boom")
+		}
+		return nil, &enginetest.Error{Code: enginetest.LOCERR_GENERIC_INVALID_PARAMETERS, Parameter: expression, Message: "Invalid parameters"}
+	})
+	api, doc := openDoc(t, server, "Sales.qvf")
+	defer api.CloseWebSocket()
+	tests := []struct {
+		name string
+		call func() error
+		want glik.WebsocketError
+	}{
+		{"invalid handle", func() error {
+			_, err := api.GetScript(99)
+			return err
+		}, glik.WebsocketError{Code: enginetest.JSON_RPC_INVALID_HANDLE, Parameter: "99", Message: "Invalid handle"}},
+		{"method not found", func() error {
+			_, _, err := doc.GetTablesAndKeys(false, false)
+			return err
+		}, glik.WebsocketError{Code: enginetest.JSON_RPC_METHOD_NOT_FOUND, Parameter: "GetTablesAndKeys", Message: "Method not found"}},
+		{"handler error", func() error {
+			_, err := doc.Evaluate("Sum(")
+			return err
+		}, glik.WebsocketError{Code: enginetest.LOCERR_GENERIC_INVALID_PARAMETERS, Parameter: "Sum(", Message: "Invalid parameters"}},
+		{"plain error", func() error {
+			_, err := doc.Evaluate("fail")
+			return err
+		}, glik.WebsocketError{Code: enginetest.LOCERR_INTERNAL_ERROR, Message: "boom"}},
+		{"unknown app", func() error {
+			_, err := api.Open("", "", "")
+			return err
+		}, glik.WebsocketError{Code: enginetest.LOCERR_APP_NOT_FOUND, Message: "App not found"}},
+	}
+	for _, test := range tests {
+		err := test.call()
+		got, ok := err.(*glik.WebsocketError)
+		if !ok {
+			t.Errorf("%s: got %T %v", test.name, err, err)
+			continue
+		}
+		if test.want.Parameter == "" {
+			test.want.Parameter = got.Parameter
+		}
+		if *got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, *got, test.want)
+		}
+	}
+}
+
+func TestSessionObjectsRemovedOnClose(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	keep, keepDoc := openDoc(t, server, "Sales.qvf")
+	defer keep.CloseWebSocket()
+	kept, err := keepDoc.CreateSessionObject(map[string]interface{}{"qInfo": map[string]interface{}{"qType": "list"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, doc := openDoc(t, server, "Sales.qvf")
+	session, err := doc.CreateSessionObject(map[string]interface{}{"qInfo": map[string]interface{}{"qType": "list"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	persistent, err := doc.CreateObject(map[string]interface{}{"qInfo": map[string]interface{}{"qType": "chart"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.CloseWebSocket()
+	check, checkDoc := openDoc(t, server, "Sales.qvf")
+	defer check.CloseWebSocket()
+	_, err = checkDoc.GetObject(session.Id)
+	for deadline := time.Now().Add(time.Second); err == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		_, err = checkDoc.GetObject(session.Id)
+	}
+	if err != glik.ErrDoesNotExist {
+		t.Errorf("session object %s survived its connection: %v", session.Id, err)
+	}
+	if _, err := checkDoc.GetObject(persistent.Id); err != nil {
+		t.Errorf("object %s was removed with the connection: %v", persistent.Id, err)
+	}
+	if _, err := checkDoc.GetObject(kept.Id); err != nil {
+		t.Errorf("session object %s of another connection was removed: %v", kept.Id, err)
+	}
+}
+
+func TestRequestsRecorded(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	api := server.API()
+	if err := api.OpenWebSocket(); err != nil {
+		t.Fatal(err)
+	}
+	defer api.CloseWebSocket()
+	response, err := api.Open("Sales.qvf", glik.DEFAULT_DIR, glik.DEFAULT_USER)
+	if err != nil || response.Result.Return.Handle != 1 {
+		t.Fatalf("got %+v, %v", response, err)
+	}
+	if _, err := api.OpenDoc("Sales.qvf"); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.Requests()
+	if len(requests) != 2 || requests[0].Method != "OpenDoc" || requests[1].Handle != enginetest.GLOBAL_HANDLE {
+		t.Errorf("got requests %+v", requests)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+)
+
+// file types of GenericObject.ExportData
+const (
+	EXPORT_OOXML     = "OOXML"
+	EXPORT_CSV_COMMA = "CSV_C"
+	EXPORT_CSV_TAB   = "CSV_T"
+)
+
+// export states of GenericObject.ExportData, the possible values or all of them
+const (
+	EXPORT_STATE_POSSIBLE = "P"
+	EXPORT_STATE_ALL      = "A"
+)
+
+// ExportDataOptions are the optional parameters of ExportData. Path defaults to
+// HYPERCUBE_PATH, FileName to a name chosen by the engine and ExportState to
+// EXPORT_STATE_POSSIBLE.
+type ExportDataOptions struct {
+	Path        string
+	FileName    string
+	ExportState string
+}
+
+// ExportData has the engine write the object's data to a file in the proxy's temp
+// content, returning the file's path, e.g. "/tempcontent/<appId>/<file>.xlsx?serverNodeId=<id>".
+// Fetch it with DownloadTempContent.
+func (o *GenericObject) ExportData(fileType string, opts ExportDataOptions) (string, error) {
+	path := opts.Path
+	if len(path) == 0 {
+		path = HYPERCUBE_PATH
+	}
+	state := opts.ExportState
+	if len(state) == 0 {
+		state = EXPORT_STATE_POSSIBLE
+	}
+	var result struct {
+		Url string `json:"qUrl"`
+	}
+	err := o.call("ExportData", []interface{}{fileType, path, opts.FileName, state}, &result)
+	if err != nil {
+		return "", err
+	}
+	if len(result.Url) == 0 {
+		return "", fmt.Errorf("error exporting data of object [%s]:no url returned", o.Id)
+	}
+	return result.Url, nil
+}
+
+// DownloadTempContent copies a temp content file, as returned by ExportData, to w. The
+// file is fetched from the proxy, through the virtual proxy when one is configured.
+func (api *API) DownloadTempContent(tempContentUrl string, w io.Writer) error {
+	parsed, err := url.Parse(tempContentUrl)
+	if err != nil {
+		return fmt.Errorf("error parsing temp content url [%s]:%v", tempContentUrl, err)
+	}
+	headers := make(map[string]string)
+	headers[qlik_user_header] = api.makeQlikUserHeader()
+	return api.download(api.proxyUrl(parsed.Path, parsed.Query()), w, headers, connectTimeOut, downloadTimeout)
+}
+
+// ExportDataTo exports the object's data and downloads the file to w.
+func (o *GenericObject) ExportDataTo(fileType string, opts ExportDataOptions, w io.Writer) error {
+	tempContentUrl, err := o.ExportData(fileType, opts)
+	if err != nil {
+		return err
+	}
+	return o.api.DownloadTempContent(tempContentUrl, w)
+}
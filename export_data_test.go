@@ -0,0 +1,110 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"bytes"
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// serveExport scripts ExportData to return exportUrl, recording the parameters sent.
+func serveExport(server *enginetest.Server, exportUrl string, params *[]string) {
+	server.Handle("ExportData", func(call *enginetest.Call) (interface{}, error) {
+		*params = nil
+		for i, name := range []string{"qFileType", "qPath", "qFileName", "qExportState"} {
+			var param string
+			if err := call.Arg(i, name, &param); err != nil {
+				return nil, err
+			}
+			*params = append(*params, param)
+		}
+		return map[string]string{"qUrl": exportUrl}, nil
+	})
+}
+
+func TestExportDataDefaults(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	var params []string
+	serveExport(server, "/tempcontent/abc/f.xlsx?serverNodeId=9", &params)
+	doc := openTestDoc(t, server, "Sales.qvf")
+	object, err := doc.CreateSessionObject(map[string]interface{}{"qInfo": glik.NxInfo{Type: "table"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tempContentUrl, err := object.ExportData(glik.EXPORT_OOXML, glik.ExportDataOptions{})
+	if err != nil || tempContentUrl != "/tempcontent/abc/f.xlsx?serverNodeId=9" {
+		t.Fatalf("got %q, %v", tempContentUrl, err)
+	}
+	if want := []string{glik.EXPORT_OOXML, glik.HYPERCUBE_PATH, "", glik.EXPORT_STATE_POSSIBLE}; len(params) != 4 || params[0] != want[0] || params[1] != want[1] || params[2] != want[2] || params[3] != want[3] {
+		t.Errorf("sent %v, want %v", params, want)
+	}
+	opts := glik.ExportDataOptions{Path: "/qListObjectDef", FileName: "regions", ExportState: glik.EXPORT_STATE_ALL}
+	if _, err := object.ExportData(glik.EXPORT_CSV_TAB, opts); err != nil || params[1] != opts.Path || params[2] != opts.FileName || params[3] != opts.ExportState {
+		t.Errorf("sent %v, %v", params, err)
+	}
+	serveExport(server, "", &params)
+	if _, err := object.ExportData(glik.EXPORT_CSV_COMMA, glik.ExportDataOptions{}); err == nil {
+		t.Error("expected an error without a url")
+	}
+}
+
+func TestExportDataToThroughVirtualProxy(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	var params []string
+	serveExport(server, "/tempcontent/abc/f.csv?serverNodeId=9", &params)
+	var requested, user string
+	proxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested, user = r.URL.String(), r.Header.Get("X-Qlik-User")
+		if r.URL.Path != "/hdr/tempcontent/abc/f.csv" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("Region,Sales\n"))
+	}))
+	defer proxy.Close()
+	api := server.API()
+	_, port, _ := net.SplitHostPort(proxy.Listener.Addr().String())
+	api.ProxyPort, _ = strconv.Atoi(port)
+	api.VirtualProxy = "hdr"
+	if err := api.OpenWebSocket(); err != nil {
+		t.Fatal(err)
+	}
+	defer api.CloseWebSocket()
+	doc, err := api.OpenDoc("Sales.qvf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	object, err := doc.CreateSessionObject(map[string]interface{}{"qInfo": glik.NxInfo{Type: "table"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := object.ExportDataTo(glik.EXPORT_CSV_COMMA, glik.ExportDataOptions{}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "Region,Sales\n" || requested != "/hdr/tempcontent/abc/f.csv?serverNodeId=9" || len(user) == 0 {
+		t.Errorf("got %q from %s as %q", out.String(), requested, user)
+	}
+	if err := api.DownloadTempContent("/tempcontent/abc/missing.csv", &out); err != glik.ErrDoesNotExist {
+		t.Errorf("got %v for a missing file", err)
+	}
+}
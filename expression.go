@@ -0,0 +1,139 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EvaluateEx evaluates an expression in the app to a dual value. The text is set for
+// every result, the number when IsNumeric, e.g. "Sum(Sales)" or "Year(Today()) > 2015".
+func (d *Doc) EvaluateEx(expression string) (FieldValue, error) {
+	var result struct {
+		Value FieldValue `json:"qValue"`
+	}
+	err := d.call("EvaluateEx", []interface{}{expression}, &result)
+	return result.Value, err
+}
+
+// EvaluateBool evaluates a condition such as "Sum({<Year={2016}>} Sales) > 0", the
+// engine's true being -1.
+func (d *Doc) EvaluateBool(expression string) (bool, error) {
+	value, err := d.EvaluateEx(expression)
+	return value.Bool(), err
+}
+
+// Float is the number of a numeric value.
+func (v FieldValue) Float() (float64, bool) {
+	return v.Number, v.IsNumeric
+}
+
+// Bool is true for numeric values other than 0.
+func (v FieldValue) Bool() bool {
+	return v.IsNumeric && v.Number != 0
+}
+
+func (v FieldValue) String() string {
+	return v.Text
+}
+
+// NxRange locates a part of an expression, in characters.
+type NxRange struct {
+	From  int `json:"qFrom"`
+	Count int `json:"qCount"`
+}
+
+// ExpressionError is a failed expression check. BadFieldNames are names that are not
+// fields of the app, DangerousFieldNames are fields that are slow to calculate on,
+// e.g. fields from huge tables used without aggregation. ItemType and ItemId are set
+// by Catalog.CheckExpressions to the measure id or variable name of the expression.
+type ExpressionError struct {
+	Expression          string
+	Message             string
+	BadFieldNames       []string
+	DangerousFieldNames []string
+	BadRanges           []NxRange
+	ItemType            string
+	ItemId              string
+}
+
+func (e *ExpressionError) Error() string {
+	retval := fmt.Sprintf("error in expression [%s]", e.Expression)
+	if len(e.ItemId) > 0 {
+		retval = fmt.Sprintf("error in %s [%s] expression [%s]", e.ItemType, e.ItemId, e.Expression)
+	}
+	if len(e.Message) > 0 {
+		retval += ":" + e.Message
+	}
+	if len(e.BadFieldNames) > 0 {
+		retval += fmt.Sprintf(" bad field names [%s]", strings.Join(e.BadFieldNames, ", "))
+	}
+	return retval
+}
+
+type expressionCheck struct {
+	ErrorMsg            string    `json:"qErrorMsg"`
+	BadFieldNames       []NxRange `json:"qBadFieldNames"`
+	DangerousFieldNames []NxRange `json:"qDangerousFieldNames"`
+}
+
+func (c expressionCheck) err(expression string) error {
+	if len(c.ErrorMsg) == 0 && len(c.BadFieldNames) == 0 {
+		return nil
+	}
+	return &ExpressionError{
+		Expression:          expression,
+		Message:             c.ErrorMsg,
+		BadFieldNames:       rangesOf(expression, c.BadFieldNames),
+		DangerousFieldNames: rangesOf(expression, c.DangerousFieldNames),
+		BadRanges:           c.BadFieldNames,
+	}
+}
+
+// CheckExpression checks the syntax and field names of an expression, returning an
+// *ExpressionError if it is wrong. labels are the labels of other measures the
+// expression may refer to.
+func (d *Doc) CheckExpression(expression string, labels []string) error {
+	var result expressionCheck
+	if labels == nil {
+		labels = []string{}
+	}
+	err := d.call("CheckExpression", []interface{}{expression, labels}, &result)
+	if err != nil {
+		return err
+	}
+	return result.err(expression)
+}
+
+// CheckNumberOrExpression checks a value that is either a number or an expression
+// starting with "=", such as a variable definition.
+func (d *Doc) CheckNumberOrExpression(expression string) error {
+	var result expressionCheck
+	err := d.call("CheckNumberOrExpression", []interface{}{expression}, &result)
+	if err != nil {
+		return err
+	}
+	return result.err(expression)
+}
+
+func rangesOf(expression string, ranges []NxRange) []string {
+	runes := []rune(expression)
+	retval := []string{}
+	for _, r := range ranges {
+		if r.From < 0 || r.Count < 0 || r.From+r.Count > len(runes) {
+			continue
+		}
+		retval = append(retval, string(runes[r.From:r.From+r.Count]))
+	}
+	return retval
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"fmt"
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateEx(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "").Values = map[string]glik.FieldValue{
+		"Sum(Sales)":     {Text: "1,234.5", IsNumeric: true, Number: 1234.5},
+		"Sum(Sales) > 0": {Text: "-1", IsNumeric: true, Number: -1},
+		"Sum(Sales) < 0": {Text: "0", IsNumeric: true, Number: 0},
+		"Only(Region)":   {Text: "North"},
+	}
+	doc := openTestDoc(t, server, "Sales.qvf")
+	value, err := doc.EvaluateEx("Sum(Sales)")
+	if number, ok := value.Float(); err != nil || !ok || number != 1234.5 || value.String() != "1,234.5" {
+		t.Errorf("got %+v, %v", value, err)
+	}
+	if value, err := doc.EvaluateEx("Only(Region)"); err != nil || value.Bool() || value.String() != "North" {
+		t.Errorf("got %+v, %v", value, err)
+	}
+	for expression, want := range map[string]bool{"Sum(Sales) > 0": true, "Sum(Sales) < 0": false, "Sum(Sale) > 0": false} {
+		if got, err := doc.EvaluateBool(expression); err != nil || got != want {
+			t.Errorf("%s: got %v, %v", expression, got, err)
+		}
+	}
+}
+
+func TestCheckExpression(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "").Fields = []string{"Sales", "Coût"}
+	doc := openTestDoc(t, server, "Sales.qvf")
+	for _, expression := range []string{"Sum(Sales)", "Sum(Sales)/Sum(Coût)", "=Sum(Sales)"} {
+		if err := doc.CheckExpression(expression, nil); err != nil {
+			t.Errorf("%s: got %v", expression, err)
+		}
+	}
+	err := doc.CheckExpression("Sum(Coût)-Sum(Cost)", []string{"Revenue"})
+	expressionError, ok := err.(*glik.ExpressionError)
+	if !ok || fmt.Sprint(expressionError.BadFieldNames) != "[Cost]" || expressionError.BadRanges[0].From != 14 {
+		t.Fatalf("got %#v", err)
+	}
+	if !strings.Contains(err.Error(), "bad field names [Cost]") {
+		t.Errorf("got %v", err)
+	}
+	err = doc.CheckNumberOrExpression("=Sum(Sales")
+	if expressionError, ok := err.(*glik.ExpressionError); !ok || !strings.Contains(expressionError.Message, "expected") {
+		t.Errorf("got %#v", err)
+	}
+	catalog := glik.Catalog{
+		Measures:  []glik.CatalogMeasure{{Id: "kpi-revenue", Title: "Revenue", Expression: "Sum(Sales)"}},
+		Variables: []glik.CatalogVariable{{Name: "vText", Definition: "Sum(Sale"}, {Name: "vCost", Definition: "=Sum(Cost)"}},
+	}
+	err = catalog.CheckExpressions(doc)
+	expressionError, ok = err.(*glik.ExpressionError)
+	if !ok || expressionError.ItemType != glik.VARIABLE_TYPE || expressionError.ItemId != "vCost" || fmt.Sprint(expressionError.BadFieldNames) != "[Cost]" {
+		t.Fatalf("got %#v", err)
+	}
+	if err.Error() != "error in variable [vCost] expression [=Sum(Cost)] bad field names [Cost]" {
+		t.Errorf("got %v", err)
+	}
+}
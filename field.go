@@ -0,0 +1,275 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+const LIST_OBJECT_PATH = "/qListObjectDef"
+const SELECTIONS_OBJECT_TYPE = "CurrentSelections"
+const LIST_OBJECT_TYPE = "glik-listbox"
+
+// qExcludedValuesMode of Select and ToggleSelect
+const (
+	EXCLUDED_VALUES_IGNORE  = 0
+	EXCLUDED_VALUES_INCLUDE = 1
+)
+
+// cell states, see NxCell
+const (
+	STATE_LOCKED        = "L"
+	STATE_SELECTED      = "S"
+	STATE_OPTION        = "O"
+	STATE_DESELECTED    = "D"
+	STATE_ALTERNATIVE   = "A"
+	STATE_EXCLUDED      = "X"
+	STATE_EXCL_SELECTED = "XS"
+	STATE_EXCL_LOCKED   = "XL"
+)
+
+// FieldValue is a value to select, see TextValue and NumberValue.
+type FieldValue struct {
+	Text      string  `json:"qText"`
+	IsNumeric bool    `json:"qIsNumeric"`
+	Number    float64 `json:"qNumber"`
+}
+
+func TextValue(text string) FieldValue {
+	return FieldValue{Text: text}
+}
+
+func NumberValue(number float64) FieldValue {
+	return FieldValue{IsNumeric: true, Number: number}
+}
+
+// Field is a field of an app in a selection state, see the Field class of the engine
+// api. Selections report whether they changed anything.
+type Field struct {
+	api    *API
+	Handle int
+	Name   string
+	State  string
+}
+
+// Field returns the field with the name in the default state, ErrDoesNotExist if the
+// app has no such field.
+func (d *Doc) Field(name string) (*Field, error) {
+	return d.FieldInState(name, "")
+}
+
+// FieldInState returns the field for selections in an alternate state.
+func (d *Doc) FieldInState(name, state string) (*Field, error) {
+	handle, err := d.api.callForHandle(d.Handle, "GetField", []interface{}{name, state})
+	if err != nil {
+		return nil, err
+	}
+	return &Field{api: d.api, Handle: handle.Handle, Name: name, State: state}, nil
+}
+
+// ClearAll clears the selections in all fields, lockedAlso clears locked fields too.
+func (d *Doc) ClearAll(lockedAlso bool) error {
+	return d.ClearAllInState(lockedAlso, "")
+}
+
+func (d *Doc) ClearAllInState(lockedAlso bool, state string) error {
+	return d.call("ClearAll", []interface{}{lockedAlso, state}, nil)
+}
+
+func (f *Field) call(method string, params interface{}) (bool, error) {
+	var result struct {
+		Return bool `json:"qReturn"`
+	}
+	err := f.api.call(f.Handle, method, params, &result)
+	return result.Return, err
+}
+
+// Select selects the values matching a search string, e.g. "North", "A*" or ">100".
+func (f *Field) Select(match string, softLock bool, excludedValuesMode int) (bool, error) {
+	return f.call("Select", []interface{}{match, softLock, excludedValuesMode})
+}
+
+// ToggleSelect toggles the values matching a search string.
+func (f *Field) ToggleSelect(match string, softLock bool, excludedValuesMode int) (bool, error) {
+	return f.call("ToggleSelect", []interface{}{match, softLock, excludedValuesMode})
+}
+
+// SelectValues selects values by text or number, toggleMode adds to the current selection.
+func (f *Field) SelectValues(values []FieldValue, toggleMode bool, softLock bool) (bool, error) {
+	return f.call("SelectValues", []interface{}{values, toggleMode, softLock})
+}
+
+// LowLevelSelect selects values by element number, see NxCell.ElemNumber.
+func (f *Field) LowLevelSelect(values []int, toggleMode bool, softLock bool) (bool, error) {
+	return f.call("LowLevelSelect", []interface{}{values, toggleMode, softLock})
+}
+
+func (f *Field) SelectPossible(softLock bool) (bool, error) {
+	return f.call("SelectPossible", []interface{}{softLock})
+}
+
+func (f *Field) SelectExcluded(softLock bool) (bool, error) {
+	return f.call("SelectExcluded", []interface{}{softLock})
+}
+
+func (f *Field) SelectAlternative(softLock bool) (bool, error) {
+	return f.call("SelectAlternative", []interface{}{softLock})
+}
+
+func (f *Field) SelectAll(softLock bool) (bool, error) {
+	return f.call("SelectAll", []interface{}{softLock})
+}
+
+func (f *Field) ClearAllButThis(softLock bool) (bool, error) {
+	return f.call("ClearAllButThis", []interface{}{softLock})
+}
+
+func (f *Field) Clear() (bool, error) {
+	return f.call("Clear", nil)
+}
+
+func (f *Field) Lock() (bool, error) {
+	return f.call("Lock", nil)
+}
+
+func (f *Field) Unlock() (bool, error) {
+	return f.call("Unlock", nil)
+}
+
+// NxFieldProperties are the properties of a field, OneAndOnlyOne keeps exactly one
+// value selected.
+type NxFieldProperties struct {
+	OneAndOnlyOne bool `json:"qOneAndOnlyOne"`
+}
+
+// SetNxProperties sets the field's properties, OneAndOnlyOne needs exactly one
+// selected value when set.
+func (f *Field) SetNxProperties(properties NxFieldProperties) error {
+	return f.api.call(f.Handle, "SetNxProperties", []interface{}{properties}, nil)
+}
+
+// GetCardinal is the number of distinct values of the field.
+func (f *Field) GetCardinal() (int, error) {
+	var result struct {
+		Return int `json:"qReturn"`
+	}
+	err := f.api.call(f.Handle, "GetCardinal", nil, &result)
+	return result.Return, err
+}
+
+type NxFieldSelectionInfo struct {
+	Name               string `json:"qName"`
+	FieldSelectionMode string `json:"qFieldSelectionMode"`
+}
+
+// CurrentSelection is a field with selections. SelectedFieldSelectionInfo lists the
+// selected values only for small selections, Selected then reads e.g. "7 of 12";
+// Values always holds every selected value.
+type CurrentSelection struct {
+	Field                      string                 `json:"qField"`
+	Total                      int                    `json:"qTotal"`
+	SelectedCount              int                    `json:"qSelectedCount"`
+	Selected                   string                 `json:"qSelected"`
+	Locked                     bool                   `json:"qLocked"`
+	IsNum                      bool                   `json:"qIsNum"`
+	SelectedFieldSelectionInfo []NxFieldSelectionInfo `json:"qSelectedFieldSelectionInfo"`
+	Values                     []string               `json:"-"`
+}
+
+// CurrentSelections returns the fields with selections, through a session selection object.
+func (d *Doc) CurrentSelections() ([]CurrentSelection, error) {
+	return d.CurrentSelectionsInState("")
+}
+
+// CurrentSelectionsInState returns the fields with selections in an alternate state.
+func (d *Doc) CurrentSelectionsInState(state string) ([]CurrentSelection, error) {
+	properties := map[string]interface{}{
+		"qInfo":               NxInfo{Type: SELECTIONS_OBJECT_TYPE},
+		"qStateName":          state,
+		"qSelectionObjectDef": map[string]interface{}{},
+	}
+	object, err := d.CreateSessionObject(properties)
+	if err != nil {
+		return nil, err
+	}
+	defer d.DestroySessionObject(object.Id)
+	var layout struct {
+		SelectionObject struct {
+			Selections []CurrentSelection `json:"qSelections"`
+		} `json:"qSelectionObject"`
+	}
+	err = object.GetLayout(&layout)
+	if err != nil {
+		return nil, err
+	}
+	retval := layout.SelectionObject.Selections
+	for i := range retval {
+		selection := &retval[i]
+		if len(selection.SelectedFieldSelectionInfo) >= selection.SelectedCount {
+			for _, info := range selection.SelectedFieldSelectionInfo {
+				selection.Values = append(selection.Values, info.Name)
+			}
+			continue
+		}
+		selection.Values, err = d.selectedValues(selection.Field, state)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return retval, nil
+}
+
+// selectedValues reads the selected and locked values of a field through a session list object.
+func (d *Doc) selectedValues(field, state string) ([]string, error) {
+	properties := map[string]interface{}{
+		"qInfo": NxInfo{Type: LIST_OBJECT_TYPE},
+		"qListObjectDef": map[string]interface{}{
+			"qStateName":        state,
+			"qDef":              NxInlineDimensionDef{FieldDefs: []string{field}},
+			"qInitialDataFetch": []NxPage{},
+		},
+	}
+	object, err := d.CreateSessionObject(properties)
+	if err != nil {
+		return nil, err
+	}
+	defer d.DestroySessionObject(object.Id)
+	var layout struct {
+		ListObject struct {
+			Size NxSize `json:"qSize"`
+		} `json:"qListObject"`
+	}
+	err = object.GetLayout(&layout)
+	if err != nil {
+		return nil, err
+	}
+	retval := []string{}
+	for top := 0; top < layout.ListObject.Size.Cy; top += MAX_PAGE_CELLS {
+		pages, err := object.GetListObjectData(LIST_OBJECT_PATH, []NxPage{{Top: top, Height: MAX_PAGE_CELLS, Width: 1}})
+		if err != nil {
+			return nil, err
+		}
+		for _, page := range pages {
+			for _, row := range page.Matrix {
+				if len(row) > 0 && (row[0].State == STATE_SELECTED || row[0].State == STATE_LOCKED) {
+					retval = append(retval, row[0].Text)
+				}
+			}
+		}
+	}
+	return retval, nil
+}
+
+// GetListObjectData fetches pages of the list object at path, e.g. LIST_OBJECT_PATH.
+func (o *GenericObject) GetListObjectData(path string, pages []NxPage) ([]NxDataPage, error) {
+	var result struct {
+		DataPages []NxDataPage `json:"qDataPages"`
+	}
+	err := o.call("GetListObjectData", []interface{}{path, pages}, &result)
+	return result.DataPages, err
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"fmt"
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"testing"
+)
+
+func TestFieldSelections(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "").Fields = []string{"Region"}
+	doc := openTestDoc(t, server, "Sales.qvf")
+	if _, err := doc.Field("Nope"); err != glik.ErrDoesNotExist {
+		t.Errorf("got %v for a missing field", err)
+	}
+	field, err := doc.Field("Region")
+	if err != nil {
+		t.Fatal(err)
+	}
+	selections := []func() (bool, error){
+		func() (bool, error) { return field.Select("N*", true, glik.EXCLUDED_VALUES_INCLUDE) },
+		func() (bool, error) {
+			return field.SelectValues([]glik.FieldValue{glik.TextValue("North"), glik.NumberValue(3)}, false, false)
+		},
+		func() (bool, error) { return field.LowLevelSelect([]int{0, 2}, true, false) },
+		func() (bool, error) { return field.Lock() },
+		func() (bool, error) { return field.Clear() },
+	}
+	for _, selection := range selections {
+		if changed, err := selection(); err != nil || !changed {
+			t.Errorf("got %v, %v", changed, err)
+		}
+	}
+	want := []string{
+		`Select ["N*",true,1]`,
+		`SelectValues [[{"qText":"North","qIsNumeric":false,"qNumber":0},{"qText":"","qIsNumeric":true,"qNumber":3}],false,false]`,
+		`LowLevelSelect [[0,2],true,false]`,
+		`Lock []`,
+		`Clear []`,
+	}
+	calls := []string{}
+	for _, request := range server.Requests() {
+		if request.Handle == field.Handle {
+			calls = append(calls, request.Method+" "+string(request.Params))
+		}
+	}
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Errorf("sent %v\nwant %v", calls, want)
+	}
+}
+
+func TestCurrentSelections(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	var fetched []glik.NxPage
+	server.Handle("GenericObject.GetLayout", func(call *enginetest.Call) (interface{}, error) {
+		if call.Object().Type == glik.SELECTIONS_OBJECT_TYPE {
+			return map[string]interface{}{"qLayout": map[string]interface{}{"qSelectionObject": map[string]interface{}{"qSelections": []glik.CurrentSelection{
+				{Field: "Region", SelectedCount: 1, Selected: "North", SelectedFieldSelectionInfo: []glik.NxFieldSelectionInfo{{Name: "North"}}},
+				{Field: "Id", SelectedCount: 12000, Selected: "12000 of 20000", Locked: true},
+			}}}}, nil
+		}
+		return map[string]interface{}{"qLayout": map[string]interface{}{"qListObject": map[string]interface{}{"qSize": glik.NxSize{Cx: 1, Cy: 20000}}}}, nil
+	})
+	server.Handle("GetListObjectData", func(call *enginetest.Call) (interface{}, error) {
+		var pages []glik.NxPage
+		if err := call.Arg(1, "qPages", &pages); err != nil {
+			return nil, err
+		}
+		fetched = append(fetched, pages...)
+		matrix := [][]glik.NxCell{}
+		for row := pages[0].Top; row < pages[0].Top+pages[0].Height && row < 20000; row++ {
+			state := glik.STATE_OPTION
+			if row%5 < 3 {
+				state = glik.STATE_LOCKED
+			}
+			matrix = append(matrix, []glik.NxCell{{Text: fmt.Sprint(row), Num: glik.NxNum(row), State: state}})
+		}
+		return map[string]interface{}{"qDataPages": []glik.NxDataPage{{Matrix: matrix}}}, nil
+	})
+	doc := openTestDoc(t, server, "Sales.qvf")
+	selections, err := doc.CurrentSelections()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selections) != 2 || fmt.Sprint(selections[0].Values) != "[North]" {
+		t.Fatalf("got %+v", selections)
+	}
+	ids := selections[1]
+	if !ids.Locked || len(ids.Values) != 12000 || ids.Values[0] != "0" || ids.Values[3] != "5" {
+		t.Errorf("got %v values for Id", len(ids.Values))
+	}
+	if len(fetched) != 2 || fetched[1].Top != glik.MAX_PAGE_CELLS {
+		t.Errorf("fetched %v", fetched)
+	}
+	created, destroyed := 0, 0
+	for _, request := range server.Requests() {
+		switch request.Method {
+		case "CreateSessionObject":
+			created++
+		case "DestroySessionObject":
+			destroyed++
+		}
+	}
+	if created != 2 || destroyed != created {
+		t.Errorf("created %v session objects, destroyed %v", created, destroyed)
+	}
+}
@@ -0,0 +1,401 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// the engine refuses data pages of more cells than this
+const MAX_PAGE_CELLS = 10000
+
+const HYPERCUBE_PATH = "/qHyperCubeDef"
+const HYPERCUBE_OBJECT_TYPE = "glik-hypercube"
+
+// hypercube modes, pivot and stacked cubes are read with GetHyperCubePivotData and
+// GetHyperCubeStackData
+const (
+	HYPERCUBE_MODE_STRAIGHT = "S"
+	HYPERCUBE_MODE_PIVOT    = "P"
+	HYPERCUBE_MODE_STACKED  = "K"
+)
+
+type NxInlineDimensionDef struct {
+	FieldDefs   []string `json:"qFieldDefs"`
+	FieldLabels []string `json:"qFieldLabels,omitempty"`
+}
+
+type NxDimension struct {
+	LibraryId       string               `json:"qLibraryId,omitempty"`
+	Def             NxInlineDimensionDef `json:"qDef"`
+	NullSuppression bool                 `json:"qNullSuppression,omitempty"`
+}
+
+type NxInlineMeasureDef struct {
+	Label string `json:"qLabel,omitempty"`
+	Def   string `json:"qDef"`
+}
+
+type NxMeasure struct {
+	LibraryId string             `json:"qLibraryId,omitempty"`
+	Def       NxInlineMeasureDef `json:"qDef"`
+}
+
+type NxPage struct {
+	Top    int `json:"qTop"`
+	Left   int `json:"qLeft"`
+	Height int `json:"qHeight"`
+	Width  int `json:"qWidth"`
+}
+
+// HyperCubeDef is calculated in the selection state StateName, the default state when empty.
+type HyperCubeDef struct {
+	StateName        string        `json:"qStateName,omitempty"`
+	Dimensions       []NxDimension `json:"qDimensions"`
+	Measures         []NxMeasure   `json:"qMeasures"`
+	InitialDataFetch []NxPage      `json:"qInitialDataFetch"`
+	SuppressZero     bool          `json:"qSuppressZero,omitempty"`
+	SuppressMissing  bool          `json:"qSuppressMissing,omitempty"`
+	Mode             string        `json:"qMode,omitempty"`
+	// NoOfLeftDims is the number of dimensions on the left of a pivot, the others go on top
+	NoOfLeftDims        int  `json:"qNoOfLeftDims,omitempty"`
+	AlwaysFullyExpanded bool `json:"qAlwaysFullyExpanded,omitempty"`
+}
+
+// NewHyperCubeDef defines a straight table. Dimensions are field names or calculated
+// dimensions starting with "=", measures are expressions such as "Sum(Sales)".
+func NewHyperCubeDef(dimensions, measures []string) HyperCubeDef {
+	retval := HyperCubeDef{Dimensions: []NxDimension{}, Measures: []NxMeasure{}, InitialDataFetch: []NxPage{}, SuppressMissing: true, Mode: HYPERCUBE_MODE_STRAIGHT}
+	for _, dimension := range dimensions {
+		retval.Dimensions = append(retval.Dimensions, NxDimension{Def: NxInlineDimensionDef{FieldDefs: []string{dimension}}})
+	}
+	for _, measure := range measures {
+		retval.Measures = append(retval.Measures, NxMeasure{Def: NxInlineMeasureDef{Def: measure}})
+	}
+	return retval
+}
+
+// NewHyperCubeDefInState defines a straight table calculated in an alternate state.
+func NewHyperCubeDefInState(state string, dimensions, measures []string) HyperCubeDef {
+	retval := NewHyperCubeDef(dimensions, measures)
+	retval.StateName = state
+	return retval
+}
+
+// NxNum is a cell's numeric value. The engine sends "NaN" for cells without one,
+// which unmarshals as math.NaN().
+type NxNum float64
+
+func (n *NxNum) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*n = NxNum(math.NaN())
+		return nil
+	}
+	var f float64
+	err := json.Unmarshal(data, &f)
+	*n = NxNum(f)
+	return err
+}
+
+func (n NxNum) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(n)) || math.IsInf(float64(n), 0) {
+		return []byte(`"NaN"`), nil
+	}
+	return json.Marshal(float64(n))
+}
+
+// NxCell is a hypercube cell. State is the selection state, e.g. "O" for optional,
+// "S" selected or "X" excluded. ElemNumber identifies the field value, -2 for nulls.
+type NxCell struct {
+	Text       string `json:"qText"`
+	Num        NxNum  `json:"qNum"`
+	ElemNumber int    `json:"qElemNumber"`
+	State      string `json:"qState"`
+	IsNull     bool   `json:"qIsNull,omitempty"`
+}
+
+// IsNumeric is false for text only cells and nulls.
+func (c NxCell) IsNumeric() bool {
+	return !c.IsNull && !math.IsNaN(float64(c.Num))
+}
+
+type NxDataPage struct {
+	Matrix [][]NxCell `json:"qMatrix"`
+	Area   NxPage     `json:"qArea"`
+}
+
+type NxSize struct {
+	Cx int `json:"qcx"`
+	Cy int `json:"qcy"`
+}
+
+const (
+	DIMENSION_TYPE_DISCRETE  = "D"
+	DIMENSION_TYPE_NUMERIC   = "N"
+	DIMENSION_TYPE_TIMESTAMP = "T"
+)
+
+type NxDimensionInfo struct {
+	FallbackTitle string   `json:"qFallbackTitle"`
+	DimensionType string   `json:"qDimensionType,omitempty"`
+	Cardinal      int      `json:"qCardinal,omitempty"`
+	Tags          []string `json:"qTags,omitempty"`
+}
+
+type NxMeasureInfo struct {
+	FallbackTitle string `json:"qFallbackTitle"`
+	NumFormat     struct {
+		Type string `json:"qType,omitempty"`
+		Fmt  string `json:"qFmt,omitempty"`
+	} `json:"qNumFormat"`
+}
+
+type HyperCubeLayout struct {
+	Size          NxSize            `json:"qSize"`
+	DimensionInfo []NxDimensionInfo `json:"qDimensionInfo"`
+	MeasureInfo   []NxMeasureInfo   `json:"qMeasureInfo"`
+	DataPages     []NxDataPage      `json:"qDataPages"`
+}
+
+// GetHyperCubeData fetches pages of the hypercube at path, e.g. HYPERCUBE_PATH.
+func (o *GenericObject) GetHyperCubeData(path string, pages []NxPage) ([]NxDataPage, error) {
+	var result struct {
+		DataPages []NxDataPage `json:"qDataPages"`
+	}
+	err := o.call("GetHyperCubeData", []interface{}{path, pages}, &result)
+	return result.DataPages, err
+}
+
+// pivot and stack cell types, see NxDimCellType
+const (
+	DIM_CELL_VALUE  = "V"
+	DIM_CELL_EMPTY  = "E"
+	DIM_CELL_NORMAL = "N"
+	DIM_CELL_TOTAL  = "T"
+	DIM_CELL_OTHER  = "O"
+	DIM_CELL_AGGR   = "A"
+	DIM_CELL_PSEUDO = "P"
+	DIM_CELL_ROOT   = "R"
+	DIM_CELL_NULL   = "U"
+)
+
+// NxPivotDimensionCell is a dimension value on the left or top of a pivot page, with
+// the values nested under it in SubNodes. Up and Down count the cells of the node
+// outside the page.
+type NxPivotDimensionCell struct {
+	Text        string                 `json:"qText"`
+	ElemNo      int                    `json:"qElemNo"`
+	Value       NxNum                  `json:"qValue"`
+	CanExpand   bool                   `json:"qCanExpand,omitempty"`
+	CanCollapse bool                   `json:"qCanCollapse,omitempty"`
+	Type        string                 `json:"qType"`
+	Up          int                    `json:"qUp,omitempty"`
+	Down        int                    `json:"qDown,omitempty"`
+	SubNodes    []NxPivotDimensionCell `json:"qSubNodes,omitempty"`
+}
+
+// NxPivotValuePoint is a measure value in the data area of a pivot page.
+type NxPivotValuePoint struct {
+	Label string `json:"qLabel,omitempty"`
+	Text  string `json:"qText"`
+	Num   NxNum  `json:"qNum"`
+	Type  string `json:"qType"`
+}
+
+// NxPivotPage is a page of a pivot hypercube. Data is indexed by the row of the
+// left dimensions, then by the column of the top dimensions.
+type NxPivotPage struct {
+	Left []NxPivotDimensionCell `json:"qLeft"`
+	Top  []NxPivotDimensionCell `json:"qTop"`
+	Data [][]NxPivotValuePoint  `json:"qData"`
+	Area NxPage                 `json:"qArea"`
+}
+
+// NxStackedPivotCell is a node of a stacked hypercube, MaxPos and MinNeg are the
+// sums of the positive and negative values below it.
+type NxStackedPivotCell struct {
+	Text        string               `json:"qText"`
+	ElemNo      int                  `json:"qElemNo"`
+	Value       NxNum                `json:"qValue"`
+	CanExpand   bool                 `json:"qCanExpand,omitempty"`
+	CanCollapse bool                 `json:"qCanCollapse,omitempty"`
+	Type        string               `json:"qType"`
+	MaxPos      NxNum                `json:"qMaxPos"`
+	MinNeg      NxNum                `json:"qMinNeg"`
+	Up          int                  `json:"qUp,omitempty"`
+	Down        int                  `json:"qDown,omitempty"`
+	Row         int                  `json:"qRow"`
+	SubNodes    []NxStackedPivotCell `json:"qSubNodes,omitempty"`
+}
+
+type NxStackPage struct {
+	Data []NxStackedPivotCell `json:"qData"`
+	Area NxPage               `json:"qArea"`
+}
+
+// GetHyperCubePivotData fetches pages of a hypercube in HYPERCUBE_MODE_PIVOT.
+func (o *GenericObject) GetHyperCubePivotData(path string, pages []NxPage) ([]NxPivotPage, error) {
+	var result struct {
+		DataPages []NxPivotPage `json:"qDataPages"`
+	}
+	err := o.call("GetHyperCubePivotData", []interface{}{path, pages}, &result)
+	return result.DataPages, err
+}
+
+// GetHyperCubeStackData fetches pages of a hypercube in HYPERCUBE_MODE_STACKED.
+// maxNbrCells caps the cells returned, 0 leaves the engine's default of 10000.
+func (o *GenericObject) GetHyperCubeStackData(path string, pages []NxPage, maxNbrCells int) ([]NxStackPage, error) {
+	params := []interface{}{path, pages}
+	if maxNbrCells > 0 {
+		params = append(params, maxNbrCells)
+	}
+	var result struct {
+		DataPages []NxStackPage `json:"qDataPages"`
+	}
+	err := o.call("GetHyperCubeStackData", params, &result)
+	return result.DataPages, err
+}
+
+// HyperCube is a session object holding a hypercube, read it with Rows and Close it when done.
+type HyperCube struct {
+	Object *GenericObject
+	Layout HyperCubeLayout
+	doc    *Doc
+}
+
+// CreateHyperCube creates a session object for the definition and reads its layout.
+func (d *Doc) CreateHyperCube(def HyperCubeDef) (*HyperCube, error) {
+	properties := map[string]interface{}{
+		"qInfo":         NxInfo{Type: HYPERCUBE_OBJECT_TYPE},
+		"qHyperCubeDef": def,
+	}
+	object, err := d.CreateSessionObject(properties)
+	if err != nil {
+		return nil, err
+	}
+	var layout struct {
+		HyperCube HyperCubeLayout `json:"qHyperCube"`
+	}
+	err = object.GetLayout(&layout)
+	if err != nil {
+		d.DestroySessionObject(object.Id)
+		return nil, err
+	}
+	return &HyperCube{Object: object, Layout: layout.HyperCube, doc: d}, nil
+}
+
+// Columns are the dimension then measure titles, in the order of the row cells.
+func (h *HyperCube) Columns() []string {
+	retval := []string{}
+	for _, info := range h.Layout.DimensionInfo {
+		retval = append(retval, info.FallbackTitle)
+	}
+	for _, info := range h.Layout.MeasureInfo {
+		retval = append(retval, info.FallbackTitle)
+	}
+	return retval
+}
+
+// HyperCubeColumn describes a column for writers. Measures are numeric, dimensions
+// only when the engine reports them as numeric, dates and timestamps stay text.
+type HyperCubeColumn struct {
+	Name    string
+	Numeric bool
+}
+
+func (h *HyperCube) Schema() []HyperCubeColumn {
+	retval := []HyperCubeColumn{}
+	for _, info := range h.Layout.DimensionInfo {
+		retval = append(retval, HyperCubeColumn{Name: info.FallbackTitle, Numeric: info.DimensionType == DIMENSION_TYPE_NUMERIC})
+	}
+	for _, info := range h.Layout.MeasureInfo {
+		retval = append(retval, HyperCubeColumn{Name: info.FallbackTitle, Numeric: true})
+	}
+	return retval
+}
+
+func (h *HyperCube) Close() error {
+	_, err := h.doc.DestroySessionObject(h.Object.Id)
+	return err
+}
+
+// Rows iterates over the rows, fetching them a page at a time:
+//
+//	rows := cube.Rows()
+//	for rows.Next() {
+//		cells := rows.Row()
+//	}
+//	if rows.Err() != nil {
+func (h *HyperCube) Rows() *HyperCubeRows {
+	height := 0
+	if h.Layout.Size.Cx > 0 {
+		height = MAX_PAGE_CELLS / h.Layout.Size.Cx
+		if height == 0 {
+			height = 1
+		}
+	}
+	return &HyperCubeRows{cube: h, height: height}
+}
+
+type HyperCubeRows struct {
+	cube   *HyperCube
+	height int
+	top    int
+	page   [][]NxCell
+	row    []NxCell
+	err    error
+}
+
+// Next advances to the next row, false when the rows are exhausted or a fetch failed.
+func (r *HyperCubeRows) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	if len(r.page) == 0 {
+		size := r.cube.Layout.Size
+		if r.height == 0 || r.top >= size.Cy {
+			r.row = nil
+			return false
+		}
+		height := r.height
+		if r.top+height > size.Cy {
+			height = size.Cy - r.top
+		}
+		pages, err := r.cube.Object.GetHyperCubeData(HYPERCUBE_PATH, []NxPage{{Top: r.top, Left: 0, Height: height, Width: size.Cx}})
+		if err != nil {
+			r.err = err
+			return false
+		}
+		r.top += height
+		for _, page := range pages {
+			r.page = append(r.page, page.Matrix...)
+		}
+		if len(r.page) == 0 {
+			// the data shrank since the layout was read
+			r.top = size.Cy
+			r.row = nil
+			return false
+		}
+	}
+	r.row = r.page[0]
+	r.page = r.page[1:]
+	return true
+}
+
+func (r *HyperCubeRows) Row() []NxCell {
+	return r.row
+}
+
+func (r *HyperCubeRows) Err() error {
+	return r.err
+}
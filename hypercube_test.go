@@ -0,0 +1,215 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"fmt"
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"math"
+	"testing"
+)
+
+func openTestDoc(t *testing.T, server *enginetest.Server, name string) *glik.Doc {
+	api := server.API()
+	if err := api.OpenWebSocket(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { api.CloseWebSocket() })
+	doc, err := api.OpenDoc(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// serveCube scripts a hypercube layout of size rows by two columns, a text dimension
+// and a numeric measure, serving the data pages from GetHyperCubeData.
+func serveCube(server *enginetest.Server, rows *int, fetched *[]glik.NxPage) {
+	server.Handle("GenericObject.GetLayout", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qLayout": map[string]interface{}{"qHyperCube": map[string]interface{}{
+			"qSize":          glik.NxSize{Cx: 2, Cy: *rows},
+			"qDimensionInfo": []glik.NxDimensionInfo{{FallbackTitle: "Region"}},
+			"qMeasureInfo":   []glik.NxMeasureInfo{{FallbackTitle: "Sum(Sales)"}},
+		}}}, nil
+	})
+	server.Handle("GetHyperCubeData", func(call *enginetest.Call) (interface{}, error) {
+		var pages []glik.NxPage
+		if err := call.Arg(1, "qPages", &pages); err != nil {
+			return nil, err
+		}
+		page := pages[0]
+		if page.Height*page.Width > glik.MAX_PAGE_CELLS {
+			return nil, &enginetest.Error{Code: enginetest.LOCERR_GENERIC_INVALID_PARAMETERS, Message: "Page too large"}
+		}
+		*fetched = append(*fetched, page)
+		matrix := [][]glik.NxCell{}
+		for row := page.Top; row < page.Top+page.Height && row < *rows; row++ {
+			matrix = append(matrix, []glik.NxCell{
+				{Text: fmt.Sprint("r", row), Num: glik.NxNum(math.NaN()), ElemNumber: row, State: glik.STATE_OPTION},
+				{Text: "1.5", Num: 1.5, ElemNumber: 0, State: glik.STATE_LOCKED},
+			})
+		}
+		return map[string]interface{}{"qDataPages": []glik.NxDataPage{{Matrix: matrix, Area: page}}}, nil
+	})
+}
+
+func TestHyperCubeRowsPaging(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	rows := 12345
+	fetched := []glik.NxPage{}
+	serveCube(server, &rows, &fetched)
+	doc := openTestDoc(t, server, "Sales.qvf")
+	cube, err := doc.CreateHyperCube(glik.NewHyperCubeDef([]string{"Region"}, []string{"Sum(Sales)"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if columns := cube.Columns(); len(columns) != 2 || columns[0] != "Region" || columns[1] != "Sum(Sales)" {
+		t.Errorf("got columns %v", columns)
+	}
+	n := 0
+	iterator := cube.Rows()
+	for iterator.Next() {
+		row := iterator.Row()
+		if row[0].IsNumeric() || !row[1].IsNumeric() || row[0].ElemNumber != n || float64(row[1].Num) != 1.5 {
+			t.Fatalf("row %v: got %+v", n, row)
+		}
+		n++
+	}
+	if iterator.Err() != nil || n != rows {
+		t.Fatalf("got %v rows, %v", n, iterator.Err())
+	}
+	want := []glik.NxPage{{Top: 0, Height: 5000, Width: 2}, {Top: 5000, Height: 5000, Width: 2}, {Top: 10000, Height: 2345, Width: 2}}
+	if fmt.Sprint(fetched) != fmt.Sprint(want) {
+		t.Errorf("fetched %v, want %v", fetched, want)
+	}
+	if err := cube.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.GetObject(cube.Object.Id); err != glik.ErrDoesNotExist {
+		t.Errorf("got %v for the closed cube", err)
+	}
+}
+
+func TestHyperCubeRowsShrinking(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	rows := 7000
+	fetched := []glik.NxPage{}
+	serveCube(server, &rows, &fetched)
+	doc := openTestDoc(t, server, "Sales.qvf")
+	cube, err := doc.CreateHyperCube(glik.NewHyperCubeDef([]string{"Region"}, []string{"Sum(Sales)"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cube.Close()
+	// the data shrinks to nothing after the layout was read
+	rows = 0
+	iterator := cube.Rows()
+	if iterator.Next() || iterator.Err() != nil {
+		t.Errorf("got a row from an empty cube, %v", iterator.Err())
+	}
+}
+
+func TestHyperCubeRowsError(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	rows := 10
+	fetched := []glik.NxPage{}
+	serveCube(server, &rows, &fetched)
+	server.Handle("GetHyperCubeData", func(call *enginetest.Call) (interface{}, error) {
+		return nil, &enginetest.Error{Code: enginetest.LOCERR_GENERIC_INVALID_PARAMETERS, Message: "Invalid parameters"}
+	})
+	doc := openTestDoc(t, server, "Sales.qvf")
+	cube, err := doc.CreateHyperCube(glik.NewHyperCubeDef([]string{"Region"}, []string{"Sum(Sales)"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cube.Close()
+	iterator := cube.Rows()
+	if iterator.Next() || iterator.Err() == nil {
+		t.Error("expected the fetch error")
+	}
+}
+
+func TestPivotAndStackData(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	server.Handle("GetHyperCubePivotData", func(call *enginetest.Call) (interface{}, error) {
+		var path string
+		if err := call.Arg(0, "qPath", &path); err != nil || path != glik.HYPERCUBE_PATH {
+			return nil, &enginetest.Error{Code: enginetest.LOCERR_GENERIC_INVALID_PARAMETERS, Parameter: path}
+		}
+		return map[string]interface{}{"qDataPages": []map[string]interface{}{{
+			"qLeft": []map[string]interface{}{{"qText": "North", "qElemNo": 0, "qValue": "NaN", "qType": "N", "qCanCollapse": true,
+				"qSubNodes": []map[string]interface{}{{"qText": "2016", "qElemNo": 1, "qValue": 2016, "qType": "N"}}}},
+			"qTop":  []map[string]interface{}{{"qText": "Sum(Sales)", "qElemNo": 0, "qValue": "NaN", "qType": "P"}},
+			"qData": [][]map[string]interface{}{{{"qText": "12", "qNum": 12, "qType": "V"}}},
+			"qArea": glik.NxPage{Width: 1, Height: 1},
+		}}}, nil
+	})
+	var stackParams []interface{}
+	server.Handle("GetHyperCubeStackData", func(call *enginetest.Call) (interface{}, error) {
+		stackParams = nil
+		for i := 0; call.HasArg(i, ""); i++ {
+			var param interface{}
+			call.Arg(i, "", &param)
+			stackParams = append(stackParams, param)
+		}
+		return map[string]interface{}{"qDataPages": []map[string]interface{}{{
+			"qData": []map[string]interface{}{{"qText": "", "qElemNo": -1, "qValue": "NaN", "qType": "R", "qMaxPos": 12, "qMinNeg": -3, "qRow": 0,
+				"qSubNodes": []map[string]interface{}{{"qText": "North", "qElemNo": 0, "qValue": 9, "qType": "N", "qMaxPos": 12, "qMinNeg": -3, "qRow": 1}}}},
+			"qArea": glik.NxPage{Width: 1, Height: 2},
+		}}}, nil
+	})
+	doc := openTestDoc(t, server, "Sales.qvf")
+	def := glik.NewHyperCubeDef([]string{"Region", "Year"}, []string{"Sum(Sales)"})
+	def.Mode = glik.HYPERCUBE_MODE_PIVOT
+	def.NoOfLeftDims = 2
+	object, err := doc.CreateSessionObject(map[string]interface{}{"qInfo": glik.NxInfo{Type: glik.HYPERCUBE_OBJECT_TYPE}, "qHyperCubeDef": def})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pivot, err := object.GetHyperCubePivotData(glik.HYPERCUBE_PATH, []glik.NxPage{{Width: 1, Height: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pivot) != 1 || len(pivot[0].Left) != 1 || len(pivot[0].Data) != 1 {
+		t.Fatalf("got %+v", pivot)
+	}
+	left := pivot[0].Left[0]
+	if left.Text != "North" || !math.IsNaN(float64(left.Value)) || !left.CanCollapse || len(left.SubNodes) != 1 || float64(left.SubNodes[0].Value) != 2016 {
+		t.Errorf("got left %+v", left)
+	}
+	if pivot[0].Top[0].Type != glik.DIM_CELL_PSEUDO || pivot[0].Data[0][0].Type != glik.DIM_CELL_VALUE || float64(pivot[0].Data[0][0].Num) != 12 {
+		t.Errorf("got %+v", pivot[0])
+	}
+	stack, err := object.GetHyperCubeStackData(glik.HYPERCUBE_PATH, []glik.NxPage{{Width: 1, Height: 2}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stackParams) != 2 {
+		t.Errorf("sent %v params without a cell cap", stackParams)
+	}
+	root := stack[0].Data[0]
+	if root.Type != glik.DIM_CELL_ROOT || float64(root.MaxPos) != 12 || float64(root.MinNeg) != -3 || root.SubNodes[0].Row != 1 {
+		t.Errorf("got stack %+v", stack)
+	}
+	if _, err := object.GetHyperCubeStackData(glik.HYPERCUBE_PATH, nil, 500); err != nil || len(stackParams) != 3 || stackParams[2] != float64(500) {
+		t.Errorf("sent %v, %v", stackParams, err)
+	}
+}
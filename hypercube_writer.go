@@ -0,0 +1,159 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+)
+
+// RowWriter receives the rows of a hypercube, see HyperCube.WriteRows. The parquet
+// subpackage has a Parquet RowWriter.
+type RowWriter interface {
+	WriteHeader(columns []HyperCubeColumn) error
+	WriteRow(row []NxCell) error
+	// Close flushes buffered rows, it does not close the underlying writer
+	Close() error
+}
+
+// WriteRows streams every row of the hypercube to w and closes it, returning the
+// number of rows written.
+func (h *HyperCube) WriteRows(w RowWriter) (int, error) {
+	err := w.WriteHeader(h.Schema())
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	rows := h.Rows()
+	for rows.Next() {
+		err = w.WriteRow(rows.Row())
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	if rows.Err() != nil {
+		return count, rows.Err()
+	}
+	return count, w.Close()
+}
+
+// CellValue is the value of the cell for a column, a float64 for numeric columns,
+// a string otherwise, or nil for nulls and numeric columns without a number.
+func CellValue(column HyperCubeColumn, cell NxCell) interface{} {
+	if cell.IsNull {
+		return nil
+	}
+	if column.Numeric {
+		if !cell.IsNumeric() || math.IsInf(float64(cell.Num), 0) {
+			return nil
+		}
+		return float64(cell.Num)
+	}
+	return cell.Text
+}
+
+type csvRowWriter struct {
+	w       *csv.Writer
+	columns []HyperCubeColumn
+	record  []string
+}
+
+// NewCSVWriter writes a header line of column names, then a line per row. Numbers are
+// written unformatted and nulls as empty fields.
+func NewCSVWriter(w io.Writer) RowWriter {
+	return &csvRowWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvRowWriter) WriteHeader(columns []HyperCubeColumn) error {
+	c.columns = columns
+	c.record = make([]string, len(columns))
+	for i, column := range columns {
+		c.record[i] = column.Name
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvRowWriter) WriteRow(row []NxCell) error {
+	for i := range c.record {
+		c.record[i] = ""
+		if i >= len(row) {
+			continue
+		}
+		switch value := CellValue(c.columns[i], row[i]).(type) {
+		case float64:
+			c.record[i] = strconv.FormatFloat(value, 'f', -1, 64)
+		case string:
+			c.record[i] = value
+		}
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvRowWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonRowWriter struct {
+	w       *bufio.Writer
+	columns []HyperCubeColumn
+	keys    [][]byte
+}
+
+// NewNDJSONWriter writes a JSON object per line, keyed by column name in column order.
+func NewNDJSONWriter(w io.Writer) RowWriter {
+	return &ndjsonRowWriter{w: bufio.NewWriter(w)}
+}
+
+func (n *ndjsonRowWriter) WriteHeader(columns []HyperCubeColumn) error {
+	n.columns = columns
+	n.keys = make([][]byte, len(columns))
+	for i, column := range columns {
+		key, err := json.Marshal(column.Name)
+		if err != nil {
+			return err
+		}
+		n.keys[i] = key
+	}
+	return nil
+}
+
+func (n *ndjsonRowWriter) WriteRow(row []NxCell) error {
+	n.w.WriteByte('{')
+	for i, key := range n.keys {
+		if i > 0 {
+			n.w.WriteByte(',')
+		}
+		n.w.Write(key)
+		n.w.WriteByte(':')
+		var value interface{}
+		if i < len(row) {
+			value = CellValue(n.columns[i], row[i])
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		n.w.Write(data)
+	}
+	n.w.WriteByte('}')
+	return n.w.WriteByte('\n')
+}
+
+func (n *ndjsonRowWriter) Close() error {
+	return n.w.Flush()
+}
@@ -0,0 +1,140 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"github.com/mattbaird/glik/parquet"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+	"math"
+	"testing"
+)
+
+// writerCube serves a three row cube of a text dimension, a numeric dimension and a
+// measure, with a null, a text only measure value and a missing number.
+func writerCube(t *testing.T) *glik.HyperCube {
+	server := enginetest.NewServer()
+	t.Cleanup(server.Close)
+	server.AddDoc("Sales.qvf", "")
+	server.Handle("GenericObject.GetLayout", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qLayout": map[string]interface{}{"qHyperCube": map[string]interface{}{
+			"qSize":          glik.NxSize{Cx: 3, Cy: 3},
+			"qDimensionInfo": []glik.NxDimensionInfo{{FallbackTitle: `Region, "x"`}, {FallbackTitle: "Year", DimensionType: glik.DIMENSION_TYPE_NUMERIC}},
+			"qMeasureInfo":   []glik.NxMeasureInfo{{FallbackTitle: "Sum(Sales)"}},
+		}}}, nil
+	})
+	nan := glik.NxNum(math.NaN())
+	server.Handle("GetHyperCubeData", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qDataPages": []glik.NxDataPage{{Matrix: [][]glik.NxCell{
+			{{Text: "North", Num: nan}, {Text: "2016", Num: 2016}, {Text: "1,234.5", Num: 1234.5}},
+			{{Text: "South\nEast", Num: nan}, {Text: "2017", Num: 2017}, {Text: "-", Num: nan}},
+			{{Text: "-", Num: nan, IsNull: true, ElemNumber: -2}, {Text: "-", Num: nan, IsNull: true, ElemNumber: -2}, {Text: "0", Num: 0}},
+		}}}}, nil
+	})
+	doc := openTestDoc(t, server, "Sales.qvf")
+	cube, err := doc.CreateHyperCube(glik.NewHyperCubeDef([]string{"Region", "Year"}, []string{"Sum(Sales)"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cube
+}
+
+func TestWriteRowsCSV(t *testing.T) {
+	cube := writerCube(t)
+	var out bytes.Buffer
+	count, err := cube.WriteRows(glik.NewCSVWriter(&out))
+	if err != nil || count != 3 {
+		t.Fatalf("got %v, %v", count, err)
+	}
+	want := "\"Region, \"\"x\"\"\",Year,Sum(Sales)\nNorth,2016,1234.5\n\"South\nEast\",2017,\n,,0\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestWriteRowsNDJSON(t *testing.T) {
+	cube := writerCube(t)
+	var out bytes.Buffer
+	count, err := cube.WriteRows(glik.NewNDJSONWriter(&out))
+	if err != nil || count != 3 {
+		t.Fatalf("got %v, %v", count, err)
+	}
+	want := `{"Region, \"x\"":"North","Year":2016,"Sum(Sales)":1234.5}
+{"Region, \"x\"":"South\nEast","Year":2017,"Sum(Sales)":null}
+{"Region, \"x\"":null,"Year":null,"Sum(Sales)":0}
+`
+	if out.String() != want {
+		t.Errorf("got %s, want %s", out.String(), want)
+	}
+}
+
+func TestWriteRowsParquet(t *testing.T) {
+	cube := writerCube(t)
+	var out bytes.Buffer
+	count, err := cube.WriteRows(parquet.NewWriter(&out))
+	if err != nil || count != 3 {
+		t.Fatalf("got %v, %v", count, err)
+	}
+	// the reader starts from the footer, which is only written on close
+	file, err := buffer.NewBufferFile(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := reader.NewParquetColumnReader(file, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+	if pr.GetNumRows() != 3 {
+		t.Errorf("got %v rows", pr.GetNumRows())
+	}
+	columns := []string{}
+	for _, element := range pr.Footer.Schema[1:] {
+		columns = append(columns, element.GetName()+" "+element.GetType().String())
+	}
+	if fmt.Sprint(columns) != "[Region___x_ BYTE_ARRAY Year DOUBLE Sum_Sales_ DOUBLE]" {
+		t.Errorf("got columns %v", columns)
+	}
+	want := []string{"[North South\nEast <nil>]", "[2016 2017 <nil>]", "[1234.5 <nil> 0]"}
+	for i := range want {
+		values, _, _, err := pr.ReadColumnByIndex(int64(i), 3)
+		if err != nil || fmt.Sprint(values) != want[i] {
+			t.Errorf("column %v: got %v, %v", i, values, err)
+		}
+	}
+}
+
+func TestCellValue(t *testing.T) {
+	numeric := glik.HyperCubeColumn{Name: "n", Numeric: true}
+	text := glik.HyperCubeColumn{Name: "t"}
+	tests := []struct {
+		column glik.HyperCubeColumn
+		cell   glik.NxCell
+		want   interface{}
+	}{
+		{numeric, glik.NxCell{Text: "1.5", Num: 1.5}, 1.5},
+		{numeric, glik.NxCell{Text: "x", Num: glik.NxNum(math.NaN())}, nil},
+		{numeric, glik.NxCell{Text: "inf", Num: glik.NxNum(math.Inf(1))}, nil},
+		{numeric, glik.NxCell{Text: "-", IsNull: true}, nil},
+		{text, glik.NxCell{Text: "1.5", Num: 1.5}, "1.5"},
+		{text, glik.NxCell{Text: "-", IsNull: true}, nil},
+	}
+	for _, test := range tests {
+		if got := glik.CellValue(test.column, test.cell); got != test.want {
+			t.Errorf("%+v in %+v: got %v, want %v", test.cell, test.column, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"encoding/json"
+)
+
+const DIMENSION_TYPE = "dimension"
+const MEASURE_TYPE = "measure"
+const DIMENSION_LIST_TYPE = "DimensionList"
+const MEASURE_LIST_TYPE = "MeasureList"
+
+// qGrouping of dimensions and measures
+const (
+	GROUPING_NONE      = "N"
+	GROUPING_DRILLDOWN = "H"
+	GROUPING_CYCLIC    = "C"
+)
+
+// MasterItemMeta is the qMetaDef of a master dimension or measure, shown in the library.
+type MasterItemMeta struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+type NxLibraryDimensionDef struct {
+	Grouping        string   `json:"qGrouping"`
+	FieldDefs       []string `json:"qFieldDefs"`
+	FieldLabels     []string `json:"qFieldLabels"`
+	LabelExpression string   `json:"qLabelExpression"`
+}
+
+type GenericDimensionProperties struct {
+	Info    NxInfo                `json:"qInfo"`
+	Dim     NxLibraryDimensionDef `json:"qDim"`
+	MetaDef MasterItemMeta        `json:"qMetaDef"`
+}
+
+// NewDimensionProperties defines a single field master dimension, id may be empty
+// for the engine to choose one.
+func NewDimensionProperties(id, title, field string) GenericDimensionProperties {
+	return GenericDimensionProperties{
+		Info:    NxInfo{Id: id, Type: DIMENSION_TYPE},
+		Dim:     NxLibraryDimensionDef{Grouping: GROUPING_NONE, FieldDefs: []string{field}, FieldLabels: []string{title}},
+		MetaDef: MasterItemMeta{Title: title, Tags: []string{}},
+	}
+}
+
+type NxLibraryMeasureDef struct {
+	Label            string   `json:"qLabel"`
+	Def              string   `json:"qDef"`
+	Grouping         string   `json:"qGrouping"`
+	Expressions      []string `json:"qExpressions"`
+	ActiveExpression int      `json:"qActiveExpression"`
+	LabelExpression  string   `json:"qLabelExpression"`
+}
+
+type GenericMeasureProperties struct {
+	Info    NxInfo              `json:"qInfo"`
+	Measure NxLibraryMeasureDef `json:"qMeasure"`
+	MetaDef MasterItemMeta      `json:"qMetaDef"`
+}
+
+// NewMeasureProperties defines a master measure, id may be empty for the engine to choose one.
+func NewMeasureProperties(id, title, expression string) GenericMeasureProperties {
+	return GenericMeasureProperties{
+		Info:    NxInfo{Id: id, Type: MEASURE_TYPE},
+		Measure: NxLibraryMeasureDef{Label: title, Def: expression, Grouping: GROUPING_NONE, Expressions: []string{}},
+		MetaDef: MasterItemMeta{Title: title, Tags: []string{}},
+	}
+}
+
+// GenericDimension is a master dimension, see the GenericDimension class of the engine api.
+type GenericDimension struct {
+	api    *API
+	Handle int
+	Id     string
+}
+
+// GenericMeasure is a master measure, see the GenericMeasure class of the engine api.
+type GenericMeasure struct {
+	api    *API
+	Handle int
+	Id     string
+}
+
+// createItem calls a Create method taking properties and answering with the new
+// item's qInfo and handle, as CreateDimension and CreateBookmark do.
+func (d *Doc) createItem(method string, properties interface{}) (Return, string, error) {
+	var result struct {
+		Info   NxInfo `json:"qInfo"`
+		Return Return `json:"qReturn"`
+	}
+	err := d.call(method, []interface{}{properties}, &result)
+	if err != nil {
+		return result.Return, "", err
+	}
+	id := result.Info.Id
+	if len(result.Return.GenericId) > 0 {
+		id = result.Return.GenericId
+	}
+	return result.Return, id, nil
+}
+
+func (d *Doc) destroyItem(method, id string) (bool, error) {
+	var result struct {
+		Success bool `json:"qSuccess"`
+	}
+	err := d.call(method, []interface{}{id}, &result)
+	return result.Success, err
+}
+
+func (d *Doc) cloneItem(method, id string) (string, error) {
+	var result struct {
+		CloneId string `json:"qCloneId"`
+	}
+	err := d.call(method, []interface{}{id}, &result)
+	return result.CloneId, err
+}
+
+// mergeProperties merges the JSON of typed properties over an item's current ones: the
+// keys typed has replace the current values, objects merge key by key and the keys
+// typed does not know, such as a dimension's coloring, are kept.
+func mergeProperties(call func(method string, params interface{}, result interface{}) error, typed interface{}) (map[string]interface{}, error) {
+	var current struct {
+		Properties map[string]interface{} `json:"qProp"`
+	}
+	err := call("GetProperties", nil, &current)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(typed)
+	if err != nil {
+		return nil, err
+	}
+	var retval map[string]interface{}
+	err = json.Unmarshal(data, &retval)
+	if err != nil {
+		return nil, err
+	}
+	if current.Properties == nil {
+		return retval, nil
+	}
+	mergeJSON(current.Properties, retval)
+	return current.Properties, nil
+}
+
+func mergeJSON(dst, src map[string]interface{}) {
+	for key, value := range src {
+		from, ok := value.(map[string]interface{})
+		to, isMap := dst[key].(map[string]interface{})
+		if ok && isMap {
+			mergeJSON(to, from)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+func (d *Doc) CreateDimension(properties GenericDimensionProperties) (*GenericDimension, error) {
+	handle, id, err := d.createItem("CreateDimension", properties)
+	if err != nil {
+		return nil, err
+	}
+	return &GenericDimension{api: d.api, Handle: handle.Handle, Id: id}, nil
+}
+
+// GetDimension returns ErrDoesNotExist if the app has no master dimension with the id.
+func (d *Doc) GetDimension(id string) (*GenericDimension, error) {
+	handle, err := d.api.callForHandle(d.Handle, "GetDimension", []interface{}{id})
+	if err != nil {
+		return nil, err
+	}
+	return &GenericDimension{api: d.api, Handle: handle.Handle, Id: id}, nil
+}
+
+func (d *Doc) DestroyDimension(id string) (bool, error) {
+	return d.destroyItem("DestroyDimension", id)
+}
+
+// CloneDimension copies a master dimension, returning the id of the copy.
+func (d *Doc) CloneDimension(id string) (string, error) {
+	return d.cloneItem("CloneDimension", id)
+}
+
+func (d *Doc) CreateMeasure(properties GenericMeasureProperties) (*GenericMeasure, error) {
+	handle, id, err := d.createItem("CreateMeasure", properties)
+	if err != nil {
+		return nil, err
+	}
+	return &GenericMeasure{api: d.api, Handle: handle.Handle, Id: id}, nil
+}
+
+// GetMeasure returns ErrDoesNotExist if the app has no master measure with the id.
+func (d *Doc) GetMeasure(id string) (*GenericMeasure, error) {
+	handle, err := d.api.callForHandle(d.Handle, "GetMeasure", []interface{}{id})
+	if err != nil {
+		return nil, err
+	}
+	return &GenericMeasure{api: d.api, Handle: handle.Handle, Id: id}, nil
+}
+
+func (d *Doc) DestroyMeasure(id string) (bool, error) {
+	return d.destroyItem("DestroyMeasure", id)
+}
+
+// CloneMeasure copies a master measure, returning the id of the copy.
+func (d *Doc) CloneMeasure(id string) (string, error) {
+	return d.cloneItem("CloneMeasure", id)
+}
+
+// MasterItem is a dimension or measure as listed by Dimensions and Measures.
+type MasterItem struct {
+	Id          string
+	Type        string
+	Title       string
+	Description string
+	Tags        []string
+}
+
+// Dimensions lists the app's master dimensions, through a session dimension list object.
+func (d *Doc) Dimensions() ([]MasterItem, error) {
+	return d.masterItems(DIMENSION_LIST_TYPE, "qDimensionListDef", "qDimensionList", DIMENSION_TYPE)
+}
+
+// Measures lists the app's master measures, through a session measure list object.
+func (d *Doc) Measures() ([]MasterItem, error) {
+	return d.masterItems(MEASURE_LIST_TYPE, "qMeasureListDef", "qMeasureList", MEASURE_TYPE)
+}
+
+func (d *Doc) masterItems(listType, defKey, layoutKey, itemType string) ([]MasterItem, error) {
+	properties := map[string]interface{}{
+		"qInfo": NxInfo{Type: listType},
+		defKey: map[string]interface{}{
+			"qType": itemType,
+			"qData": map[string]string{"title": "/qMetaDef/title", "description": "/qMetaDef/description", "tags": "/qMetaDef/tags"},
+		},
+	}
+	object, err := d.CreateSessionObject(properties)
+	if err != nil {
+		return nil, err
+	}
+	defer d.DestroySessionObject(object.Id)
+	type item struct {
+		Info NxInfo `json:"qInfo"`
+		Data struct {
+			Title       string   `json:"title"`
+			Description string   `json:"description"`
+			Tags        []string `json:"tags"`
+		} `json:"qData"`
+	}
+	var layout map[string]struct {
+		Items []item `json:"qItems"`
+	}
+	err = object.GetLayout(&layout)
+	if err != nil {
+		return nil, err
+	}
+	retval := []MasterItem{}
+	for _, item := range layout[layoutKey].Items {
+		retval = append(retval, MasterItem{Id: item.Info.Id, Type: item.Info.Type, Title: item.Data.Title, Description: item.Data.Description, Tags: item.Data.Tags})
+	}
+	return retval, nil
+}
+
+func (g *GenericDimension) call(method string, params interface{}, result interface{}) error {
+	return g.api.call(g.Handle, method, params, result)
+}
+
+func (g *GenericDimension) GetProperties() (GenericDimensionProperties, error) {
+	var result struct {
+		Properties GenericDimensionProperties `json:"qProp"`
+	}
+	err := g.call("GetProperties", nil, &result)
+	return result.Properties, err
+}
+
+// SetProperties updates the dimension, merging properties over the current ones so
+// the properties GenericDimensionProperties does not hold are kept.
+func (g *GenericDimension) SetProperties(properties GenericDimensionProperties) error {
+	merged, err := mergeProperties(g.call, properties)
+	if err != nil {
+		return err
+	}
+	return g.call("SetProperties", []interface{}{merged}, nil)
+}
+
+// GetLayout unmarshals the dimension's layout into layout.
+func (g *GenericDimension) GetLayout(layout interface{}) error {
+	result := struct {
+		Layout interface{} `json:"qLayout"`
+	}{layout}
+	return g.call("GetLayout", nil, &result)
+}
+
+func (g *GenericDimension) Publish() error {
+	return g.call("Publish", nil, nil)
+}
+
+func (g *GenericDimension) UnPublish() error {
+	return g.call("UnPublish", nil, nil)
+}
+
+func (g *GenericMeasure) call(method string, params interface{}, result interface{}) error {
+	return g.api.call(g.Handle, method, params, result)
+}
+
+func (g *GenericMeasure) GetProperties() (GenericMeasureProperties, error) {
+	var result struct {
+		Properties GenericMeasureProperties `json:"qProp"`
+	}
+	err := g.call("GetProperties", nil, &result)
+	return result.Properties, err
+}
+
+// SetProperties updates the measure, merging properties over the current ones so
+// the properties GenericMeasureProperties does not hold are kept.
+func (g *GenericMeasure) SetProperties(properties GenericMeasureProperties) error {
+	merged, err := mergeProperties(g.call, properties)
+	if err != nil {
+		return err
+	}
+	return g.call("SetProperties", []interface{}{merged}, nil)
+}
+
+// GetLayout unmarshals the measure's layout into layout.
+func (g *GenericMeasure) GetLayout(layout interface{}) error {
+	result := struct {
+		Layout interface{} `json:"qLayout"`
+	}{layout}
+	return g.call("GetLayout", nil, &result)
+}
+
+func (g *GenericMeasure) Publish() error {
+	return g.call("Publish", nil, nil)
+}
+
+func (g *GenericMeasure) UnPublish() error {
+	return g.call("UnPublish", nil, nil)
+}
+
+func (g *GenericDimension) ApplyPatches(patches []NxPatch) error {
+	return g.call("ApplyPatches", []interface{}{patches}, nil)
+}
+
+func (g *GenericMeasure) ApplyPatches(patches []NxPatch) error {
+	return g.call("ApplyPatches", []interface{}{patches}, nil)
+}
@@ -0,0 +1,112 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"fmt"
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"testing"
+)
+
+// serveClientProperties scripts the item's properties to hold properties set by the
+// Sense client that the typed property structs do not know.
+func serveClientProperties(server *enginetest.Server, handleType, defKey string) {
+	server.Handle(handleType+".GetProperties", func(call *enginetest.Call) (interface{}, error) {
+		properties := call.Object().Properties
+		if _, ok := properties["coloring"]; !ok {
+			properties["coloring"] = map[string]interface{}{"baseColor": "#ff0000"}
+			properties[defKey].(map[string]interface{})["numFormat"] = "#,##0"
+			properties["qMetaDef"].(map[string]interface{})["owner"] = "admin"
+		}
+		return map[string]interface{}{"qProp": properties}, nil
+	})
+}
+
+func TestDimensionRoundTrip(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	serveClientProperties(server, "GenericDimension", "qDim")
+	doc := openTestDoc(t, server, "Sales.qvf")
+	properties := glik.NewDimensionProperties("region", "Region", "Region")
+	properties.MetaDef.Tags = []string{"geo"}
+	properties.Dim.LabelExpression = "='Region'"
+	if _, err := doc.CreateDimension(properties); err != nil {
+		t.Fatal(err)
+	}
+	items, err := doc.Dimensions()
+	if err != nil || len(items) != 1 || items[0].Id != "region" || items[0].Title != "Region" || fmt.Sprint(items[0].Tags) != "[geo]" {
+		t.Fatalf("got %+v, %v", items, err)
+	}
+	dimension, err := doc.GetDimension("region")
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties, err = dimension.GetProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties.MetaDef.Title = "Sales Region"
+	properties.Dim.LabelExpression = ""
+	if err := dimension.SetProperties(properties); err != nil {
+		t.Fatal(err)
+	}
+	// the fake engine's layouts are the stored properties
+	var raw map[string]map[string]interface{}
+	if err := dimension.GetLayout(&raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw["coloring"]["baseColor"] != "#ff0000" || raw["qDim"]["numFormat"] != "#,##0" || raw["qMetaDef"]["owner"] != "admin" {
+		t.Errorf("lost the client properties: %v", raw)
+	}
+	if raw["qMetaDef"]["title"] != "Sales Region" || raw["qDim"]["qLabelExpression"] != "" {
+		t.Errorf("did not update: %v", raw)
+	}
+	if ok, err := doc.DestroyDimension("region"); err != nil || !ok {
+		t.Errorf("got %v, %v", ok, err)
+	}
+	if _, err := doc.GetDimension("region"); err != glik.ErrDoesNotExist {
+		t.Errorf("got %v for a destroyed dimension", err)
+	}
+}
+
+func TestMeasureRoundTrip(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	serveClientProperties(server, "GenericMeasure", "qMeasure")
+	doc := openTestDoc(t, server, "Sales.qvf")
+	measure, err := doc.CreateMeasure(glik.NewMeasureProperties("", "Revenue", "Sum(Sales)"))
+	if err != nil || len(measure.Id) == 0 {
+		t.Fatalf("got %+v, %v", measure, err)
+	}
+	items, err := doc.Measures()
+	if err != nil || len(items) != 1 || items[0].Id != measure.Id || items[0].Type != glik.MEASURE_TYPE {
+		t.Fatalf("got %+v, %v", items, err)
+	}
+	properties, err := measure.GetProperties()
+	if err != nil || properties.Measure.Def != "Sum(Sales)" {
+		t.Fatalf("got %+v, %v", properties, err)
+	}
+	properties.Measure.Def = "Sum(Sales)-Sum(Cost)"
+	if err := measure.SetProperties(properties); err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]map[string]interface{}
+	if err := measure.GetLayout(&raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw["coloring"]["baseColor"] != "#ff0000" || raw["qMeasure"]["numFormat"] != "#,##0" || raw["qMeasure"]["qDef"] != "Sum(Sales)-Sum(Cost)" {
+		t.Errorf("got %v", raw)
+	}
+}
@@ -23,6 +23,7 @@ import (
 var (
 	connectTimeOut   = time.Duration(30 * time.Second)
 	readWriteTimeout = time.Duration(30 * time.Second)
+	downloadTimeout  = time.Duration(10 * time.Minute)
 )
 
 const DEFAULT_SERVER = "192.168.99.5"
@@ -32,6 +33,7 @@ const DEFAULT_DIR = "WIN8-VBOX"
 const DEFAULT_QRS_PORT = 4242
 const DEFAULT_AUTH_PORT = 4243
 const DEFAULT_WEBSOCKET_PORT = 4747
+const DEFAULT_PROXY_PORT = 443
 
 type API struct {
 	Server              string
@@ -45,7 +47,14 @@ type API struct {
 	ClientCert          string
 	XrfKey              string
 	CertAuth            string
+	ProxyRouted         bool
+	ProxyPort           int
+	VirtualProxy        string
+	Origin              string
 	WebsocketConnection *websocket.Conn
+	engine              EngineConn
+	rpc                 *engineRpc
+	cassette            *Cassette
 }
 
 func DefaultApi() API {
@@ -96,9 +105,18 @@ func NewAPI(server string, directory, user string, qrsPort, authPort, websocketP
 	api.QrsPort = qrsPort
 	api.AuthPort = authPort
 	api.WebsocketPort = websocketPort
+	api.ProxyPort = DEFAULT_PROXY_PORT
 	return api
 }
 
+// UseProxy routes QRS and Engine traffic through the Qlik Proxy listening on port,
+// using the virtual proxy prefix (e.g. "hdr"). An empty prefix means the default virtual proxy.
+func (api *API) UseProxy(port int, prefix string) {
+	api.ProxyRouted = true
+	api.ProxyPort = port
+	api.VirtualProxy = strings.Trim(prefix, "/")
+}
+
 type About struct {
 	BuildVersion     string `json:"buildVersion,omitempty"`
 	BuildDate        string `json:"buildDate,omitempty"`
@@ -140,6 +158,12 @@ type Owner struct {
 	Id            string `json:"id,omitempty"`
 }
 
+// Tag is a repository tag, as the QRS returns it on the entities it tags.
+type Tag struct {
+	Id   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
 type Stream struct {
 	Name       string      `json:"name,omitempty"`
 	Id         string      `json:"id,omitempty"`
@@ -148,3 +172,16 @@ type Stream struct {
 
 type Privileges struct {
 }
+
+type ExportTicket struct {
+	Value string `json:"value,omitempty"`
+}
+
+type ReloadTask struct {
+	Id         string             `json:"id,omitempty"`
+	Name       string             `json:"name,omitempty"`
+	TaskType   int                `json:"taskType,omitempty"`
+	Enabled    bool               `json:"enabled,omitempty"`
+	App        *ApplicationResult `json:"app,omitempty"`
+	SchemaPath string             `json:"schemaPath,omitempty"`
+}
@@ -0,0 +1,149 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"encoding/json"
+)
+
+type NxInfo struct {
+	Id   string `json:"qId,omitempty"`
+	Type string `json:"qType"`
+}
+
+// GenericObject is an object of an app opened on the Engine websocket, see the
+// GenericObject class of the engine api.
+type GenericObject struct {
+	api    *API
+	Handle int
+	Id     string
+	Type   string
+}
+
+func (d *Doc) objectFor(handle Return, id string) *GenericObject {
+	if len(handle.GenericId) > 0 {
+		id = handle.GenericId
+	}
+	return &GenericObject{api: d.api, Handle: handle.Handle, Id: id, Type: handle.GenericType}
+}
+
+// CreateObject creates a persistent object from properties, which must hold a qInfo.
+func (d *Doc) CreateObject(properties interface{}) (*GenericObject, error) {
+	handle, err := d.api.callForHandle(d.Handle, "CreateObject", []interface{}{properties})
+	if err != nil {
+		return nil, err
+	}
+	return d.objectFor(handle, ""), nil
+}
+
+// CreateSessionObject creates an object that lives as long as the websocket session.
+func (d *Doc) CreateSessionObject(properties interface{}) (*GenericObject, error) {
+	handle, err := d.api.callForHandle(d.Handle, "CreateSessionObject", []interface{}{properties})
+	if err != nil {
+		return nil, err
+	}
+	return d.objectFor(handle, ""), nil
+}
+
+// GetObject returns ErrDoesNotExist if the app has no object with the id.
+func (d *Doc) GetObject(id string) (*GenericObject, error) {
+	handle, err := d.api.callForHandle(d.Handle, "GetObject", []interface{}{id})
+	if err != nil {
+		return nil, err
+	}
+	return d.objectFor(handle, id), nil
+}
+
+func (d *Doc) DestroyObject(id string) (bool, error) {
+	var result struct {
+		Success bool `json:"qSuccess"`
+	}
+	err := d.call("DestroyObject", []interface{}{id}, &result)
+	return result.Success, err
+}
+
+func (d *Doc) DestroySessionObject(id string) (bool, error) {
+	var result struct {
+		Success bool `json:"qSuccess"`
+	}
+	err := d.call("DestroySessionObject", []interface{}{id}, &result)
+	return result.Success, err
+}
+
+func (o *GenericObject) call(method string, params interface{}, result interface{}) error {
+	return o.api.call(o.Handle, method, params, result)
+}
+
+// GetLayout unmarshals the object's layout, its properties with the calculated data, into layout.
+func (o *GenericObject) GetLayout(layout interface{}) error {
+	result := struct {
+		Layout interface{} `json:"qLayout"`
+	}{layout}
+	return o.call("GetLayout", nil, &result)
+}
+
+// GetProperties unmarshals the object's properties into properties.
+func (o *GenericObject) GetProperties(properties interface{}) error {
+	result := struct {
+		Properties interface{} `json:"qProp"`
+	}{properties}
+	return o.call("GetProperties", nil, &result)
+}
+
+func (o *GenericObject) SetProperties(properties interface{}) error {
+	return o.call("SetProperties", []interface{}{properties}, nil)
+}
+
+func (o *GenericObject) GetInfo() (NxInfo, error) {
+	var result struct {
+		Info NxInfo `json:"qInfo"`
+	}
+	err := o.call("GetInfo", nil, &result)
+	return result.Info, err
+}
+
+// qOp of NxPatch
+const (
+	PATCH_ADD     = "add"
+	PATCH_REMOVE  = "remove"
+	PATCH_REPLACE = "replace"
+)
+
+// NxPatch changes a single property, Value is the JSON encoded new value.
+type NxPatch struct {
+	Op    string `json:"qOp"`
+	Path  string `json:"qPath"`
+	Value string `json:"qValue"`
+}
+
+// ReplacePatch builds a patch setting the property at path, e.g. "/qMetaDef/title", to value.
+func ReplacePatch(path string, value interface{}) (NxPatch, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return NxPatch{}, err
+	}
+	return NxPatch{Op: PATCH_REPLACE, Path: path, Value: string(data)}, nil
+}
+
+// AddPatch builds a patch adding a property the object does not have yet, replace
+// patches only change existing properties.
+func AddPatch(path string, value interface{}) (NxPatch, error) {
+	patch, err := ReplacePatch(path, value)
+	patch.Op = PATCH_ADD
+	return patch, err
+}
+
+// ApplyPatches changes only the patched properties. Soft patches last for the session
+// and are not saved with the app, master items and variables have no soft patches.
+func (o *GenericObject) ApplyPatches(patches []NxPatch, softPatch bool) error {
+	return o.call("ApplyPatches", []interface{}{patches, softPatch}, nil)
+}
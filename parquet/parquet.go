@@ -0,0 +1,99 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package parquet writes hypercubes as Parquet files. It is kept out of glik so
+// only programs writing Parquet pull in the Parquet dependencies.
+//
+//	file, err := os.Create("sales.parquet")
+//	count, err := cube.WriteRows(parquet.NewWriter(file))
+//	err = file.Close()
+package parquet
+
+import (
+	"fmt"
+	"github.com/mattbaird/glik"
+	"github.com/xitongsys/parquet-go/writer"
+	"io"
+	"strings"
+)
+
+// the number of goroutines the parquet writer encodes columns with
+const parallelism = 4
+
+type rowWriter struct {
+	out     io.Writer
+	w       *writer.CSVWriter
+	columns []glik.HyperCubeColumn
+}
+
+// NewWriter returns a RowWriter writing a Parquet file to w. Numeric columns are
+// optional DOUBLE, the others optional UTF8 strings. Column names are reduced to
+// letters, digits and underscores, which Parquet tools handle best, e.g.
+// "Sum(Sales)" becomes "Sum_Sales_".
+func NewWriter(w io.Writer) glik.RowWriter {
+	return &rowWriter{out: w}
+}
+
+func (p *rowWriter) WriteHeader(columns []glik.HyperCubeColumn) error {
+	p.columns = columns
+	metadata := []string{}
+	used := map[string]bool{}
+	for _, column := range columns {
+		name := columnName(column.Name, used)
+		if column.Numeric {
+			metadata = append(metadata, fmt.Sprintf("name=%s, type=DOUBLE, repetitiontype=OPTIONAL", name))
+		} else {
+			metadata = append(metadata, fmt.Sprintf("name=%s, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL", name))
+		}
+	}
+	w, err := writer.NewCSVWriterFromWriter(metadata, p.out, parallelism)
+	if err != nil {
+		return fmt.Errorf("error creating parquet writer:%v", err)
+	}
+	p.w = w
+	return nil
+}
+
+func (p *rowWriter) WriteRow(row []glik.NxCell) error {
+	record := make([]interface{}, len(p.columns))
+	for i, column := range p.columns {
+		if i < len(row) {
+			record[i] = glik.CellValue(column, row[i])
+		}
+	}
+	return p.w.Write(record)
+}
+
+// Close writes the buffered rows and the file footer.
+func (p *rowWriter) Close() error {
+	if p.w == nil {
+		return nil
+	}
+	return p.w.WriteStop()
+}
+
+func columnName(title string, used map[string]bool) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, title)
+	if len(name) == 0 || (name[0] >= '0' && name[0] <= '9') {
+		name = "c" + name
+	}
+	retval := name
+	for i := 2; used[strings.ToLower(retval)]; i++ {
+		retval = fmt.Sprintf("%s_%d", name, i)
+	}
+	used[strings.ToLower(retval)] = true
+	return retval
+}
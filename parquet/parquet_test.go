@@ -0,0 +1,34 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parquet
+
+import "testing"
+
+func TestColumnName(t *testing.T) {
+	used := map[string]bool{}
+	tests := []struct {
+		title, want string
+	}{
+		{"Region", "Region"},
+		{"Sum(Sales)", "Sum_Sales_"},
+		{"2016 Sales", "c2016_Sales"},
+		{"", "c"},
+		{"region", "region_2"},
+		{"Région", "R_gion"},
+		{"Sum[Sales]", "Sum_Sales__2"},
+	}
+	for _, test := range tests {
+		if got := columnName(test.title, used); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.title, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Profiles are named connection settings kept in a JSON file, by default ~/.glik/config.json:
+//
+//	{
+//	  "default": "dev",
+//	  "profiles": {
+//	    "dev":  {"server": "qlik-dev", "directory": "CORP", "user": "svc_qlik",
+//	             "clientCert": "client.pem", "clientKey": "client_key.pem", "certAuth": "root.pem"},
+//	    "prod": {"server": "qlik.corp.com", "proxyRouted": true, "proxyPort": 443, "virtualProxy": "hdr"}
+//	  }
+//	}
+//
+// Unset ports fall back to the DEFAULT_*_PORT constants.
+
+const PROFILE_ENV = "GLIK_PROFILE"
+const CONFIG_ENV = "GLIK_CONFIG"
+
+type Profile struct {
+	Server        string `json:"server"`
+	Directory     string `json:"directory,omitempty"`
+	User          string `json:"user,omitempty"`
+	QrsPort       int    `json:"qrsPort,omitempty"`
+	AuthPort      int    `json:"authPort,omitempty"`
+	WebsocketPort int    `json:"websocketPort,omitempty"`
+	ProxyRouted   bool   `json:"proxyRouted,omitempty"`
+	ProxyPort     int    `json:"proxyPort,omitempty"`
+	VirtualProxy  string `json:"virtualProxy,omitempty"`
+	Origin        string `json:"origin,omitempty"`
+	ClientCert    string `json:"clientCert,omitempty"`
+	ClientKey     string `json:"clientKey,omitempty"`
+	CertAuth      string `json:"certAuth,omitempty"`
+}
+
+type ProfileConfig struct {
+	Default  string             `json:"default,omitempty"`
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// DefaultConfigPath is $GLIK_CONFIG, or ~/.glik/config.json.
+func DefaultConfigPath() string {
+	if path := os.Getenv(CONFIG_ENV); len(path) > 0 {
+		return path
+	}
+	return filepath.Join(os.Getenv("HOME"), ".glik", "config.json")
+}
+
+// LoadProfile reads the named profile from the config file at path. An empty name
+// means $GLIK_PROFILE, then the config's default.
+func LoadProfile(path, name string) (Profile, error) {
+	var config ProfileConfig
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Profile{}, fmt.Errorf("error reading config [%s]:%v", path, err)
+	}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return Profile{}, fmt.Errorf("error parsing config [%s]:%v", path, err)
+	}
+	if len(name) == 0 {
+		name = os.Getenv(PROFILE_ENV)
+	}
+	if len(name) == 0 {
+		name = config.Default
+	}
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("no profile [%s] in config [%s]", name, path)
+	}
+	return profile, nil
+}
+
+// API builds an API from the profile, checking the TLS files when any are configured.
+func (p Profile) API() (API, error) {
+	api := NewAPI(p.Server, p.Directory, p.User, orDefault(p.QrsPort, DEFAULT_QRS_PORT),
+		orDefault(p.AuthPort, DEFAULT_AUTH_PORT), orDefault(p.WebsocketPort, DEFAULT_WEBSOCKET_PORT))
+	if p.ProxyRouted {
+		api.UseProxy(orDefault(p.ProxyPort, DEFAULT_PROXY_PORT), p.VirtualProxy)
+	} else {
+		api.VirtualProxy = p.VirtualProxy
+	}
+	api.Origin = p.Origin
+	if len(p.ClientCert) > 0 || len(p.ClientKey) > 0 || len(p.CertAuth) > 0 {
+		err := api.SetTLSItemLocations(p.ClientCert, p.ClientKey, p.CertAuth)
+		if err != nil {
+			return api, err
+		}
+	}
+	return api, nil
+}
+
+func orDefault(value, defaultValue int) int {
+	if value == 0 {
+		return defaultValue
+	}
+	return value
+}
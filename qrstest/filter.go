@@ -0,0 +1,343 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qrstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// filter is a parsed QRS filter query, e.g.
+//
+//	name eq 'Sales' and (published eq true or stream.name sw 'Dev')
+//
+// Supported operators are eq, ne, sw, ew, so, gt, ge, lt and le combined with and, or,
+// not and parentheses. String comparisons are case insensitive like the QRS.
+type filter interface {
+	match(entity map[string]interface{}) bool
+}
+
+type andFilter struct{ left, right filter }
+type orFilter struct{ left, right filter }
+type notFilter struct{ inner filter }
+
+type comparison struct {
+	path  []string
+	op    string
+	value interface{}
+}
+
+func (f andFilter) match(entity map[string]interface{}) bool {
+	return f.left.match(entity) && f.right.match(entity)
+}
+
+func (f orFilter) match(entity map[string]interface{}) bool {
+	return f.left.match(entity) || f.right.match(entity)
+}
+
+func (f notFilter) match(entity map[string]interface{}) bool {
+	return !f.inner.match(entity)
+}
+
+func (c comparison) match(entity map[string]interface{}) bool {
+	values := resolve(entity, c.path)
+	if len(values) == 0 {
+		values = []interface{}{nil}
+	}
+	for _, value := range values {
+		if compare(value, c.op, c.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve walks a dotted path through the entity, fanning out over arrays so
+// "tags.name eq 'x'" matches when any tag does.
+func resolve(value interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{value}
+	}
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			if strings.EqualFold(key, path[0]) {
+				return resolve(child, path[1:])
+			}
+		}
+	case []interface{}:
+		var retval []interface{}
+		for _, child := range typed {
+			retval = append(retval, resolve(child, path)...)
+		}
+		return retval
+	}
+	return nil
+}
+
+func compare(value interface{}, op string, literal interface{}) bool {
+	if value == nil && literal != nil {
+		// omitted json fields are zero values
+		switch literal.(type) {
+		case string:
+			value = ""
+		case float64:
+			value = float64(0)
+		case bool:
+			value = false
+		}
+	}
+	switch typed := literal.(type) {
+	case nil:
+		switch op {
+		case "eq":
+			return value == nil
+		case "ne":
+			return value != nil
+		}
+		return false
+	case bool:
+		b, ok := value.(bool)
+		switch op {
+		case "eq":
+			return ok && b == typed
+		case "ne":
+			return !ok || b != typed
+		}
+		return false
+	case float64:
+		n, ok := value.(float64)
+		if !ok {
+			return op == "ne"
+		}
+		return ordered(op, n < typed, n == typed)
+	case string:
+		s, ok := value.(string)
+		if !ok {
+			s = fmt.Sprintf("%v", value)
+		}
+		s, typed = strings.ToLower(s), strings.ToLower(typed)
+		switch op {
+		case "sw":
+			return strings.HasPrefix(s, typed)
+		case "ew":
+			return strings.HasSuffix(s, typed)
+		case "so":
+			return strings.Contains(s, typed)
+		}
+		return ordered(op, s < typed, s == typed)
+	}
+	return false
+}
+
+func ordered(op string, less, equal bool) bool {
+	switch op {
+	case "eq":
+		return equal
+	case "ne":
+		return !equal
+	case "lt":
+		return less
+	case "le":
+		return less || equal
+	case "gt":
+		return !less && !equal
+	case "ge":
+		return !less
+	}
+	return false
+}
+
+func parseFilter(query string) (filter, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	retval, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in filter", p.tokens[p.pos])
+	}
+	return retval, nil
+}
+
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *filterParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *filterParser) or() (filter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orFilter{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (filter, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = andFilter{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) factor() (filter, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of filter")
+	case strings.EqualFold(token, "not"):
+		inner, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{inner}, nil
+	case token == "(":
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing ) in filter")
+		}
+		return inner, nil
+	}
+	op := strings.ToLower(p.next())
+	switch op {
+	case "eq", "ne", "sw", "ew", "so", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("unknown filter operator %q", op)
+	}
+	value, err := literal(p.next())
+	if err != nil {
+		return nil, err
+	}
+	return comparison{path: strings.Split(token, "."), op: op, value: value}, nil
+}
+
+func literal(token string) (interface{}, error) {
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("missing filter value")
+	case strings.HasPrefix(token, "'"):
+		return strings.Replace(token[1:len(token)-1], "''", "'", -1), nil
+	case strings.EqualFold(token, "null"):
+		return nil, nil
+	case strings.EqualFold(token, "true"), strings.EqualFold(token, "false"):
+		return strings.EqualFold(token, "true"), nil
+	}
+	if n, err := strconv.ParseFloat(token, 64); err == nil {
+		return n, nil
+	}
+	// guids are sent unquoted
+	return token, nil
+}
+
+func tokenize(query string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '\'':
+			j := i + 1
+			for {
+				if j >= len(query) {
+					return nil, fmt.Errorf("unterminated string in filter")
+				}
+				if query[j] == '\'' {
+					if j+1 < len(query) && query[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			tokens = append(tokens, query[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(query) && !strings.ContainsRune(" \t()'", rune(query[j])) {
+				j++
+			}
+			tokens = append(tokens, query[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// filterEntities returns the entities matching the filter, entities is a slice of structs.
+func filterEntities(entities interface{}, query string) ([]interface{}, error) {
+	data, err := json.Marshal(entities)
+	if err != nil {
+		return nil, err
+	}
+	var all []interface{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(query)) == 0 {
+		return append([]interface{}{}, all...), nil
+	}
+	f, err := parseFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	retval := []interface{}{}
+	for _, entity := range all {
+		if m, ok := entity.(map[string]interface{}); ok && f.match(m) {
+			retval = append(retval, entity)
+		}
+	}
+	return retval, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qrstest
+
+import (
+	"strings"
+	"testing"
+)
+
+type filterEntity struct {
+	Name      string        `json:"name"`
+	Published bool          `json:"published,omitempty"`
+	FileSize  int           `json:"fileSize"`
+	Stream    *filterEntity `json:"stream,omitempty"`
+	Tags      []Tag         `json:"tags,omitempty"`
+}
+
+func TestFilterEntities(t *testing.T) {
+	entities := []filterEntity{
+		{Name: "Sales", FileSize: 100},
+		{Name: "Sale's Dev", Published: true, FileSize: 200, Stream: &filterEntity{Name: "Dev"}, Tags: []Tag{{Name: "finance"}, {Name: "daily"}}},
+		{Name: "Marketing", Published: true, FileSize: 300, Stream: &filterEntity{Name: "Prod"}},
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "Sales,Sale's Dev,Marketing"},
+		{"name eq 'sales'", "Sales"},
+		{"NAME Eq 'SALES'", "Sales"},
+		{"name ne 'Sales'", "Sale's Dev,Marketing"},
+		{"name eq 'Sale''s Dev'", "Sale's Dev"},
+		{"name sw 'sale'", "Sales,Sale's Dev"},
+		{"name ew 'ing'", "Marketing"},
+		{"name so 'ket'", "Marketing"},
+		{"published eq false", "Sales"},
+		{"published eq true and stream.name eq 'Prod'", "Marketing"},
+		{"stream.name eq 'Dev' or name eq 'Sales'", "Sales,Sale's Dev"},
+		{"name sw 'sale' and not (stream.name eq 'dev')", "Sales"},
+		{"not published eq true", "Sales"},
+		{"(name eq 'Sales' or name eq 'Marketing') and fileSize gt 100", "Marketing"},
+		{"fileSize ge 200", "Sale's Dev,Marketing"},
+		{"fileSize lt 200", "Sales"},
+		{"fileSize le 200", "Sales,Sale's Dev"},
+		{"stream eq null", "Sales"},
+		{"stream ne null", "Sale's Dev,Marketing"},
+		{"tags.name eq 'daily'", "Sale's Dev"},
+		{"name gt 'N'", "Sales,Sale's Dev"},
+	}
+	for _, test := range tests {
+		matched, err := filterEntities(entities, test.query)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		names := []string{}
+		for _, entity := range matched {
+			names = append(names, entity.(map[string]interface{})["name"].(string))
+		}
+		if got := strings.Join(names, ","); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	for _, query := range []string{
+		"name",
+		"name eq",
+		"name is 'x'",
+		"name eq 'x",
+		"(name eq 'x'",
+		"name eq 'x' and",
+		"name eq 'x')",
+	} {
+		if _, err := parseFilter(query); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens, err := tokenize("not(id eq 8e0e6d1c-2b0a and name so 'a ''b'' c')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"not", "(", "id", "eq", "8e0e6d1c-2b0a", "and", "name", "so", "'a ''b'' c'", ")"}
+	if strings.Join(tokens, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q", tokens)
+	}
+}
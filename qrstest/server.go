@@ -0,0 +1,395 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package qrstest provides an in-process fake of the Qlik Sense Repository Service (QRS)
+// REST API and the Proxy Service (QPS) ticket API, backed by an in-memory Store.
+//
+//	store := qrstest.NewStore()
+//	app := store.AddApp("Sales")
+//	server := qrstest.NewServer(store)
+//	defer server.Close()
+//	api := server.API()
+//	apps, err := api.List()
+//
+// Handler is a plain http.Handler, so the fake can also be served with
+// http.ListenAndServeTLS as a local target for deploy tooling.
+package qrstest
+
+import (
+	"encoding/json"
+	"github.com/mattbaird/glik"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const xrf_header = "X-Qlik-Xrfkey"
+
+type Server struct {
+	*httptest.Server
+	*Handler
+}
+
+// NewServer starts a TLS server serving the QRS and QPS endpoints from store.
+func NewServer(store *Store) *Server {
+	handler := NewHandler(store)
+	return &Server{Server: httptest.NewTLSServer(handler), Handler: handler}
+}
+
+// API returns a glik API pointed at the server for both the QRS and QPS ports.
+func (s *Server) API() glik.API {
+	host, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return glik.NewAPI(host, glik.DEFAULT_DIR, glik.DEFAULT_USER, p, p, 0)
+}
+
+type fault struct {
+	method    string
+	path      string
+	status    int
+	remaining int
+}
+
+// Handler serves the fake QRS/QPS. Latency delays every response, InjectError makes
+// matching requests fail.
+type Handler struct {
+	Store   *Store
+	Latency time.Duration
+	mu      sync.Mutex
+	faults  []*fault
+}
+
+func NewHandler(store *Store) *Handler {
+	return &Handler{Store: store}
+}
+
+// InjectError makes the next times requests whose method and path (e.g. "POST",
+// "/qrs/app/<id>/copy") match fail with status. An empty method or path matches any,
+// times <= 0 fails until ClearErrors.
+func (h *Handler) InjectError(method, path string, status, times int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.faults = append(h.faults, &fault{method: method, path: path, status: status, remaining: times})
+}
+
+func (h *Handler) ClearErrors() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.faults = nil
+}
+
+func (h *Handler) injected(method, path string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, f := range h.faults {
+		if (f.method == "" || f.method == method) && (f.path == "" || strings.EqualFold(f.path, path)) {
+			if f.remaining > 0 {
+				f.remaining--
+				if f.remaining == 0 {
+					h.faults = append(h.faults[:i], h.faults[i+1:]...)
+				}
+			}
+			return f.status
+		}
+	}
+	return 0
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Latency > 0 {
+		time.Sleep(h.Latency)
+	}
+	// strip any virtual proxy prefix, /hdr/qrs/app -> /qrs/app, /qps/hdr/ticket -> /qps/ticket
+	path := strings.TrimRight(r.URL.Path, "/")
+	if i := strings.Index(path, "/qrs/"); i > 0 {
+		path = path[i:]
+	}
+	if strings.HasPrefix(path, "/qps/") && strings.HasSuffix(path, "/ticket") {
+		path = "/qps/ticket"
+	}
+	if status := h.injected(r.Method, path); status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	xrfKey := r.URL.Query().Get("xrfkey")
+	if len(xrfKey) != 16 || xrfKey != r.Header.Get(xrf_header) {
+		http.Error(w, "XSRF prevention check failed. Possible XSRF discovered.", http.StatusForbidden)
+		return
+	}
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	var result interface{}
+	var status int
+	switch segments[0] {
+	case "qrs":
+		result, status = h.serveQrs(r, segments[1:])
+	case "qps":
+		result, status = h.serveQps(r, segments[1:])
+	default:
+		status = http.StatusNotFound
+	}
+	if status >= 300 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if result == nil {
+		w.WriteHeader(status)
+		return
+	}
+	if content, ok := result.(rawContent); ok {
+		w.Header().Set("Content-Type", "application/vnd.qlik.sense.app")
+		w.WriteHeader(status)
+		w.Write(content)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// rawContent is a response body sent as is rather than as JSON.
+type rawContent []byte
+
+func (h *Handler) serveQrs(r *http.Request, segments []string) (interface{}, int) {
+	s := h.Store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	query := r.URL.Query()
+	switch r.Method + " " + strings.Join(segments, "/") {
+	case "GET about":
+		return s.About, http.StatusOK
+	case "GET app", "GET app/full":
+		return list(s.Apps, query.Get("filter"))
+	case "GET stream", "GET stream/full":
+		return list(s.Streams, query.Get("filter"))
+	case "GET user", "GET user/full":
+		return list(s.Users, query.Get("filter"))
+	case "GET reloadtask", "GET reloadtask/full", "GET task", "GET task/full":
+		return list(s.Tasks, query.Get("filter"))
+	case "GET tag", "GET tag/full":
+		return list(s.Tags, query.Get("filter"))
+	case "GET dataconnection":
+		connections := []glik.DataConnection{}
+		for _, connection := range s.DataConnections {
+			connections = append(connections, condensed(connection))
+		}
+		return list(connections, query.Get("filter"))
+	case "GET dataconnection/full":
+		connections := []glik.DataConnection{}
+		for _, connection := range s.DataConnections {
+			connections = append(connections, withoutPassword(connection))
+		}
+		return list(connections, query.Get("filter"))
+	case "POST dataconnection":
+		var connection glik.DataConnection
+		if err := json.NewDecoder(r.Body).Decode(&connection); err != nil || len(connection.Name) == 0 {
+			return nil, http.StatusBadRequest
+		}
+		connection.Id = newGuid()
+		connection.CreatedDate = timestamp()
+		connection.ModifiedDate = connection.CreatedDate
+		connection.SchemaPath = "DataConnection"
+		s.DataConnections = append(s.DataConnections, &connection)
+		return withoutPassword(&connection), http.StatusCreated
+	case "POST app/upload":
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil || len(content) == 0 || len(query.Get("name")) == 0 {
+			return nil, http.StatusBadRequest
+		}
+		now := timestamp()
+		app := &glik.ApplicationResult{Id: newGuid(), Name: query.Get("name"), CreatedDate: now, ModifiedDate: now, FileSize: len(content), SchemaPath: "App"}
+		app.AppId = app.Id
+		s.Apps = append(s.Apps, app)
+		s.Files[app.Id] = content
+		return app, http.StatusCreated
+	case "POST task/start", "POST task/start/synchronous":
+		for _, task := range s.Tasks {
+			if task.Name == query.Get("name") {
+				s.startTask(task)
+				return nil, http.StatusNoContent
+			}
+		}
+		return nil, http.StatusNotFound
+	}
+	if len(segments) < 2 {
+		return nil, http.StatusNotFound
+	}
+	if r.Method == "GET" && len(segments) == 5 && segments[0] == "download" && segments[1] == "app" {
+		// download/app/{id}/{ticket}/{filename}
+		if s.exports[segments[3]] != segments[2] || s.app(segments[2]) == nil {
+			return nil, http.StatusNotFound
+		}
+		delete(s.exports, segments[3])
+		content, ok := s.Files[segments[2]]
+		if !ok {
+			content = []byte("QVF " + s.app(segments[2]).Name)
+		}
+		return rawContent(content), http.StatusOK
+	}
+	// entity routes, with the id replaced by a placeholder
+	route := r.Method + " " + segments[0] + "/{id}"
+	if len(segments) > 2 {
+		route += "/" + strings.Join(segments[2:], "/")
+	}
+	switch route {
+	case "GET app/{id}":
+		if app := s.app(segments[1]); app != nil {
+			return app, http.StatusOK
+		}
+	case "DELETE app/{id}":
+		for i, app := range s.Apps {
+			if app.Id == segments[1] {
+				s.Apps = append(s.Apps[:i], s.Apps[i+1:]...)
+				delete(s.Files, app.Id)
+				return nil, http.StatusNoContent
+			}
+		}
+	case "GET dataconnection/{id}":
+		if connection := s.dataConnection(segments[1]); connection != nil {
+			return withoutPassword(connection), http.StatusOK
+		}
+	case "PUT dataconnection/{id}":
+		connection := s.dataConnection(segments[1])
+		if connection == nil {
+			break
+		}
+		var update glik.DataConnection
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil || update.Id != connection.Id {
+			return nil, http.StatusBadRequest
+		}
+		// like the QRS, refuse updates of a connection modified since it was read
+		if update.ModifiedDate != connection.ModifiedDate {
+			return nil, http.StatusConflict
+		}
+		if len(update.Password) == 0 {
+			update.Password = connection.Password
+		}
+		update.CreatedDate = connection.CreatedDate
+		update.ModifiedDate = timestamp()
+		update.SchemaPath = connection.SchemaPath
+		*connection = update
+		return withoutPassword(connection), http.StatusOK
+	case "DELETE dataconnection/{id}":
+		for i, connection := range s.DataConnections {
+			if connection.Id == segments[1] {
+				s.DataConnections = append(s.DataConnections[:i], s.DataConnections[i+1:]...)
+				return nil, http.StatusNoContent
+			}
+		}
+	case "GET app/{id}/export":
+		if app := s.app(segments[1]); app != nil {
+			ticket := newGuid()
+			s.exports[ticket] = app.Id
+			return map[string]string{"value": ticket}, http.StatusOK
+		}
+	case "POST app/{id}/copy":
+		if app := s.app(segments[1]); app != nil {
+			copy := *app
+			copy.Id = newGuid()
+			copy.AppId = copy.Id
+			copy.Published = false
+			copy.PublishTime = ""
+			copy.Stream = nil
+			copy.CreatedDate = timestamp()
+			copy.ModifiedDate = copy.CreatedDate
+			if name := query.Get("name"); len(name) > 0 {
+				copy.Name = name
+			}
+			s.Apps = append(s.Apps, &copy)
+			if content, ok := s.Files[app.Id]; ok {
+				s.Files[copy.Id] = content
+			}
+			return copy, http.StatusCreated
+		}
+	case "PUT app/{id}/publish":
+		app := s.app(segments[1])
+		stream := s.stream(query.Get("stream"))
+		if app == nil || stream == nil {
+			break
+		}
+		if app.Published {
+			return nil, http.StatusBadRequest
+		}
+		app.Published = true
+		app.PublishTime = timestamp()
+		app.Stream = stream
+		if name := query.Get("name"); len(name) > 0 {
+			app.Name = name
+		}
+		return app, http.StatusOK
+	case "POST app/{id}/reload":
+		if app := s.app(segments[1]); app != nil {
+			app.LastReloadTime = timestamp()
+			s.Reloads = append(s.Reloads, app.Id)
+			return nil, http.StatusNoContent
+		}
+	case "POST task/{id}/start", "POST task/{id}/start/synchronous":
+		if task := s.task(segments[1]); task != nil {
+			s.startTask(task)
+			return nil, http.StatusNoContent
+		}
+	}
+	return nil, http.StatusNotFound
+}
+
+func (s *Store) startTask(task *Task) {
+	task.StartCount++
+	task.LastStarted = timestamp()
+	if task.App != nil {
+		if app := s.app(task.App.Id); app != nil {
+			app.LastReloadTime = task.LastStarted
+			s.Reloads = append(s.Reloads, app.Id)
+		}
+	}
+}
+
+func withoutPassword(connection *glik.DataConnection) glik.DataConnection {
+	retval := *connection
+	retval.Password = ""
+	return retval
+}
+
+// condensed keeps the fields of the QRS DataConnectionCondensed, which has no dates,
+// tags or owner.
+func condensed(connection *glik.DataConnection) glik.DataConnection {
+	return glik.DataConnection{Id: connection.Id, Name: connection.Name, ConnectionString: connection.ConnectionString, Type: connection.Type, UserName: connection.UserName, Architecture: connection.Architecture, LogOn: connection.LogOn}
+}
+
+func list(entities interface{}, query string) (interface{}, int) {
+	retval, err := filterEntities(entities, query)
+	if err != nil {
+		return nil, http.StatusBadRequest
+	}
+	return retval, http.StatusOK
+}
+
+func (h *Handler) serveQps(r *http.Request, segments []string) (interface{}, int) {
+	if r.Method != "POST" || len(segments) != 1 || segments[0] != "ticket" {
+		return nil, http.StatusNotFound
+	}
+	var ticket Ticket
+	if err := json.NewDecoder(r.Body).Decode(&ticket); err != nil || len(ticket.UserId) == 0 {
+		return nil, http.StatusBadRequest
+	}
+	if ticket.Attributes == nil {
+		ticket.Attributes = []interface{}{}
+	}
+	ticket.Ticket = strings.Replace(newGuid(), "-", "", -1)[0:16]
+	s := h.Store
+	s.mu.Lock()
+	s.Tickets = append(s.Tickets, ticket)
+	s.mu.Unlock()
+	return ticket, http.StatusCreated
+}
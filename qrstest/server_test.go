@@ -0,0 +1,118 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qrstest_test
+
+import (
+	"bytes"
+	"github.com/mattbaird/glik/qrstest"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestXrfKeyRejected(t *testing.T) {
+	server := qrstest.NewServer(qrstest.NewStore())
+	defer server.Close()
+	tests := []struct {
+		name   string
+		query  string
+		header string
+		want   int
+	}{
+		{"no key", "", "", http.StatusForbidden},
+		{"no header", "abcdefghijklmnop", "", http.StatusForbidden},
+		{"mismatch", "abcdefghijklmnop", "ABCDEFGHIJKLMNOP", http.StatusForbidden},
+		{"short key", "abc", "abc", http.StatusForbidden},
+		{"matching key", "abcdefghijklmnop", "abcdefghijklmnop", http.StatusOK},
+	}
+	for _, test := range tests {
+		request, _ := http.NewRequest("GET", server.URL+"/qrs/about?xrfkey="+url.QueryEscape(test.query), nil)
+		if len(test.header) > 0 {
+			request.Header.Set("X-Qlik-Xrfkey", test.header)
+		}
+		response, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != test.want {
+			t.Errorf("%s: got status %v, want %v", test.name, response.StatusCode, test.want)
+		}
+	}
+}
+
+func TestAppRoundTrip(t *testing.T) {
+	store := qrstest.NewStore()
+	sales := store.AddApp("Sales")
+	store.AddApp("Marketing")
+	stream := store.AddStream("Prod")
+	server := qrstest.NewServer(store)
+	defer server.Close()
+	api := server.API()
+	about, err := api.About()
+	if err != nil || about.BuildVersion != store.About.BuildVersion {
+		t.Fatalf("got %+v, %v", about, err)
+	}
+	copied, err := api.Copy(sales.Id, "Sales copy")
+	if err != nil || copied.Name != "Sales copy" || copied.Id == sales.Id {
+		t.Fatalf("got %+v, %v", copied, err)
+	}
+	published, err := api.Publish(copied.Id, stream.Id, "Sales")
+	if err != nil || !published.Published || published.Stream == nil || published.Stream.Id != stream.Id {
+		t.Fatalf("got %+v, %v", published, err)
+	}
+	if err := api.Reload(sales.Id); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.Reloads) != 1 || store.Reloads[0] != sales.Id {
+		t.Errorf("got reloads %v", store.Reloads)
+	}
+	apps, err := api.List()
+	if err != nil || len(apps) != 3 {
+		t.Errorf("got %v apps, %v", len(apps), err)
+	}
+	var exported bytes.Buffer
+	if err := api.Export(sales.Id, &exported); err != nil || exported.String() != "QVF Sales" {
+		t.Errorf("got %q, %v", exported.String(), err)
+	}
+	if err := api.Delete(copied.Id); err != nil {
+		t.Fatal(err)
+	}
+	if store.App(copied.Id) != nil {
+		t.Errorf("app %s was not deleted", copied.Id)
+	}
+}
+
+func TestInjectError(t *testing.T) {
+	store := qrstest.NewStore()
+	server := qrstest.NewServer(store)
+	defer server.Close()
+	server.InjectError("GET", "/qrs/about", http.StatusInternalServerError, 1)
+	api := server.API()
+	if _, err := api.About(); err == nil {
+		t.Error("expected the injected error")
+	}
+	if _, err := api.About(); err != nil {
+		t.Errorf("the error was injected more than once: %v", err)
+	}
+	// the virtual proxy prefix is stripped before matching
+	server.InjectError("", "/qrs/about", http.StatusServiceUnavailable, 0)
+	api.UseProxy(0, "hdr")
+	api.ProxyPort = api.QrsPort
+	if _, err := api.About(); err == nil {
+		t.Error("expected the injected error through the proxy")
+	}
+	server.ClearErrors()
+	if _, err := api.About(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qrstest
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/mattbaird/glik"
+	"sync"
+	"time"
+)
+
+type User struct {
+	Id            string   `json:"id,omitempty"`
+	UserId        string   `json:"userId,omitempty"`
+	UserDirectory string   `json:"userDirectory,omitempty"`
+	Name          string   `json:"name,omitempty"`
+	Roles         []string `json:"roles,omitempty"`
+	Inactive      bool     `json:"inactive,omitempty"`
+}
+
+// Tag is the library's tag, so tags read from the store can be set on the data
+// connections it holds.
+type Tag = glik.Tag
+
+type AppRef struct {
+	Id   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type Task struct {
+	Id          string  `json:"id,omitempty"`
+	Name        string  `json:"name,omitempty"`
+	TaskType    int     `json:"taskType"`
+	Enabled     bool    `json:"enabled"`
+	App         *AppRef `json:"app,omitempty"`
+	Tags        []Tag   `json:"tags,omitempty"`
+	StartCount  int     `json:"-"`
+	LastStarted string  `json:"-"`
+}
+
+// Ticket is a ticket handed out by the QPS ticket endpoint.
+type Ticket struct {
+	UserDirectory string        `json:"UserDirectory"`
+	UserId        string        `json:"UserId"`
+	Attributes    []interface{} `json:"Attributes"`
+	Ticket        string        `json:"Ticket"`
+	TargetUri     *string       `json:"TargetUri"`
+}
+
+// Store is the in-memory repository behind the fake QRS. The exported fields can be
+// seeded directly, or by unmarshalling a JSON file into NewStore(), and inspected
+// after the code under test ran.
+type Store struct {
+	mu      sync.Mutex
+	About   glik.About                `json:"about"`
+	Apps    []*glik.ApplicationResult `json:"apps"`
+	Streams []*glik.Stream            `json:"streams"`
+	Users   []*User                   `json:"users"`
+	Tasks   []*Task                   `json:"tasks"`
+	Tags    []*Tag                    `json:"tags"`
+	// DataConnections keep their passwords, which the endpoints never return
+	DataConnections []*glik.DataConnection `json:"dataConnections"`
+	Reloads         []string               `json:"-"`
+	Tickets         []Ticket               `json:"-"`
+	// Files holds the qvf content of apps by id, served by export and set by upload
+	Files   map[string][]byte `json:"-"`
+	exports map[string]string
+}
+
+func NewStore() *Store {
+	return &Store{Files: make(map[string][]byte), exports: make(map[string]string), About: glik.About{BuildVersion: "2.2.4.0", BuildDate: "2016-05-04", DatabaseProvider: "Devart.Data.PostgreSql", NodeType: 1, SchemaPath: "About"}}
+}
+
+func (s *Store) AddApp(name string) *glik.ApplicationResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := timestamp()
+	app := &glik.ApplicationResult{Id: newGuid(), Name: name, CreatedDate: now, ModifiedDate: now, SchemaPath: "App"}
+	app.AppId = app.Id
+	s.Apps = append(s.Apps, app)
+	return app
+}
+
+func (s *Store) AddStream(name string) *glik.Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stream := &glik.Stream{Id: newGuid(), Name: name}
+	s.Streams = append(s.Streams, stream)
+	return stream
+}
+
+func (s *Store) AddUser(directory, userId, name string) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := &User{Id: newGuid(), UserDirectory: directory, UserId: userId, Name: name}
+	s.Users = append(s.Users, user)
+	return user
+}
+
+// AddTask adds a reload task for the app.
+func (s *Store) AddTask(name, appId string) *Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task := &Task{Id: newGuid(), Name: name, Enabled: true}
+	if app := s.app(appId); app != nil {
+		task.App = &AppRef{Id: app.Id, Name: app.Name}
+	}
+	s.Tasks = append(s.Tasks, task)
+	return task
+}
+
+func (s *Store) AddTag(name string) *Tag {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tag := &Tag{Id: newGuid(), Name: name}
+	s.Tags = append(s.Tags, tag)
+	return tag
+}
+
+func (s *Store) AddDataConnection(name, connectionString, connectionType string) *glik.DataConnection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := timestamp()
+	connection := &glik.DataConnection{Id: newGuid(), Name: name, ConnectionString: connectionString, Type: connectionType, CreatedDate: now, ModifiedDate: now, SchemaPath: "DataConnection"}
+	s.DataConnections = append(s.DataConnections, connection)
+	return connection
+}
+
+// DataConnection returns a copy of the data connection with the given id, or nil.
+func (s *Store) DataConnection(id string) *glik.DataConnection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if connection := s.dataConnection(id); connection != nil {
+		copy := *connection
+		return &copy
+	}
+	return nil
+}
+
+// App returns a copy of the app with the given id, or nil.
+func (s *Store) App(id string) *glik.ApplicationResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if app := s.app(id); app != nil {
+		copy := *app
+		return &copy
+	}
+	return nil
+}
+
+func (s *Store) app(id string) *glik.ApplicationResult {
+	for _, app := range s.Apps {
+		if app.Id == id {
+			return app
+		}
+	}
+	return nil
+}
+
+func (s *Store) stream(id string) *glik.Stream {
+	for _, stream := range s.Streams {
+		if stream.Id == id {
+			return stream
+		}
+	}
+	return nil
+}
+
+func (s *Store) dataConnection(id string) *glik.DataConnection {
+	for _, connection := range s.DataConnections {
+		if connection.Id == id {
+			return connection
+		}
+	}
+	return nil
+}
+
+func (s *Store) task(id string) *Task {
+	for _, task := range s.Tasks {
+		if task.Id == id {
+			return task
+		}
+	}
+	return nil
+}
+
+func newGuid() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+}
@@ -0,0 +1,258 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the line starting each section (tab) of a load script in the script editor
+const SCRIPT_TAB_PREFIX = "///$tab "
+
+// the name of the first section when the engine creates an app
+const DEFAULT_SCRIPT_SECTION = "Main"
+
+// the engine stores scripts with windows line endings
+const SCRIPT_NEWLINE = "\r\n"
+
+// ScriptSection is a tab of the load script, Body being its statements.
+type ScriptSection struct {
+	Name string
+	Body string
+}
+
+// Script is a load script split into its sections, see ParseScript.
+type Script struct {
+	Sections []ScriptSection
+}
+
+// ParseScript splits a load script at its "///$tab" lines. Statements before the first
+// of them, as in scripts that were never opened in the script editor, are put in a
+// DEFAULT_SCRIPT_SECTION section.
+func ParseScript(script string) *Script {
+	retval := &Script{Sections: []ScriptSection{}}
+	lines := []string{}
+	name := DEFAULT_SCRIPT_SECTION
+	flush := func(always bool) {
+		body := strings.Join(lines, SCRIPT_NEWLINE)
+		if always || len(strings.TrimSpace(body)) > 0 {
+			retval.Sections = append(retval.Sections, ScriptSection{Name: name, Body: body})
+		}
+	}
+	started := false
+	for _, line := range strings.Split(strings.Replace(script, "\r\n", "\n", -1), "\n") {
+		if strings.HasPrefix(line, SCRIPT_TAB_PREFIX) {
+			flush(started)
+			started = true
+			name = strings.TrimSpace(strings.TrimPrefix(line, SCRIPT_TAB_PREFIX))
+			lines = []string{}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush(started)
+	return retval
+}
+
+// String joins the sections back into a load script.
+func (s *Script) String() string {
+	parts := []string{}
+	for _, section := range s.Sections {
+		body := strings.Replace(strings.Replace(section.Body, "\r\n", "\n", -1), "\n", SCRIPT_NEWLINE, -1)
+		parts = append(parts, SCRIPT_TAB_PREFIX+section.Name+SCRIPT_NEWLINE+body)
+	}
+	return strings.Join(parts, SCRIPT_NEWLINE)
+}
+
+// Index is the position of the section with the name, -1 if there is none.
+func (s *Script) Index(name string) int {
+	for i, section := range s.Sections {
+		if section.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Section returns the body of the section with the name.
+func (s *Script) Section(name string) (string, bool) {
+	i := s.Index(name)
+	if i < 0 {
+		return "", false
+	}
+	return s.Sections[i].Body, true
+}
+
+// Set replaces the body of the section with the name, adding the section at the end
+// if there is none.
+func (s *Script) Set(name, body string) {
+	i := s.Index(name)
+	if i < 0 {
+		s.Sections = append(s.Sections, ScriptSection{Name: name, Body: body})
+		return
+	}
+	s.Sections[i].Body = body
+}
+
+// Insert adds a section at position i, 0 being the first.
+func (s *Script) Insert(i int, name, body string) error {
+	if s.Index(name) >= 0 {
+		return fmt.Errorf("error inserting script section [%s]:a section has the name", name)
+	}
+	if i < 0 || i > len(s.Sections) {
+		return fmt.Errorf("error inserting script section [%s]:position %d is out of range", name, i)
+	}
+	s.Sections = append(s.Sections, ScriptSection{})
+	copy(s.Sections[i+1:], s.Sections[i:])
+	s.Sections[i] = ScriptSection{Name: name, Body: body}
+	return nil
+}
+
+// Remove removes the section with the name, returning false if there is none.
+func (s *Script) Remove(name string) bool {
+	i := s.Index(name)
+	if i < 0 {
+		return false
+	}
+	s.Sections = append(s.Sections[:i], s.Sections[i+1:]...)
+	return true
+}
+
+// Move moves the section with the name to position i, as counted after taking it out.
+func (s *Script) Move(name string, i int) error {
+	from := s.Index(name)
+	if from < 0 {
+		return ErrDoesNotExist
+	}
+	section := s.Sections[from]
+	s.Remove(name)
+	err := s.Insert(i, section.Name, section.Body)
+	if err != nil {
+		s.Insert(from, section.Name, section.Body)
+	}
+	return err
+}
+
+// GetScriptSections returns the app's load script split into sections.
+func (d *Doc) GetScriptSections() (*Script, error) {
+	script, err := d.GetScript()
+	if err != nil {
+		return nil, err
+	}
+	return ParseScript(script), nil
+}
+
+func (d *Doc) SetScriptSections(script *Script) error {
+	return d.SetScript(script.String())
+}
+
+// ScriptError is a syntax error in a load script. Line and Column count from 1 within
+// the section, Text is the line in error. SecondaryFailure marks errors that follow
+// from an earlier one.
+type ScriptError struct {
+	Section          string
+	Line             int
+	Column           int
+	Length           int
+	TextPos          int
+	SecondaryFailure bool
+	Text             string
+}
+
+func (e ScriptError) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.Section, e.Line, e.Column, strings.TrimSpace(e.Text))
+}
+
+// ScriptSyntaxError is returned by ValidateScript for scripts with syntax errors.
+type ScriptSyntaxError struct {
+	Errors []ScriptError
+}
+
+func (e *ScriptSyntaxError) Error() string {
+	lines := []string{}
+	for _, err := range e.Errors {
+		lines = append(lines, err.String())
+	}
+	return fmt.Sprintf("error in script:%s", strings.Join(lines, "; "))
+}
+
+type scriptSyntaxError struct {
+	ErrLen           int  `json:"qErrLen"`
+	TabIx            int  `json:"qTabIx"`
+	LineInTab        int  `json:"qLineInTab"`
+	ColInLine        int  `json:"qColInLine"`
+	TextPos          int  `json:"qTextPos"`
+	SecondaryFailure bool `json:"qSecondaryFailure"`
+}
+
+// CheckScriptSyntax checks the app's current load script, locating the errors in
+// the script's sections.
+func (d *Doc) CheckScriptSyntax() ([]ScriptError, error) {
+	var result struct {
+		Errors []scriptSyntaxError `json:"qErrors"`
+	}
+	err := d.call("CheckScriptSyntax", nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	retval := []ScriptError{}
+	if len(result.Errors) == 0 {
+		return retval, nil
+	}
+	script, err := d.GetScriptSections()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range result.Errors {
+		scriptError := ScriptError{Line: e.LineInTab + 1, Column: e.ColInLine + 1, Length: e.ErrLen, TextPos: e.TextPos, SecondaryFailure: e.SecondaryFailure}
+		if e.TabIx >= 0 && e.TabIx < len(script.Sections) {
+			section := script.Sections[e.TabIx]
+			scriptError.Section = section.Name
+			lines := strings.Split(section.Body, SCRIPT_NEWLINE)
+			if e.LineInTab >= 0 && e.LineInTab < len(lines) {
+				scriptError.Text = lines[e.LineInTab]
+			}
+		}
+		retval = append(retval, scriptError)
+	}
+	return retval, nil
+}
+
+// ValidateScript checks the syntax of a load script by setting it on the app for the
+// check, then putting the app's script back. It returns a *ScriptSyntaxError if the
+// script has errors. Nothing is saved, but use an app nobody else edits at the time,
+// such as a session app.
+func (d *Doc) ValidateScript(script string) (err error) {
+	original, err := d.GetScript()
+	if err != nil {
+		return err
+	}
+	err = d.SetScript(script)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		restoreErr := d.SetScript(original)
+		if err == nil {
+			err = restoreErr
+		}
+	}()
+	errors, err := d.CheckScriptSyntax()
+	if err != nil {
+		return err
+	}
+	if len(errors) > 0 {
+		return &ScriptSyntaxError{Errors: errors}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"regexp"
+	"strings"
+)
+
+// file formats of LOAD ... FROM and STORE, as written in parentheses after the file
+const (
+	FORMAT_QVD     = "qvd"
+	FORMAT_CSV     = "txt, utf8, embedded labels, delimiter is ',', msq"
+	FORMAT_TAB     = "txt, utf8, embedded labels, delimiter is '\\t', msq"
+	FORMAT_PARQUET = "parquet"
+	FORMAT_XLSX    = "ooxml, embedded labels"
+)
+
+var plainName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// the keywords of the script language, which are not taken as names unless bracketed
+var reservedWords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`ADD AND AS AUTOGENERATE BUFFER BUNDLE BY CALL CASE
+		CONCATENATE CONNECT CROSSTABLE DEFAULT DISCONNECT DISTINCT DO DROP EACH ELSE ELSEIF
+		END EXECUTE EXIT EXTENSION FIELD FIELDS FIRST FOR FROM GENERIC GROUP HIERARCHY IF
+		IMAGE_SIZE INFO INLINE INNER INTERVALMATCH INTO IS JOIN KEEP LEFT LET LIB LIKE LOAD
+		LOOP MAPPING MATCH NEXT NOCONCATENATE NOT NULL OR ORDER OUTER QUALIFY REM RENAME
+		REPLACE RESIDENT RIGHT SAMPLE SCRIPT SEARCH SECTION SELECT SEMANTIC SET SLEEP SQL
+		STEP STORE SUB SWITCH TABLE TABLES THEN TO TRACE UNLESS UNQUALIFY UNTIL WHEN WHERE
+		WHILE WITH XOR`) {
+		reservedWords[word] = true
+	}
+}
+
+// QuoteName brackets a field or table name unless it is a plain identifier, doubling
+// the closing brackets in it, e.g. "Order Id" becomes "[Order Id]". Keywords such as
+// "From" or "Load" are bracketed too.
+func QuoteName(name string) string {
+	if plainName.MatchString(name) && !reservedWords[strings.ToUpper(name)] {
+		return name
+	}
+	return "[" + strings.Replace(name, "]", "]]", -1) + "]"
+}
+
+// QuoteString quotes a string literal, doubling the single quotes in it.
+func QuoteString(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
+
+// quotePath brackets a file path, e.g. "lib://Data/sales.qvd".
+func quotePath(path string) string {
+	return "[" + strings.Replace(path, "]", "]]", -1) + "]"
+}
+
+// ScriptField is a field of a LOAD statement, see LoadField and LoadExpr.
+type ScriptField struct {
+	Expression string
+	Alias      string
+}
+
+// LoadField loads a field as is.
+func LoadField(name string) ScriptField {
+	return ScriptField{Expression: QuoteName(name)}
+}
+
+// LoadExpr loads an expression, e.g. "Year(OrderDate)", as the field alias.
+func LoadExpr(expression, alias string) ScriptField {
+	return ScriptField{Expression: expression, Alias: alias}
+}
+
+func (f ScriptField) String() string {
+	if len(f.Alias) == 0 {
+		return f.Expression
+	}
+	return f.Expression + " AS " + QuoteName(f.Alias)
+}
+
+// LoadStatement is a LOAD statement, see Load.
+type LoadStatement struct {
+	label    string
+	distinct bool
+	fields   []ScriptField
+	from     string
+	format   string
+	resident string
+	where    string
+	groupBy  []string
+}
+
+// Load starts a LOAD statement of the fields, all fields (*) if there are none.
+//
+//	glik.Load(glik.LoadField("Order Id"), glik.LoadExpr("Amount * 1.2", "Gross")).
+//		Label("Sales").From("lib://Data/sales.qvd", glik.FORMAT_QVD)
+func Load(fields ...ScriptField) *LoadStatement {
+	return &LoadStatement{fields: fields}
+}
+
+// Label names the table loaded into.
+func (l *LoadStatement) Label(table string) *LoadStatement {
+	l.label = table
+	return l
+}
+
+func (l *LoadStatement) Distinct() *LoadStatement {
+	l.distinct = true
+	return l
+}
+
+// From loads from a file, format being one of the FORMAT constants or another format
+// specification.
+func (l *LoadStatement) From(path, format string) *LoadStatement {
+	l.from = path
+	l.format = format
+	return l
+}
+
+// Resident loads from a table loaded before.
+func (l *LoadStatement) Resident(table string) *LoadStatement {
+	l.resident = table
+	return l
+}
+
+func (l *LoadStatement) Where(condition string) *LoadStatement {
+	l.where = condition
+	return l
+}
+
+func (l *LoadStatement) GroupBy(fields ...string) *LoadStatement {
+	l.groupBy = fields
+	return l
+}
+
+func (l *LoadStatement) String() string {
+	lines := []string{}
+	if len(l.label) > 0 {
+		lines = append(lines, QuoteName(l.label)+":")
+	}
+	load := "LOAD"
+	if l.distinct {
+		load += " DISTINCT"
+	}
+	if len(l.fields) == 0 {
+		lines = append(lines, load+" *")
+	} else {
+		lines = append(lines, load)
+		for i, field := range l.fields {
+			line := "\t" + field.String()
+			if i < len(l.fields)-1 {
+				line += ","
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(l.resident) > 0 {
+		lines = append(lines, "RESIDENT "+QuoteName(l.resident))
+	} else if len(l.from) > 0 {
+		lines = append(lines, "FROM "+quotePath(l.from))
+		if len(l.format) > 0 {
+			lines = append(lines, "("+l.format+")")
+		}
+	}
+	if len(l.where) > 0 {
+		lines = append(lines, "WHERE "+l.where)
+	}
+	if len(l.groupBy) > 0 {
+		names := []string{}
+		for _, field := range l.groupBy {
+			names = append(names, QuoteName(field))
+		}
+		lines = append(lines, "GROUP BY "+strings.Join(names, ", "))
+	}
+	return strings.Join(lines, SCRIPT_NEWLINE) + ";"
+}
+
+// ScriptBuilder writes the statements of a script section, see Script.Set.
+type ScriptBuilder struct {
+	statements []string
+}
+
+func NewScriptBuilder() *ScriptBuilder {
+	return &ScriptBuilder{statements: []string{}}
+}
+
+// LibConnect connects to a data connection, as LOAD statements after it use.
+func (b *ScriptBuilder) LibConnect(connection string) *ScriptBuilder {
+	return b.Statement("LIB CONNECT TO " + QuoteString(connection) + ";")
+}
+
+// Set assigns text to a variable. The value is quoted so it is taken as is, spaces,
+// semicolons and all, e.g. an expression such as "Sum(Sales)" to expand later.
+func (b *ScriptBuilder) Set(variable, value string) *ScriptBuilder {
+	return b.Statement("SET " + variable + " = " + QuoteString(value) + ";")
+}
+
+// Let assigns the value of an expression to a variable.
+func (b *ScriptBuilder) Let(variable, expression string) *ScriptBuilder {
+	return b.Statement("LET " + variable + " = " + expression + ";")
+}
+
+func (b *ScriptBuilder) Load(load *LoadStatement) *ScriptBuilder {
+	return b.Statement(load.String())
+}
+
+// Store writes a table to a file, format being FORMAT_QVD, FORMAT_PARQUET or "txt".
+func (b *ScriptBuilder) Store(table, path, format string) *ScriptBuilder {
+	statement := "STORE " + QuoteName(table) + " INTO " + quotePath(path)
+	if len(format) > 0 {
+		statement += " (" + format + ")"
+	}
+	return b.Statement(statement + ";")
+}
+
+// DropTable drops a table, e.g. a temporary one loaded for a RESIDENT load.
+func (b *ScriptBuilder) DropTable(table string) *ScriptBuilder {
+	return b.Statement("DROP TABLE " + QuoteName(table) + ";")
+}
+
+// Statement adds a statement as is.
+func (b *ScriptBuilder) Statement(statement string) *ScriptBuilder {
+	b.statements = append(b.statements, statement)
+	return b
+}
+
+// String separates the statements by blank lines.
+func (b *ScriptBuilder) String() string {
+	return strings.Join(b.statements, SCRIPT_NEWLINE+SCRIPT_NEWLINE) + SCRIPT_NEWLINE
+}
@@ -0,0 +1,194 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"strings"
+	"testing"
+)
+
+func TestParseScript(t *testing.T) {
+	script := "///$tab Main\r\nSET a=1;\r\n///$tab Data\r\nLOAD 1;\r\n"
+	parsed := glik.ParseScript(script)
+	if len(parsed.Sections) != 2 || parsed.Sections[0].Name != "Main" || parsed.Sections[1].Body != "LOAD 1;\r\n" {
+		t.Fatalf("got %+v", parsed.Sections)
+	}
+	if parsed.String() != script {
+		t.Errorf("got %q", parsed.String())
+	}
+	// scripts never opened in the script editor have no tabs
+	untabbed := glik.ParseScript("LOAD 1;\nLOAD 2;")
+	if len(untabbed.Sections) != 1 || untabbed.Sections[0].Name != glik.DEFAULT_SCRIPT_SECTION || untabbed.Sections[0].Body != "LOAD 1;\r\nLOAD 2;" {
+		t.Errorf("got %+v", untabbed.Sections)
+	}
+	if empty := glik.ParseScript("///$tab Main\r\n///$tab Empty"); len(empty.Sections) != 2 {
+		t.Errorf("got %+v", empty.Sections)
+	}
+	if sections := glik.ParseScript("").Sections; len(sections) != 0 {
+		t.Errorf("got %+v", sections)
+	}
+}
+
+func TestScriptSections(t *testing.T) {
+	script := glik.ParseScript("///$tab Main\r\nSET a=1;\r\n///$tab Data\r\nLOAD 1;")
+	script.Set("Data", "LOAD 2;")
+	script.Set("Calendar", "LOAD 3;")
+	if err := script.Move("Calendar", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := script.Insert(1, "Store", "STORE x INTO y;"); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, section := range script.Sections {
+		names = append(names, section.Name)
+	}
+	if strings.Join(names, ",") != "Calendar,Store,Main,Data" {
+		t.Errorf("got %v", names)
+	}
+	if body, ok := script.Section("Data"); !ok || body != "LOAD 2;" {
+		t.Errorf("got %q, %v", body, ok)
+	}
+	if err := script.Insert(0, "Main", ""); err == nil {
+		t.Error("expected an error inserting a section twice")
+	}
+	if err := script.Insert(9, "Other", ""); err == nil {
+		t.Error("expected an error inserting out of range")
+	}
+	if err := script.Move("Nope", 0); err != glik.ErrDoesNotExist {
+		t.Errorf("got %v", err)
+	}
+	if err := script.Move("Main", 9); err == nil || script.Index("Main") != 2 {
+		t.Errorf("got %v, main at %v", err, script.Index("Main"))
+	}
+	if !script.Remove("Store") || script.Remove("Store") || len(script.Sections) != 3 {
+		t.Errorf("got %+v", script.Sections)
+	}
+}
+
+func TestScriptSectionsOfDoc(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "LOAD 1 as A AutoGenerate 1;")
+	doc := openTestDoc(t, server, "Sales.qvf")
+	script, err := doc.GetScriptSections()
+	if err != nil {
+		t.Fatal(err)
+	}
+	script.Set("Data", "LOAD 2 as B AutoGenerate 1;")
+	if err := doc.SetScriptSections(script); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := doc.GetScript(); err != nil || got != "///$tab Main\r\nLOAD 1 as A AutoGenerate 1;\r\n///$tab Data\r\nLOAD 2 as B AutoGenerate 1;" {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+func TestQuoteName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Sales", "Sales"},
+		{"_order_id2", "_order_id2"},
+		{"Order Id", "[Order Id]"},
+		{"2016", "[2016]"},
+		{"Total [x]", "[Total [x]]]"},
+		{"Coût", "[Coût]"},
+		{"From", "[From]"},
+		{"load", "[load]"},
+		{"AS", "[AS]"},
+		{"Where", "[Where]"},
+		{"Resident", "[Resident]"},
+		{"Loaded", "Loaded"},
+	}
+	for _, test := range tests {
+		if got := glik.QuoteName(test.name); got != test.want {
+			t.Errorf("got %s, want %s", got, test.want)
+		}
+	}
+	if got := glik.QuoteString("o'brien"); got != "'o''brien'" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestScriptBuilder(t *testing.T) {
+	builder := glik.NewScriptBuilder().LibConnect("Data (o'brien)").Set("vFormat", "#,##0; -#,##0").Let("vYear", "Year(Today())").
+		Load(glik.Load(glik.LoadField("Order Id"), glik.LoadField("From"), glik.LoadExpr("Sum(Amount)", "Total")).Label("Sales Tmp").
+			From("lib://Data/sales.qvd", glik.FORMAT_QVD).Where("Year > 2015").GroupBy("Order Id", "From")).
+		Load(glik.Load().Distinct().Label("Sales").Resident("Sales Tmp")).
+		Store("Sales", "lib://Out/sales.qvd", glik.FORMAT_QVD).DropTable("Sales Tmp")
+	want := strings.Join([]string{
+		"LIB CONNECT TO 'Data (o''brien)';",
+		"SET vFormat = '#,##0; -#,##0';",
+		"LET vYear = Year(Today());",
+		"[Sales Tmp]:\r\nLOAD\r\n\t[Order Id],\r\n\t[From],\r\n\tSum(Amount) AS Total\r\nFROM [lib://Data/sales.qvd]\r\n(qvd)\r\nWHERE Year > 2015\r\nGROUP BY [Order Id], [From];",
+		"Sales:\r\nLOAD DISTINCT *\r\nRESIDENT [Sales Tmp];",
+		"STORE Sales INTO [lib://Out/sales.qvd] (qvd);",
+		"DROP TABLE [Sales Tmp];",
+	}, "\r\n\r\n") + "\r\n"
+	if got := builder.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// serveScriptSyntax reports a two character error at the start of every line of the
+// script starting with "LOADX".
+func serveScriptSyntax(server *enginetest.Server) {
+	server.Handle("Doc.CheckScriptSyntax", func(call *enginetest.Call) (interface{}, error) {
+		errors := []map[string]interface{}{}
+		for tab, section := range glik.ParseScript(call.Doc().Script).Sections {
+			for line, text := range strings.Split(section.Body, glik.SCRIPT_NEWLINE) {
+				if strings.HasPrefix(text, "LOADX") {
+					errors = append(errors, map[string]interface{}{"qErrLen": 2, "qTabIx": tab, "qLineInTab": line, "qColInLine": 0, "qSecondaryFailure": len(errors) > 0})
+				}
+			}
+		}
+		return map[string]interface{}{"qErrors": errors}, nil
+	})
+}
+
+func TestCheckScriptSyntax(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "///$tab Main\r\nSET a=1;\r\n///$tab Data\r\nLOAD 1 as x AutoGenerate 1;\r\nLOADX foo;\r\nLOADX bar;")
+	serveScriptSyntax(server)
+	doc := openTestDoc(t, server, "Sales.qvf")
+	errors, err := doc.CheckScriptSyntax()
+	if err != nil || len(errors) != 2 {
+		t.Fatalf("got %+v, %v", errors, err)
+	}
+	if errors[0].String() != "Data:2:1: LOADX foo;" || errors[0].Length != 2 || errors[0].SecondaryFailure || !errors[1].SecondaryFailure || errors[1].Line != 3 {
+		t.Errorf("got %+v", errors)
+	}
+}
+
+func TestValidateScript(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	original := "///$tab Main\r\nSET a=1;"
+	app := server.AddDoc("Sales.qvf", original)
+	serveScriptSyntax(server)
+	doc := openTestDoc(t, server, "Sales.qvf")
+	err := doc.ValidateScript("///$tab Main\r\nSET a=1;\r\n///$tab Data\r\nLOADX foo;")
+	syntaxError, ok := err.(*glik.ScriptSyntaxError)
+	if !ok || len(syntaxError.Errors) != 1 || err.Error() != "error in script:Data:1:1: LOADX foo;" {
+		t.Fatalf("got %#v", err)
+	}
+	if app.Script != original {
+		t.Errorf("the script was not put back, got %q", app.Script)
+	}
+	if err := doc.ValidateScript("///$tab Main\r\nLOAD 1 as x AutoGenerate 1;"); err != nil || app.Script != original {
+		t.Errorf("got %v, script %q", err, app.Script)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"errors"
+	"github.com/satori/go.uuid"
+)
+
+// the engine only serves session apps on websockets opened against /app/SessionApp_<id>
+const SESSION_APP_PREFIX = "SessionApp_"
+
+var ErrReloadFailed = errors.New("reload failed")
+
+// CreateSessionApp creates an empty app living as long as the websocket session, on
+// a websocket opened by OpenSessionApp or OpenAppWebSocket with a SESSION_APP_PREFIX id.
+func (api *API) CreateSessionApp() (*Doc, error) {
+	return api.createSessionApp("CreateSessionApp", []interface{}{})
+}
+
+// CreateSessionAppFromApp creates a session app with the script, data and objects of
+// the app srcAppId, which is left as is.
+func (api *API) CreateSessionAppFromApp(srcAppId string) (*Doc, error) {
+	return api.createSessionApp("CreateSessionAppFromApp", []interface{}{srcAppId})
+}
+
+func (api *API) createSessionApp(method string, params []interface{}) (*Doc, error) {
+	var result struct {
+		SessionAppId string `json:"qSessionAppId"`
+		Return       Return `json:"qReturn"`
+	}
+	err := api.call(GLOBAL_HANDLE, method, params, &result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Return.Handle == 0 {
+		return nil, ErrDoesNotExist
+	}
+	return &Doc{api: api, Handle: result.Return.Handle, AppId: result.SessionAppId}, nil
+}
+
+// OpenSessionApp opens a websocket for a new session app and creates the app on it.
+// The app is gone once CloseWebSocket is called, so tests need no clean up:
+//
+//	doc, err := api.OpenSessionApp()
+//	defer api.CloseWebSocket()
+//	err = doc.LoadScript("LOAD * INLINE [Region, Sales\nEast, 10\nWest, 20];")
+//	total, err := doc.Evaluate("Sum(Sales)")
+func (api *API) OpenSessionApp() (*Doc, error) {
+	err := api.OpenAppWebSocket(SESSION_APP_PREFIX + uuid.NewV4().String())
+	if err != nil {
+		return nil, err
+	}
+	doc, err := api.CreateSessionApp()
+	if err != nil {
+		api.CloseWebSocket()
+		return nil, err
+	}
+	return doc, nil
+}
+
+// OpenSessionAppFromApp opens a websocket for a new session app copied from srcAppId.
+func (api *API) OpenSessionAppFromApp(srcAppId string) (*Doc, error) {
+	err := api.OpenAppWebSocket(SESSION_APP_PREFIX + uuid.NewV4().String())
+	if err != nil {
+		return nil, err
+	}
+	doc, err := api.CreateSessionAppFromApp(srcAppId)
+	if err != nil {
+		api.CloseWebSocket()
+		return nil, err
+	}
+	return doc, nil
+}
+
+// LoadScript sets the app's load script and reloads it, returning ErrReloadFailed if
+// the script fails.
+func (d *Doc) LoadScript(script string) error {
+	err := d.SetScript(script)
+	if err != nil {
+		return err
+	}
+	success, err := d.DoReload(RELOAD_MODE_DEFAULT, false)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return ErrReloadFailed
+	}
+	return nil
+}
+
+// Query returns all rows of a straight table of the dimensions and measures, see
+// NewHyperCubeDef, through a session hypercube.
+func (d *Doc) Query(dimensions, measures []string) ([][]NxCell, error) {
+	cube, err := d.CreateHyperCube(NewHyperCubeDef(dimensions, measures))
+	if err != nil {
+		return nil, err
+	}
+	defer cube.Close()
+	retval := [][]NxCell{}
+	rows := cube.Rows()
+	for rows.Next() {
+		retval = append(retval, rows.Row())
+	}
+	return retval, rows.Err()
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"strings"
+	"testing"
+)
+
+func TestSessionApp(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.Handle("Doc.Evaluate", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qReturn": call.Doc().Script}, nil
+	})
+	api := server.API()
+	doc, err := api.OpenSessionApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(doc.AppId, glik.SESSION_APP_PREFIX) {
+		t.Errorf("got app %q", doc.AppId)
+	}
+	if err := doc.LoadScript("LOAD 1 as x AutoGenerate 1;"); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := doc.Evaluate("x"); err != nil || value != "LOAD 1 as x AutoGenerate 1;" {
+		t.Errorf("got %q, %v", value, err)
+	}
+	reloads := 0
+	for _, request := range server.Requests() {
+		if request.Method == "DoReload" {
+			reloads++
+		}
+	}
+	if reloads != 1 {
+		t.Errorf("got %v reloads", reloads)
+	}
+	api.CloseWebSocket()
+	if server.Doc(doc.AppId) != nil {
+		t.Errorf("the session app %q is listed with the apps", doc.AppId)
+	}
+}
+
+func TestSessionAppReloadFailed(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.Handle("Doc.DoReload", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qReturn": false}, nil
+	})
+	api := server.API()
+	doc, err := api.OpenSessionApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.CloseWebSocket()
+	if err := doc.LoadScript("LOAD x;"); err != glik.ErrReloadFailed {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestSessionAppFromApp(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "LOAD 1 as A AutoGenerate 1;")
+	source := openTestDoc(t, server, "Sales.qvf")
+	if _, err := source.CreateMeasure(glik.NewMeasureProperties("kpi-revenue", "Revenue", "Sum(Sales)")); err != nil {
+		t.Fatal(err)
+	}
+	api := server.API()
+	doc, err := api.OpenSessionAppFromApp("Sales.qvf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.CloseWebSocket()
+	if script, err := doc.GetScript(); err != nil || script != "LOAD 1 as A AutoGenerate 1;" {
+		t.Errorf("got %q, %v", script, err)
+	}
+	if _, err := doc.GetMeasure("kpi-revenue"); err != nil {
+		t.Error(err)
+	}
+	// the copy is changed, not the source
+	if err := doc.SetScript("LOAD 2 as B AutoGenerate 1;"); err != nil {
+		t.Fatal(err)
+	}
+	if server.Doc("Sales.qvf").Script != "LOAD 1 as A AutoGenerate 1;" {
+		t.Errorf("the source app changed to %q", server.Doc("Sales.qvf").Script)
+	}
+	other := server.API()
+	if _, err := other.OpenSessionAppFromApp("Missing.qvf"); err == nil {
+		t.Error("expected an error copying a missing app")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	rows := 3
+	var fetched []glik.NxPage
+	serveCube(server, &rows, &fetched)
+	api := server.API()
+	doc, err := api.OpenSessionApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.CloseWebSocket()
+	matrix, err := doc.Query([]string{"Region"}, []string{"Sum(Sales)"})
+	if err != nil || len(matrix) != 3 || matrix[2][0].Text != "r2" || float64(matrix[2][1].Num) != 1.5 {
+		t.Fatalf("got %+v, %v", matrix, err)
+	}
+	created, destroyed := 0, 0
+	for _, request := range server.Requests() {
+		switch request.Method {
+		case "CreateSessionObject":
+			created++
+		case "DestroySessionObject":
+			destroyed++
+		}
+	}
+	if created != 1 || destroyed != 1 {
+		t.Errorf("created %v session objects, destroyed %v", created, destroyed)
+	}
+}
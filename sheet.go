@@ -0,0 +1,253 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"fmt"
+)
+
+const SHEET_TYPE = "sheet"
+
+// the grid of sheets made by the hub
+const SHEET_COLUMNS = 24
+const SHEET_ROWS = 12
+
+// visualization types of the charts shipped with the client
+const (
+	VIZ_BARCHART   = "barchart"
+	VIZ_LINECHART  = "linechart"
+	VIZ_KPI        = "kpi"
+	VIZ_TABLE      = "table"
+	VIZ_FILTERPANE = "filterpane"
+	VIZ_LISTBOX    = "listbox"
+)
+
+// SheetCell places a child object, by id, on the sheet's grid.
+type SheetCell struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Col     int    `json:"col"`
+	Row     int    `json:"row"`
+	Colspan int    `json:"colspan"`
+	Rowspan int    `json:"rowspan"`
+}
+
+type SheetProperties struct {
+	Info         NxInfo        `json:"qInfo"`
+	MetaDef      MetaDef       `json:"qMetaDef"`
+	Rank         int           `json:"rank"`
+	Thumbnail    *Thumbnail    `json:"thumbnail,omitempty"`
+	Columns      int           `json:"columns"`
+	Rows         int           `json:"rows"`
+	Cells        []SheetCell   `json:"cells"`
+	ChildListDef *ChildListDef `json:"qChildListDef,omitempty"`
+}
+
+// NewSheetProperties defines an empty sheet on the hub's grid, id may be empty for
+// the engine to choose one.
+func NewSheetProperties(id, title, description string) SheetProperties {
+	return SheetProperties{
+		Info:      NxInfo{Id: id, Type: SHEET_TYPE},
+		MetaDef:   MetaDef{Title: title, Description: description},
+		Thumbnail: NewThumbnail(""),
+		Columns:   SHEET_COLUMNS,
+		Rows:      SHEET_ROWS,
+		Cells:     []SheetCell{},
+		ChildListDef: &ChildListDef{Data: &Data{Title: "/title",
+			Description: "/description",
+			Meta:        "/meta",
+			Order:       "/order",
+			Type:        "/qInfo/qType",
+			Id:          "/qInfo/qId",
+			Lb:          "/qListObjectDef",
+			Hc:          "/qHyperCubeDef"}},
+	}
+}
+
+// FieldDimension is a chart dimension on a field, or a calculated dimension starting with "=".
+func FieldDimension(field string) NxDimension {
+	return NxDimension{Def: NxInlineDimensionDef{FieldDefs: []string{field}}}
+}
+
+// MasterDimension is a chart dimension linked to the master dimension with the id.
+func MasterDimension(id string) NxDimension {
+	return NxDimension{LibraryId: id, Def: NxInlineDimensionDef{FieldDefs: []string{}}}
+}
+
+// ExpressionMeasure is a chart measure with its own expression and label.
+func ExpressionMeasure(label, expression string) NxMeasure {
+	return NxMeasure{Def: NxInlineMeasureDef{Label: label, Def: expression}}
+}
+
+// MasterMeasure is a chart measure linked to the master measure with the id.
+func MasterMeasure(id string) NxMeasure {
+	return NxMeasure{LibraryId: id}
+}
+
+// Chart is a visualization to place on a sheet. A filter pane shows a list box for
+// each of its Dimensions and has no Measures, a KPI has no Dimensions.
+type Chart struct {
+	Id         string
+	Type       string
+	Title      string
+	Dimensions []NxDimension
+	Measures   []NxMeasure
+}
+
+func BarChart(title string, dimensions []NxDimension, measures []NxMeasure) Chart {
+	return Chart{Type: VIZ_BARCHART, Title: title, Dimensions: dimensions, Measures: measures}
+}
+
+func LineChart(title string, dimensions []NxDimension, measures []NxMeasure) Chart {
+	return Chart{Type: VIZ_LINECHART, Title: title, Dimensions: dimensions, Measures: measures}
+}
+
+func KPI(title string, measures ...NxMeasure) Chart {
+	return Chart{Type: VIZ_KPI, Title: title, Dimensions: []NxDimension{}, Measures: measures}
+}
+
+func Table(title string, dimensions []NxDimension, measures []NxMeasure) Chart {
+	return Chart{Type: VIZ_TABLE, Title: title, Dimensions: dimensions, Measures: measures}
+}
+
+func FilterPane(title string, dimensions ...NxDimension) Chart {
+	return Chart{Type: VIZ_FILTERPANE, Title: title, Dimensions: dimensions, Measures: []NxMeasure{}}
+}
+
+func (c Chart) properties() map[string]interface{} {
+	retval := map[string]interface{}{
+		"qInfo":         NxInfo{Id: c.Id, Type: c.Type},
+		"visualization": c.Type,
+		"title":         c.Title,
+		"showTitles":    len(c.Title) > 0,
+	}
+	if c.Type != VIZ_FILTERPANE {
+		cube := HyperCubeDef{Dimensions: c.Dimensions, Measures: c.Measures, InitialDataFetch: []NxPage{}, SuppressMissing: true, Mode: "S"}
+		if cube.Dimensions == nil {
+			cube.Dimensions = []NxDimension{}
+		}
+		if cube.Measures == nil {
+			cube.Measures = []NxMeasure{}
+		}
+		retval["qHyperCubeDef"] = cube
+	}
+	return retval
+}
+
+func listBoxProperties(dimension NxDimension) map[string]interface{} {
+	return map[string]interface{}{
+		"qInfo":          NxInfo{Type: VIZ_LISTBOX},
+		"visualization":  VIZ_LISTBOX,
+		"qListObjectDef": dimension,
+	}
+}
+
+// CreateChild creates an object owned by this one, as charts are by their sheet.
+func (o *GenericObject) CreateChild(properties interface{}) (*GenericObject, error) {
+	handle, err := o.api.callForHandle(o.Handle, "CreateChild", []interface{}{properties})
+	if err != nil {
+		return nil, err
+	}
+	id := handle.GenericId
+	return &GenericObject{api: o.api, Handle: handle.Handle, Id: id, Type: handle.GenericType}, nil
+}
+
+// SheetBuilder creates a sheet with its charts, see Doc.NewSheet.
+type SheetBuilder struct {
+	doc        *Doc
+	properties SheetProperties
+	charts     []Chart
+	err        error
+}
+
+// NewSheet starts building a sheet on the hub's grid of SHEET_COLUMNS by SHEET_ROWS,
+// id may be empty for the engine to choose one. Nothing is created before Create.
+//
+//	sheet, err := doc.NewSheet("landing", "Overview").
+//		Add(glik.KPI("Revenue", glik.MasterMeasure("kpi-revenue")), 0, 0, 6, 3).
+//		Add(glik.FilterPane("", glik.FieldDimension("Region")), 0, 3, 6, 9).
+//		Create()
+func (d *Doc) NewSheet(id, title string) *SheetBuilder {
+	return &SheetBuilder{doc: d, properties: NewSheetProperties(id, title, "")}
+}
+
+func (b *SheetBuilder) Description(description string) *SheetBuilder {
+	b.properties.MetaDef.Description = description
+	return b
+}
+
+// Rank orders the sheet among the app's sheets.
+func (b *SheetBuilder) Rank(rank int) *SheetBuilder {
+	b.properties.Rank = rank
+	return b
+}
+
+// Grid changes the number of columns and rows charts are placed on.
+func (b *SheetBuilder) Grid(columns, rows int) *SheetBuilder {
+	b.properties.Columns = columns
+	b.properties.Rows = rows
+	return b
+}
+
+// Add places a chart with its top left corner at col, row. Charts must not overlap
+// nor leave the grid.
+func (b *SheetBuilder) Add(chart Chart, col, row, colspan, rowspan int) *SheetBuilder {
+	if b.err != nil {
+		return b
+	}
+	cell := SheetCell{Type: chart.Type, Col: col, Row: row, Colspan: colspan, Rowspan: rowspan}
+	if col < 0 || row < 0 || colspan < 1 || rowspan < 1 || col+colspan > b.properties.Columns || row+rowspan > b.properties.Rows {
+		b.err = fmt.Errorf("error adding %s [%s]:cell %d,%d %dx%d is outside the %dx%d grid", chart.Type, chart.Title, col, row, colspan, rowspan, b.properties.Columns, b.properties.Rows)
+		return b
+	}
+	for i, other := range b.properties.Cells {
+		if col < other.Col+other.Colspan && other.Col < col+colspan && row < other.Row+other.Rowspan && other.Row < row+rowspan {
+			b.err = fmt.Errorf("error adding %s [%s]:cell overlaps %s [%s]", chart.Type, chart.Title, other.Type, b.charts[i].Title)
+			return b
+		}
+	}
+	b.properties.Cells = append(b.properties.Cells, cell)
+	b.charts = append(b.charts, chart)
+	return b
+}
+
+// Create creates the sheet, then its charts as children of it, and lays them out.
+func (b *SheetBuilder) Create() (*GenericObject, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	properties := b.properties
+	cells := properties.Cells
+	properties.Cells = []SheetCell{}
+	sheet, err := b.doc.CreateObject(properties)
+	if err != nil {
+		return nil, err
+	}
+	properties.Info.Id = sheet.Id
+	for i, chart := range b.charts {
+		child, err := sheet.CreateChild(chart.properties())
+		if err != nil {
+			return sheet, fmt.Errorf("error creating %s [%s]:%v", chart.Type, chart.Title, err)
+		}
+		if chart.Type == VIZ_FILTERPANE {
+			for _, dimension := range chart.Dimensions {
+				_, err = child.CreateChild(listBoxProperties(dimension))
+				if err != nil {
+					return sheet, fmt.Errorf("error creating %s [%s]:%v", VIZ_LISTBOX, chart.Title, err)
+				}
+			}
+		}
+		cells[i].Name = child.Id
+		properties.Cells = append(properties.Cells, cells[i])
+	}
+	return sheet, sheet.SetProperties(properties)
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"strings"
+	"testing"
+)
+
+// createLanding builds a sheet with a KPI, a bar chart and a two field filter pane.
+func createLanding(doc *glik.Doc) (*glik.GenericObject, error) {
+	return doc.NewSheet("landing", "Overview").Description("The big picture").Rank(2).
+		Add(glik.KPI("Revenue", glik.MasterMeasure("kpi-revenue")), 0, 0, 6, 3).
+		Add(glik.BarChart("By region", []glik.NxDimension{glik.MasterDimension("dim-region")}, []glik.NxMeasure{glik.ExpressionMeasure("Sales", "Sum(Sales)")}), 6, 0, 18, 12).
+		Add(glik.FilterPane("", glik.FieldDimension("Region"), glik.FieldDimension("Year")), 0, 3, 6, 9).
+		Create()
+}
+
+func TestSheetBuilder(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	doc := openTestDoc(t, server, "Sales.qvf")
+	sheet, err := createLanding(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sheet.Id != "landing" {
+		t.Errorf("got sheet %v", sheet.Id)
+	}
+	var properties glik.SheetProperties
+	if err := sheet.GetProperties(&properties); err != nil {
+		t.Fatal(err)
+	}
+	if properties.MetaDef.Title != "Overview" || properties.MetaDef.Description != "The big picture" || properties.Rank != 2 || len(properties.Cells) != 3 {
+		t.Fatalf("got %+v", properties)
+	}
+	infos, err := sheet.GetChildInfos()
+	if err != nil || len(infos) != 3 {
+		t.Fatalf("got %+v, %v", infos, err)
+	}
+	for i, want := range []glik.SheetCell{
+		{Type: glik.VIZ_KPI, Col: 0, Row: 0, Colspan: 6, Rowspan: 3},
+		{Type: glik.VIZ_BARCHART, Col: 6, Row: 0, Colspan: 18, Rowspan: 12},
+		{Type: glik.VIZ_FILTERPANE, Col: 0, Row: 3, Colspan: 6, Rowspan: 9},
+	} {
+		cell := properties.Cells[i]
+		want.Name = cell.Name
+		if cell != want || len(cell.Name) == 0 {
+			t.Errorf("cell %v: got %+v, want %+v", i, cell, want)
+		}
+		child, err := doc.GetObject(cell.Name)
+		if err != nil || child.Type != want.Type {
+			t.Errorf("cell %v: got %+v, %v", i, child, err)
+		}
+	}
+	pane, err := doc.GetObject(properties.Cells[2].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listBoxes, err := pane.GetChildInfos(); err != nil || len(listBoxes) != 2 || listBoxes[0].Type != glik.VIZ_LISTBOX {
+		t.Errorf("got %+v, %v", listBoxes, err)
+	}
+	var bar map[string]interface{}
+	child, _ := doc.GetObject(properties.Cells[1].Name)
+	if err := child.GetProperties(&bar); err != nil {
+		t.Fatal(err)
+	}
+	if bar["title"] != "By region" || bar["showTitles"] != true || bar["qHyperCubeDef"] == nil {
+		t.Errorf("got %v", bar)
+	}
+}
+
+func TestSheetBuilderLayoutErrors(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	doc := openTestDoc(t, server, "Sales.qvf")
+	tests := []struct {
+		builder *glik.SheetBuilder
+		err     string
+	}{
+		{doc.NewSheet("", "x").Add(glik.KPI("a"), 0, 0, 6, 3).Add(glik.KPI("b"), 5, 2, 3, 3), "overlaps kpi [a]"},
+		{doc.NewSheet("", "x").Add(glik.KPI("a"), 20, 0, 6, 3), "outside the 24x12 grid"},
+		{doc.NewSheet("", "x").Add(glik.KPI("a"), 0, 0, 0, 3), "outside"},
+		{doc.NewSheet("", "x").Grid(12, 6).Add(glik.KPI("a"), 6, 0, 7, 3), "outside the 12x6 grid"},
+	}
+	for _, test := range tests {
+		if _, err := test.builder.Create(); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("got %v, want %q", err, test.err)
+		}
+	}
+	for _, request := range server.Requests() {
+		if request.Method == "CreateObject" {
+			t.Errorf("created an object for an invalid layout: %s", request.Params)
+		}
+	}
+	// adjacent cells do not overlap
+	if _, err := doc.NewSheet("", "x").Add(glik.KPI("a"), 0, 0, 6, 3).Add(glik.KPI("b"), 6, 0, 6, 3).Add(glik.KPI("c"), 0, 3, 6, 3).Create(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+// DEFAULT_STATE is the name of the default state, an empty state name means the same.
+const DEFAULT_STATE = "$"
+
+// AddAlternateState adds a selection state, selections made in it do not affect
+// the default state or other alternate states.
+func (d *Doc) AddAlternateState(name string) error {
+	return d.call("AddAlternateState", []interface{}{name}, nil)
+}
+
+func (d *Doc) RemoveAlternateState(name string) error {
+	return d.call("RemoveAlternateState", []interface{}{name}, nil)
+}
+
+// AppLayout is the part of Doc.GetAppLayout glik reads.
+type AppLayout struct {
+	Title               string   `json:"qTitle"`
+	FileName            string   `json:"qFileName"`
+	HasScript           bool     `json:"qHasScript"`
+	StateNames          []string `json:"qStateNames"`
+	IsOpenedWithoutData bool     `json:"qIsOpenedWithoutData,omitempty"`
+}
+
+func (d *Doc) GetAppLayout() (AppLayout, error) {
+	var result struct {
+		Layout AppLayout `json:"qLayout"`
+	}
+	err := d.call("GetAppLayout", nil, &result)
+	return result.Layout, err
+}
+
+// AlternateStates lists the app's alternate states.
+func (d *Doc) AlternateStates() ([]string, error) {
+	layout, err := d.GetAppLayout()
+	if layout.StateNames == nil {
+		layout.StateNames = []string{}
+	}
+	return layout.StateNames, err
+}
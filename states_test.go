@@ -0,0 +1,151 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"testing"
+)
+
+// serveStates scripts AddAlternateState, RemoveAlternateState and the qStateNames of
+// GetAppLayout over the list of states.
+func serveStates(server *enginetest.Server, states *[]string) {
+	server.Handle("Doc.AddAlternateState", func(call *enginetest.Call) (interface{}, error) {
+		var name string
+		if err := call.Arg(0, "qStateName", &name); err != nil {
+			return nil, err
+		}
+		*states = append(*states, name)
+		return nil, nil
+	})
+	server.Handle("Doc.RemoveAlternateState", func(call *enginetest.Call) (interface{}, error) {
+		var name string
+		if err := call.Arg(0, "qStateName", &name); err != nil {
+			return nil, err
+		}
+		for i, state := range *states {
+			if state == name {
+				*states = append((*states)[:i], (*states)[i+1:]...)
+				return nil, nil
+			}
+		}
+		return nil, &enginetest.Error{Code: enginetest.LOCERR_GENERIC_NOT_FOUND, Parameter: name, Message: "Not found"}
+	})
+	server.Handle("Doc.GetAppLayout", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qLayout": glik.AppLayout{Title: call.Doc().Name, StateNames: *states}}, nil
+	})
+}
+
+func TestAlternateStates(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	var states []string
+	serveStates(server, &states)
+	doc := openTestDoc(t, server, "Sales.qvf")
+	if got, err := doc.AlternateStates(); err != nil || got == nil || len(got) != 0 {
+		t.Errorf("got %#v, %v without states", got, err)
+	}
+	for _, state := range []string{"Compare", "Baseline"} {
+		if err := doc.AddAlternateState(state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := doc.RemoveAlternateState("Compare"); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.RemoveAlternateState("Compare"); err == nil {
+		t.Error("expected an error removing a missing state")
+	}
+	if got, err := doc.AlternateStates(); err != nil || fmt.Sprint(got) != "[Baseline]" {
+		t.Errorf("got %v, %v", got, err)
+	}
+}
+
+func TestSelectionsInState(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "").Fields = []string{"Region"}
+	var clearAll []interface{}
+	server.Handle("Doc.ClearAll", func(call *enginetest.Call) (interface{}, error) {
+		json.Unmarshal(call.Params, &clearAll)
+		return nil, nil
+	})
+	stateNames := map[string]interface{}{}
+	server.Handle("GenericObject.GetLayout", func(call *enginetest.Call) (interface{}, error) {
+		properties := call.Object().Properties
+		if call.Object().Type == glik.SELECTIONS_OBJECT_TYPE {
+			stateNames[call.Object().Type] = properties["qStateName"]
+			return map[string]interface{}{"qLayout": map[string]interface{}{"qSelectionObject": map[string]interface{}{"qSelections": []glik.CurrentSelection{
+				{Field: "Region", SelectedCount: 2, Selected: "2 of 4"},
+			}}}}, nil
+		}
+		stateNames[call.Object().Type] = properties["qListObjectDef"].(map[string]interface{})["qStateName"]
+		return map[string]interface{}{"qLayout": map[string]interface{}{"qListObject": map[string]interface{}{"qSize": glik.NxSize{Cx: 1, Cy: 4}}}}, nil
+	})
+	server.Handle("GetListObjectData", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qDataPages": []glik.NxDataPage{{Matrix: [][]glik.NxCell{
+			{{Text: "North", State: glik.STATE_SELECTED}}, {{Text: "South", State: glik.STATE_EXCLUDED}},
+			{{Text: "East", State: glik.STATE_SELECTED}}, {{Text: "West", State: glik.STATE_ALTERNATIVE}},
+		}}}}, nil
+	})
+	doc := openTestDoc(t, server, "Sales.qvf")
+	field, err := doc.FieldInState("Region", "Compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, request := range server.Requests() {
+		if request.Method == "GetField" && string(request.Params) != `["Region","Compare"]` {
+			t.Errorf("got %s", request.Params)
+		}
+	}
+	if field.State != "Compare" {
+		t.Errorf("got field %+v", field)
+	}
+	if err := doc.ClearAllInState(true, "Compare"); err != nil || fmt.Sprint(clearAll) != "[true Compare]" {
+		t.Errorf("sent %v, %v", clearAll, err)
+	}
+	if err := doc.ClearAll(false); err != nil || fmt.Sprint(clearAll) != "[false ]" {
+		t.Errorf("sent %v, %v", clearAll, err)
+	}
+	selections, err := doc.CurrentSelectionsInState("Compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selections) != 1 || fmt.Sprint(selections[0].Values) != "[North East]" {
+		t.Errorf("got %+v", selections)
+	}
+	if stateNames[glik.SELECTIONS_OBJECT_TYPE] != "Compare" || stateNames[glik.LIST_OBJECT_TYPE] != "Compare" {
+		t.Errorf("got states %v", stateNames)
+	}
+}
+
+func TestHyperCubeDefInState(t *testing.T) {
+	data, err := json.Marshal(glik.NewHyperCubeDefInState("Compare", []string{"Region"}, []string{"Sum(Sales)"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var def map[string]interface{}
+	json.Unmarshal(data, &def)
+	if def["qStateName"] != "Compare" {
+		t.Errorf("got %s", data)
+	}
+	data, _ = json.Marshal(glik.NewHyperCubeDef([]string{"Region"}, nil))
+	def = nil
+	json.Unmarshal(data, &def)
+	if _, ok := def["qStateName"]; ok {
+		t.Errorf("got a state in the default state: %s", data)
+	}
+}
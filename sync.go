@@ -0,0 +1,528 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"strings"
+)
+
+// A Catalog declares the master items and variables apps should have, in YAML or JSON:
+//
+//	dimensions:
+//	  - id: dim-region
+//	    title: Region
+//	    fields: [Region]
+//	measures:
+//	  - id: kpi-revenue
+//	    title: Revenue
+//	    expression: Sum(Sales)
+//	    tags: [kpi]
+//	variables:
+//	  - name: vCurrentYear
+//	    definition: =Year(Today())
+//
+// Dimensions and measures are matched to the app's items by id, variables by name.
+type Catalog struct {
+	Dimensions []CatalogDimension `json:"dimensions,omitempty" yaml:"dimensions,omitempty"`
+	Measures   []CatalogMeasure   `json:"measures,omitempty" yaml:"measures,omitempty"`
+	Variables  []CatalogVariable  `json:"variables,omitempty" yaml:"variables,omitempty"`
+}
+
+// CatalogDimension is a master dimension. Labels default to the title for a single
+// field, to the field names for groups. Grouping defaults to GROUPING_NONE.
+type CatalogDimension struct {
+	Id          string   `json:"id" yaml:"id"`
+	Title       string   `json:"title" yaml:"title"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Fields      []string `json:"fields" yaml:"fields"`
+	Labels      []string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Grouping    string   `json:"grouping,omitempty" yaml:"grouping,omitempty"`
+}
+
+// CatalogMeasure is a master measure, Label defaults to the title.
+type CatalogMeasure struct {
+	Id          string   `json:"id" yaml:"id"`
+	Title       string   `json:"title" yaml:"title"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Expression  string   `json:"expression" yaml:"expression"`
+	Label       string   `json:"label,omitempty" yaml:"label,omitempty"`
+}
+
+type CatalogVariable struct {
+	Name       string `json:"name" yaml:"name"`
+	Definition string `json:"definition" yaml:"definition"`
+	Comment    string `json:"comment,omitempty" yaml:"comment,omitempty"`
+}
+
+// LoadCatalog reads a YAML or JSON catalog file.
+func LoadCatalog(path string) (Catalog, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Catalog{}, fmt.Errorf("error reading catalog [%s]:%v", path, err)
+	}
+	catalog, err := ParseCatalog(data)
+	if err != nil {
+		return catalog, fmt.Errorf("error parsing catalog [%s]:%v", path, err)
+	}
+	return catalog, nil
+}
+
+// ParseCatalog parses a YAML or JSON catalog, JSON being valid YAML, and validates it.
+func ParseCatalog(data []byte) (Catalog, error) {
+	var catalog Catalog
+	err := yaml.UnmarshalStrict(data, &catalog)
+	if err != nil {
+		return catalog, err
+	}
+	return catalog, catalog.Validate()
+}
+
+// Validate checks every item has an id or name, unique within its kind, and a definition.
+func (c Catalog) Validate() error {
+	seen := map[string]bool{}
+	check := func(kind, key, definition string) error {
+		if len(key) == 0 {
+			return fmt.Errorf("%s without id or name", kind)
+		}
+		if seen[kind+"/"+key] {
+			return fmt.Errorf("%s [%s] is declared twice", kind, key)
+		}
+		seen[kind+"/"+key] = true
+		if len(strings.TrimSpace(definition)) == 0 {
+			return fmt.Errorf("%s [%s] has no definition", kind, key)
+		}
+		return nil
+	}
+	for _, dimension := range c.Dimensions {
+		if err := check(DIMENSION_TYPE, dimension.Id, strings.Join(dimension.Fields, "")); err != nil {
+			return err
+		}
+	}
+	for _, measure := range c.Measures {
+		if err := check(MEASURE_TYPE, measure.Id, measure.Expression); err != nil {
+			return err
+		}
+	}
+	for _, variable := range c.Variables {
+		if err := check(VARIABLE_TYPE, variable.Name, variable.Definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckExpressions checks the measure expressions, and the variable definitions starting
+// with "=", against the fields of the app, before they are synced to it. A wrong
+// expression is returned as an *ExpressionError naming its measure or variable.
+func (c Catalog) CheckExpressions(doc *Doc) error {
+	checked := func(itemType, id string, err error) error {
+		if expressionError, ok := err.(*ExpressionError); ok {
+			expressionError.ItemType = itemType
+			expressionError.ItemId = id
+			return expressionError
+		}
+		if err != nil {
+			return fmt.Errorf("error checking %s [%s]:%v", itemType, id, err)
+		}
+		return nil
+	}
+	labels := []string{}
+	for _, measure := range c.Measures {
+		labels = append(labels, measure.Title)
+	}
+	for _, measure := range c.Measures {
+		if err := checked(MEASURE_TYPE, measure.Id, doc.CheckExpression(measure.Expression, labels)); err != nil {
+			return err
+		}
+	}
+	for _, variable := range c.Variables {
+		if !strings.HasPrefix(strings.TrimSpace(variable.Definition), "=") {
+			continue
+		}
+		if err := checked(VARIABLE_TYPE, variable.Name, doc.CheckNumberOrExpression(variable.Definition)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncOptions control SyncMasterItems. DryRun only plans the changes, Prune deletes the
+// app's dimensions, measures and variables the catalog does not declare. Variables
+// created by the load script are never pruned.
+type SyncOptions struct {
+	DryRun bool
+	Prune  bool
+}
+
+const (
+	SYNC_CREATE = "create"
+	SYNC_UPDATE = "update"
+	SYNC_DELETE = "delete"
+)
+
+// SyncChange is a change SyncMasterItems makes, or would make on a dry run. Properties
+// names what an update changes.
+type SyncChange struct {
+	Action     string
+	Kind       string
+	Id         string
+	Title      string
+	Properties []string
+	apply      func() error
+}
+
+func (c SyncChange) String() string {
+	retval := fmt.Sprintf("%s %s %s", c.Action, c.Kind, c.Id)
+	if len(c.Title) > 0 && c.Title != c.Id {
+		retval += " (" + c.Title + ")"
+	}
+	if len(c.Properties) > 0 {
+		retval += ": " + strings.Join(c.Properties, ", ")
+	}
+	return retval
+}
+
+type SyncPlan struct {
+	Changes []SyncChange
+}
+
+func (p SyncPlan) String() string {
+	if len(p.Changes) == 0 {
+		return "no changes"
+	}
+	lines := []string{}
+	for _, change := range p.Changes {
+		lines = append(lines, change.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SyncMasterItems reconciles the app's master dimensions, measures and variables with
+// the catalog: it creates missing items, patches drifted ones and with opts.Prune deletes
+// unmanaged ones. It returns the plan, applied unless opts.DryRun. Save the app with
+// DoSave afterwards to keep the changes.
+func SyncMasterItems(doc *Doc, catalog Catalog, opts SyncOptions) (SyncPlan, error) {
+	var plan SyncPlan
+	err := catalog.Validate()
+	if err != nil {
+		return plan, err
+	}
+	for _, planner := range []func(*Doc, Catalog, SyncOptions) ([]SyncChange, error){planDimensions, planMeasures, planVariables} {
+		changes, err := planner(doc, catalog, opts)
+		if err != nil {
+			return plan, err
+		}
+		plan.Changes = append(plan.Changes, changes...)
+	}
+	if opts.DryRun {
+		return plan, nil
+	}
+	for _, change := range plan.Changes {
+		err = change.apply()
+		if err != nil {
+			return plan, fmt.Errorf("error applying [%s]:%v", change, err)
+		}
+	}
+	return plan, nil
+}
+
+// patcher collects the patches for properties that drifted from the catalog. Paths the
+// item has are replaced, the others added.
+type patcher struct {
+	current    map[string]interface{}
+	patches    []NxPatch
+	properties []string
+	err        error
+}
+
+// newPatcher reads the item's properties into have, and as JSON for the paths it has.
+func newPatcher(call func(method string, params interface{}, result interface{}) error, have interface{}) (*patcher, error) {
+	var result struct {
+		Properties json.RawMessage `json:"qProp"`
+	}
+	err := call("GetProperties", nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	retval := &patcher{}
+	if len(result.Properties) == 0 {
+		return retval, nil
+	}
+	err = json.Unmarshal(result.Properties, have)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(result.Properties, &retval.current)
+	return retval, err
+}
+
+func (p *patcher) string(name, path, have, want string) {
+	if have != want {
+		p.add(name, path, want)
+	}
+}
+
+func (p *patcher) strings(name, path string, have, want []string) {
+	if strings.Join(have, "\x00") != strings.Join(want, "\x00") || len(have) != len(want) {
+		if want == nil {
+			want = []string{}
+		}
+		p.add(name, path, want)
+	}
+}
+
+func (p *patcher) add(name, path string, value interface{}) {
+	build := AddPatch
+	if p.has(path) {
+		build = ReplacePatch
+	}
+	patch, err := build(path, value)
+	if err != nil {
+		p.err = err
+		return
+	}
+	p.patches = append(p.patches, patch)
+	p.properties = append(p.properties, name)
+}
+
+// has reports whether the item's properties have the path, e.g. "/qMetaDef/tags".
+func (p *patcher) has(path string) bool {
+	var value interface{} = p.current
+	for _, key := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		value, ok = object[key]
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c CatalogDimension) properties() GenericDimensionProperties {
+	retval := NewDimensionProperties(c.Id, c.Title, "")
+	retval.Dim.FieldDefs = c.Fields
+	retval.Dim.FieldLabels = c.labels()
+	if len(c.Grouping) > 0 {
+		retval.Dim.Grouping = c.Grouping
+	}
+	retval.MetaDef.Description = c.Description
+	if c.Tags != nil {
+		retval.MetaDef.Tags = c.Tags
+	}
+	return retval
+}
+
+func (c CatalogDimension) labels() []string {
+	if len(c.Labels) > 0 {
+		return c.Labels
+	}
+	if len(c.Fields) == 1 {
+		return []string{c.Title}
+	}
+	return c.Fields
+}
+
+func planDimensions(doc *Doc, catalog Catalog, opts SyncOptions) ([]SyncChange, error) {
+	existing, err := doc.Dimensions()
+	if err != nil {
+		return nil, err
+	}
+	retval := []SyncChange{}
+	declared := map[string]bool{}
+	for _, item := range catalog.Dimensions {
+		item := item
+		declared[item.Id] = true
+		if !hasMasterItem(existing, item.Id) {
+			retval = append(retval, SyncChange{Action: SYNC_CREATE, Kind: DIMENSION_TYPE, Id: item.Id, Title: item.Title, apply: func() error {
+				_, err := doc.CreateDimension(item.properties())
+				return err
+			}})
+			continue
+		}
+		dimension, err := doc.GetDimension(item.Id)
+		if err != nil {
+			return nil, err
+		}
+		var have GenericDimensionProperties
+		p, err := newPatcher(dimension.call, &have)
+		if err != nil {
+			return nil, err
+		}
+		want := item.properties()
+		p.string("title", "/qMetaDef/title", have.MetaDef.Title, want.MetaDef.Title)
+		p.string("description", "/qMetaDef/description", have.MetaDef.Description, want.MetaDef.Description)
+		p.strings("tags", "/qMetaDef/tags", have.MetaDef.Tags, want.MetaDef.Tags)
+		p.strings("fields", "/qDim/qFieldDefs", have.Dim.FieldDefs, want.Dim.FieldDefs)
+		p.strings("labels", "/qDim/qFieldLabels", have.Dim.FieldLabels, want.Dim.FieldLabels)
+		p.string("grouping", "/qDim/qGrouping", have.Dim.Grouping, want.Dim.Grouping)
+		if p.err != nil {
+			return nil, p.err
+		}
+		if len(p.patches) > 0 {
+			retval = append(retval, SyncChange{Action: SYNC_UPDATE, Kind: DIMENSION_TYPE, Id: item.Id, Title: item.Title, Properties: p.properties, apply: func() error {
+				return dimension.ApplyPatches(p.patches)
+			}})
+		}
+	}
+	if opts.Prune {
+		for _, item := range existing {
+			id := item.Id
+			if !declared[id] {
+				retval = append(retval, SyncChange{Action: SYNC_DELETE, Kind: DIMENSION_TYPE, Id: id, Title: item.Title, apply: func() error {
+					_, err := doc.DestroyDimension(id)
+					return err
+				}})
+			}
+		}
+	}
+	return retval, nil
+}
+
+func (c CatalogMeasure) properties() GenericMeasureProperties {
+	retval := NewMeasureProperties(c.Id, c.Title, c.Expression)
+	if len(c.Label) > 0 {
+		retval.Measure.Label = c.Label
+	}
+	retval.MetaDef.Description = c.Description
+	if c.Tags != nil {
+		retval.MetaDef.Tags = c.Tags
+	}
+	return retval
+}
+
+func planMeasures(doc *Doc, catalog Catalog, opts SyncOptions) ([]SyncChange, error) {
+	existing, err := doc.Measures()
+	if err != nil {
+		return nil, err
+	}
+	retval := []SyncChange{}
+	declared := map[string]bool{}
+	for _, item := range catalog.Measures {
+		item := item
+		declared[item.Id] = true
+		if !hasMasterItem(existing, item.Id) {
+			retval = append(retval, SyncChange{Action: SYNC_CREATE, Kind: MEASURE_TYPE, Id: item.Id, Title: item.Title, apply: func() error {
+				_, err := doc.CreateMeasure(item.properties())
+				return err
+			}})
+			continue
+		}
+		measure, err := doc.GetMeasure(item.Id)
+		if err != nil {
+			return nil, err
+		}
+		var have GenericMeasureProperties
+		p, err := newPatcher(measure.call, &have)
+		if err != nil {
+			return nil, err
+		}
+		want := item.properties()
+		p.string("title", "/qMetaDef/title", have.MetaDef.Title, want.MetaDef.Title)
+		p.string("description", "/qMetaDef/description", have.MetaDef.Description, want.MetaDef.Description)
+		p.strings("tags", "/qMetaDef/tags", have.MetaDef.Tags, want.MetaDef.Tags)
+		p.string("expression", "/qMeasure/qDef", have.Measure.Def, want.Measure.Def)
+		p.string("label", "/qMeasure/qLabel", have.Measure.Label, want.Measure.Label)
+		if p.err != nil {
+			return nil, p.err
+		}
+		if len(p.patches) > 0 {
+			retval = append(retval, SyncChange{Action: SYNC_UPDATE, Kind: MEASURE_TYPE, Id: item.Id, Title: item.Title, Properties: p.properties, apply: func() error {
+				return measure.ApplyPatches(p.patches)
+			}})
+		}
+	}
+	if opts.Prune {
+		for _, item := range existing {
+			id := item.Id
+			if !declared[id] {
+				retval = append(retval, SyncChange{Action: SYNC_DELETE, Kind: MEASURE_TYPE, Id: id, Title: item.Title, apply: func() error {
+					_, err := doc.DestroyMeasure(id)
+					return err
+				}})
+			}
+		}
+	}
+	return retval, nil
+}
+
+func planVariables(doc *Doc, catalog Catalog, opts SyncOptions) ([]SyncChange, error) {
+	existing, err := doc.Variables()
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]VariableItem{}
+	for _, item := range existing {
+		byName[item.Name] = item
+	}
+	retval := []SyncChange{}
+	declared := map[string]bool{}
+	for _, item := range catalog.Variables {
+		item := item
+		declared[item.Name] = true
+		if _, ok := byName[item.Name]; !ok {
+			retval = append(retval, SyncChange{Action: SYNC_CREATE, Kind: VARIABLE_TYPE, Id: item.Name, apply: func() error {
+				_, err := doc.CreateVariableEx(NewVariableProperties(item.Name, item.Definition, item.Comment))
+				return err
+			}})
+			continue
+		}
+		variable, err := doc.GetVariableByName(item.Name)
+		if err != nil {
+			return nil, err
+		}
+		var have GenericVariableProperties
+		p, err := newPatcher(variable.call, &have)
+		if err != nil {
+			return nil, err
+		}
+		p.string("definition", "/qDefinition", have.Definition, item.Definition)
+		p.string("comment", "/qComment", have.Comment, item.Comment)
+		if p.err != nil {
+			return nil, p.err
+		}
+		if len(p.patches) > 0 {
+			retval = append(retval, SyncChange{Action: SYNC_UPDATE, Kind: VARIABLE_TYPE, Id: item.Name, Properties: p.properties, apply: func() error {
+				return variable.ApplyPatches(p.patches)
+			}})
+		}
+	}
+	if opts.Prune {
+		for _, item := range existing {
+			name := item.Name
+			if !declared[name] && !item.IsScriptCreated {
+				retval = append(retval, SyncChange{Action: SYNC_DELETE, Kind: VARIABLE_TYPE, Id: name, apply: func() error {
+					_, err := doc.DestroyVariableByName(name)
+					return err
+				}})
+			}
+		}
+	}
+	return retval, nil
+}
+
+func hasMasterItem(items []MasterItem, id string) bool {
+	for _, item := range items {
+		if item.Id == id {
+			return true
+		}
+	}
+	return false
+}
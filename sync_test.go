@@ -0,0 +1,111 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"fmt"
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"strings"
+	"testing"
+)
+
+const testCatalog = `
+dimensions:
+  - id: dim-region
+    title: Region
+    fields: [Region]
+measures:
+  - id: kpi-revenue
+    title: Revenue
+    expression: Sum(Sales)
+    tags: [kpi]
+`
+
+func TestParseCatalog(t *testing.T) {
+	catalog, err := glik.ParseCatalog([]byte(testCatalog))
+	if err != nil || len(catalog.Dimensions) != 1 || len(catalog.Measures) != 1 || fmt.Sprint(catalog.Measures[0].Tags) != "[kpi]" {
+		t.Fatalf("got %+v, %v", catalog, err)
+	}
+	for _, test := range []struct {
+		catalog, err string
+	}{
+		{`{"measures":[{"id":"a","title":"x"}]}`, "has no definition"},
+		{`{"measures":[{"title":"x","expression":"1"}]}`, "without id"},
+		{`{"dimensions":[{"id":"a","fields":["A"]},{"id":"a","fields":["B"]}]}`, "declared twice"},
+		{`{"variables":[{"name":"v"}]}`, "has no definition"},
+		{`{"measurez":[]}`, "measurez"},
+	} {
+		if _, err := glik.ParseCatalog([]byte(test.catalog)); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got %v, want %q", test.catalog, err, test.err)
+		}
+	}
+}
+
+func TestSyncMasterItems(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	// the measure was made by the client, without a description or tags
+	server.Handle("GenericMeasure.GetProperties", func(call *enginetest.Call) (interface{}, error) {
+		properties := call.Object().Properties
+		delete(properties["qMetaDef"].(map[string]interface{}), "tags")
+		delete(properties["qMetaDef"].(map[string]interface{}), "description")
+		return map[string]interface{}{"qProp": properties}, nil
+	})
+	var patches []glik.NxPatch
+	server.Handle("GenericMeasure.ApplyPatches", func(call *enginetest.Call) (interface{}, error) {
+		return nil, call.Arg(0, "qPatches", &patches)
+	})
+	doc := openTestDoc(t, server, "Sales.qvf")
+	for _, properties := range []glik.GenericMeasureProperties{
+		glik.NewMeasureProperties("kpi-revenue", "Revenue", "Sum(Sale)"),
+		glik.NewMeasureProperties("old", "Old", "Count(Id)"),
+	} {
+		if _, err := doc.CreateMeasure(properties); err != nil {
+			t.Fatal(err)
+		}
+	}
+	catalog, err := glik.ParseCatalog([]byte(testCatalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := glik.SyncMasterItems(doc, catalog, glik.SyncOptions{DryRun: true, Prune: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "create dimension dim-region (Region)\nupdate measure kpi-revenue (Revenue): tags, expression\ndelete measure old (Old)"
+	if plan.String() != want {
+		t.Errorf("got plan\n%s\nwant\n%s", plan, want)
+	}
+	if items, _ := doc.Dimensions(); len(items) != 0 || patches != nil {
+		t.Fatalf("a dry run changed the app: %+v %+v", items, patches)
+	}
+	if _, err := glik.SyncMasterItems(doc, catalog, glik.SyncOptions{Prune: true}); err != nil {
+		t.Fatal(err)
+	}
+	wantPatches := []glik.NxPatch{
+		{Op: glik.PATCH_ADD, Path: "/qMetaDef/tags", Value: `["kpi"]`},
+		{Op: glik.PATCH_REPLACE, Path: "/qMeasure/qDef", Value: `"Sum(Sales)"`},
+	}
+	if fmt.Sprint(patches) != fmt.Sprint(wantPatches) {
+		t.Errorf("got patches %+v, want %+v", patches, wantPatches)
+	}
+	dimensions, err := doc.Dimensions()
+	if err != nil || len(dimensions) != 1 || dimensions[0].Id != "dim-region" {
+		t.Errorf("got %+v, %v", dimensions, err)
+	}
+	measures, err := doc.Measures()
+	if err != nil || len(measures) != 1 || measures[0].Id != "kpi-revenue" {
+		t.Errorf("got %+v, %v", measures, err)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+const APP_OBJECT_LIST_TYPE = "AppObjectList"
+const MASTER_OBJECT_TYPE = "masterobject"
+
+// AppObjectItem is an object as listed by AppObjects and Sheets.
+type AppObjectItem struct {
+	Id          string
+	Type        string
+	Title       string
+	Description string
+	Rank        float64
+}
+
+// Sheets lists the app's sheets in the order of their rank.
+func (d *Doc) Sheets() ([]AppObjectItem, error) {
+	retval, err := d.AppObjects(SHEET_TYPE)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(retval, func(i, j int) bool { return retval[i].Rank < retval[j].Rank })
+	return retval, nil
+}
+
+// AppObjects lists the app's top level objects of a type, e.g. SHEET_TYPE or
+// MASTER_OBJECT_TYPE, through a session app object list object.
+func (d *Doc) AppObjects(objectType string) ([]AppObjectItem, error) {
+	properties := map[string]interface{}{
+		"qInfo": NxInfo{Type: APP_OBJECT_LIST_TYPE},
+		"qAppObjectListDef": map[string]interface{}{
+			"qType": objectType,
+			"qData": map[string]string{"title": "/qMetaDef/title", "description": "/qMetaDef/description", "rank": "/rank"},
+		},
+	}
+	object, err := d.CreateSessionObject(properties)
+	if err != nil {
+		return nil, err
+	}
+	defer d.DestroySessionObject(object.Id)
+	var layout struct {
+		AppObjectList struct {
+			Items []struct {
+				Info NxInfo `json:"qInfo"`
+				Data struct {
+					Title       string  `json:"title"`
+					Description string  `json:"description"`
+					Rank        float64 `json:"rank"`
+				} `json:"qData"`
+			} `json:"qItems"`
+		} `json:"qAppObjectList"`
+	}
+	err = object.GetLayout(&layout)
+	if err != nil {
+		return nil, err
+	}
+	retval := []AppObjectItem{}
+	for _, item := range layout.AppObjectList.Items {
+		retval = append(retval, AppObjectItem{Id: item.Info.Id, Type: item.Info.Type, Title: item.Data.Title, Description: item.Data.Description, Rank: item.Data.Rank})
+	}
+	return retval, nil
+}
+
+// GetChildInfos lists the objects owned by this one, e.g. the charts of a sheet.
+func (o *GenericObject) GetChildInfos() ([]NxInfo, error) {
+	var result struct {
+		Infos []NxInfo `json:"qInfos"`
+	}
+	err := o.call("GetChildInfos", nil, &result)
+	return result.Infos, err
+}
+
+// GenericObjectEntry is the properties of an object with those of its children.
+type GenericObjectEntry struct {
+	Property json.RawMessage      `json:"qProperty"`
+	Children []GenericObjectEntry `json:"qChildren"`
+}
+
+// GetFullPropertyTree returns the properties of the object and all its descendants.
+func (o *GenericObject) GetFullPropertyTree() (GenericObjectEntry, error) {
+	var result struct {
+		Entry GenericObjectEntry `json:"qPropEntry"`
+	}
+	err := o.call("GetFullPropertyTree", nil, &result)
+	return result.Entry, err
+}
+
+// SetFullPropertyTree replaces the properties of the object and its descendants,
+// children missing from entry are destroyed.
+func (o *GenericObject) SetFullPropertyTree(entry GenericObjectEntry) error {
+	return o.call("SetFullPropertyTree", []interface{}{entry}, nil)
+}
+
+// ObjectNode is an object of the app with what it shows. Dimensions holds field
+// definitions and Measures expressions defined in the object, MasterDimensions and
+// MasterMeasures the ids of the master items it links to.
+type ObjectNode struct {
+	Id               string
+	Type             string
+	Title            string
+	Dimensions       []string
+	Measures         []string
+	MasterDimensions []string
+	MasterMeasures   []string
+	Children         []ObjectNode
+}
+
+// Walk calls fn for the node and then for all its descendants, depth first.
+func (n ObjectNode) Walk(fn func(node ObjectNode)) {
+	fn(n)
+	for _, child := range n.Children {
+		child.Walk(fn)
+	}
+}
+
+// ObjectTree returns the app's sheets, in the order of their rank, with the objects on them.
+func (d *Doc) ObjectTree() ([]ObjectNode, error) {
+	sheets, err := d.Sheets()
+	if err != nil {
+		return nil, err
+	}
+	retval := []ObjectNode{}
+	for _, sheet := range sheets {
+		object, err := d.GetObject(sheet.Id)
+		if err != nil {
+			return nil, err
+		}
+		node, err := object.Tree()
+		if err != nil {
+			return nil, err
+		}
+		retval = append(retval, node)
+	}
+	return retval, nil
+}
+
+// Tree returns the object with its descendants, from its full property tree.
+func (o *GenericObject) Tree() (ObjectNode, error) {
+	entry, err := o.GetFullPropertyTree()
+	if err != nil {
+		return ObjectNode{}, err
+	}
+	return entry.Node()
+}
+
+type entryProperties struct {
+	Info    NxInfo          `json:"qInfo"`
+	Title   json.RawMessage `json:"title"`
+	MetaDef struct {
+		Title string `json:"title"`
+	} `json:"qMetaDef"`
+	HyperCubeDef *struct {
+		Dimensions []NxDimension `json:"qDimensions"`
+		Measures   []NxMeasure   `json:"qMeasures"`
+	} `json:"qHyperCubeDef"`
+	ListObjectDef *NxDimension `json:"qListObjectDef"`
+}
+
+// Node parses the entry into an ObjectNode.
+func (e GenericObjectEntry) Node() (ObjectNode, error) {
+	var properties entryProperties
+	if len(e.Property) > 0 {
+		err := json.Unmarshal(e.Property, &properties)
+		if err != nil {
+			return ObjectNode{}, err
+		}
+	}
+	retval := ObjectNode{
+		Id:               properties.Info.Id,
+		Type:             properties.Info.Type,
+		Title:            titleOf(properties.Title),
+		Dimensions:       []string{},
+		Measures:         []string{},
+		MasterDimensions: []string{},
+		MasterMeasures:   []string{},
+		Children:         []ObjectNode{},
+	}
+	if len(retval.Title) == 0 {
+		retval.Title = properties.MetaDef.Title
+	}
+	dimensions := []NxDimension{}
+	if properties.HyperCubeDef != nil {
+		dimensions = append(dimensions, properties.HyperCubeDef.Dimensions...)
+		for _, measure := range properties.HyperCubeDef.Measures {
+			if len(measure.LibraryId) > 0 {
+				retval.MasterMeasures = append(retval.MasterMeasures, measure.LibraryId)
+			} else {
+				retval.Measures = append(retval.Measures, measure.Def.Def)
+			}
+		}
+	}
+	if properties.ListObjectDef != nil {
+		dimensions = append(dimensions, *properties.ListObjectDef)
+	}
+	for _, dimension := range dimensions {
+		if len(dimension.LibraryId) > 0 {
+			retval.MasterDimensions = append(retval.MasterDimensions, dimension.LibraryId)
+		} else {
+			retval.Dimensions = append(retval.Dimensions, dimension.Def.FieldDefs...)
+		}
+	}
+	for _, child := range e.Children {
+		node, err := child.Node()
+		if err != nil {
+			return retval, err
+		}
+		retval.Children = append(retval.Children, node)
+	}
+	return retval, nil
+}
+
+// titleOf reads a title that is either text or a string expression, which is returned
+// as its expression.
+func titleOf(data json.RawMessage) string {
+	var title string
+	if json.Unmarshal(data, &title) == nil {
+		return title
+	}
+	var expression struct {
+		StringExpression struct {
+			Expr string `json:"qExpr"`
+		} `json:"qStringExpression"`
+	}
+	json.Unmarshal(data, &expression)
+	return expression.StringExpression.Expr
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"testing"
+)
+
+func TestObjectTree(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	doc := openTestDoc(t, server, "Sales.qvf")
+	if _, err := createLanding(doc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.NewSheet("first", "First").Rank(1).Create(); err != nil {
+		t.Fatal(err)
+	}
+	sheets, err := doc.Sheets()
+	if err != nil || len(sheets) != 2 || sheets[0].Id != "first" || sheets[1].Id != "landing" || sheets[1].Title != "Overview" {
+		t.Fatalf("got %+v, %v", sheets, err)
+	}
+	tree, err := doc.ObjectTree()
+	if err != nil || len(tree) != 2 {
+		t.Fatalf("got %+v, %v", tree, err)
+	}
+	if tree[0].Id != "first" || len(tree[0].Children) != 0 {
+		t.Errorf("got %+v", tree[0])
+	}
+	nodes := map[string]glik.ObjectNode{}
+	listBoxes := []string{}
+	tree[1].Walk(func(node glik.ObjectNode) {
+		if node.Type == glik.VIZ_LISTBOX {
+			listBoxes = append(listBoxes, node.Dimensions...)
+		}
+		nodes[node.Type] = node
+	})
+	if landing := nodes[glik.SHEET_TYPE]; landing.Title != "Overview" || len(landing.Children) != 3 {
+		t.Errorf("got sheet %+v", landing)
+	}
+	if kpi := nodes[glik.VIZ_KPI]; kpi.Title != "Revenue" || fmt.Sprint(kpi.MasterMeasures) != "[kpi-revenue]" || len(kpi.Measures) != 0 {
+		t.Errorf("got kpi %+v", kpi)
+	}
+	bar := nodes[glik.VIZ_BARCHART]
+	if fmt.Sprint(bar.MasterDimensions) != "[dim-region]" || fmt.Sprint(bar.Measures) != "[Sum(Sales)]" || len(bar.Dimensions) != 0 {
+		t.Errorf("got bar chart %+v", bar)
+	}
+	if pane := nodes[glik.VIZ_FILTERPANE]; len(pane.Children) != 2 || len(listBoxes) != 2 {
+		t.Errorf("got filter pane %+v with %v", pane, listBoxes)
+	}
+}
+
+func TestSetFullPropertyTree(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	doc := openTestDoc(t, server, "Sales.qvf")
+	sheet, err := createLanding(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := sheet.GetFullPropertyTree()
+	if err != nil || len(entry.Children) != 3 {
+		t.Fatalf("got %+v, %v", entry, err)
+	}
+	entry.Children = entry.Children[:1]
+	if err := sheet.SetFullPropertyTree(entry); err != nil {
+		t.Fatal(err)
+	}
+	if infos, err := sheet.GetChildInfos(); err != nil || len(infos) != 1 {
+		t.Errorf("got %+v, %v", infos, err)
+	}
+	if items, err := doc.AppObjects(glik.SHEET_TYPE); err != nil || len(items) != 1 {
+		t.Errorf("got %+v, %v", items, err)
+	}
+}
+
+func TestEntryNodeTitles(t *testing.T) {
+	for _, test := range []struct {
+		property, title string
+	}{
+		{`{"qInfo":{"qId":"a","qType":"kpi"},"title":"Revenue"}`, "Revenue"},
+		{`{"qInfo":{"qId":"a","qType":"kpi"},"title":{"qStringExpression":{"qExpr":"='Sales '&Year(Today())"}}}`, "='Sales '&Year(Today())"},
+		{`{"qInfo":{"qId":"a","qType":"sheet"},"qMetaDef":{"title":"Overview"}}`, "Overview"},
+		{`{"qInfo":{"qId":"a","qType":"sheet"},"title":"","qMetaDef":{"title":"Overview"}}`, "Overview"},
+	} {
+		node, err := glik.GenericObjectEntry{Property: json.RawMessage(test.property)}.Node()
+		if err != nil || node.Title != test.title || node.Id != "a" {
+			t.Errorf("%s: got %+v, %v", test.property, node, err)
+		}
+	}
+	if _, err := (glik.GenericObjectEntry{Property: json.RawMessage(`[]`)}).Node(); err == nil {
+		t.Error("expected an error for properties that are not an object")
+	}
+}
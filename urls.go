@@ -0,0 +1,100 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const qrs_service = "qrs"
+const qps_service = "qps"
+const engine_service = "app"
+
+// qrsUrl builds the url of a QRS endpoint, e.g. qrsUrl("app/"+id+"/copy", query).
+// Direct:        https://server:4242/qrs/<path>
+// Proxy routed:  https://server:443/<prefix>/qrs/<path>
+func (api *API) qrsUrl(path string, query url.Values) string {
+	if api.ProxyRouted {
+		return api.buildUrl("https", api.ProxyPort, joinPath(api.VirtualProxy, qrs_service, path), query)
+	}
+	return api.buildUrl("https", api.QrsPort, joinPath(qrs_service, path), query)
+}
+
+// qpsUrl builds the url of a QPS endpoint. The QPS API is never exposed through the
+// proxy, it always lives on the auth port and takes the virtual proxy prefix after /qps.
+// https://server:4243/qps/<prefix>/<path>
+func (api *API) qpsUrl(path string, query url.Values) string {
+	return api.buildUrl("https", api.AuthPort, joinPath(qps_service, api.VirtualProxy, path), query)
+}
+
+// engineUrl builds the websocket url of the Engine, optionally bound to an app.
+// Direct:        wss://server:4747/app/<appId>
+// Proxy routed:  wss://server:443/<prefix>/app/<appId>
+func (api *API) engineUrl(appId string) string {
+	path := engine_service
+	if len(appId) > 0 {
+		path += "/" + url.PathEscape(appId)
+	}
+	if api.ProxyRouted {
+		return api.buildUrl("wss", api.ProxyPort, joinPath(api.VirtualProxy, path), nil)
+	}
+	return api.buildUrl("wss", api.WebsocketPort, path, nil)
+}
+
+// proxyUrl builds the url of content served by the proxy, such as the /tempcontent
+// files written by ExportData, from the path and query the engine returned. The
+// engine includes the virtual proxy prefix when the session came through the proxy.
+// https://server:443/<prefix>/<path>
+func (api *API) proxyUrl(path string, query url.Values) string {
+	path = joinPath(path)
+	if len(api.VirtualProxy) > 0 && !strings.HasPrefix(path+"/", joinPath(api.VirtualProxy)+"/") {
+		path = joinPath(api.VirtualProxy, path)
+	}
+	return api.buildUrl("https", api.ProxyPort, path, query)
+}
+
+// origin is the Origin header sent when opening the websocket, the proxy and engine
+// reject origins that are not whitelisted for the virtual proxy.
+func (api *API) origin() string {
+	if len(api.Origin) > 0 {
+		return api.Origin
+	}
+	return "https://" + api.Server
+}
+
+func (api *API) buildUrl(scheme string, port int, path string, query url.Values) string {
+	retval := fmt.Sprintf("%s://%s:%v/%s", scheme, api.Server, port, path)
+	if len(query) > 0 {
+		retval += "?" + query.Encode()
+	}
+	return retval
+}
+
+// joinPath joins url path segments, skipping empty ones and stray slashes.
+func joinPath(segments ...string) string {
+	parts := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		segment = strings.Trim(segment, "/")
+		if len(segment) > 0 {
+			parts = append(parts, segment)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func xrfQuery(xrfKey string) url.Values {
+	query := url.Values{}
+	query.Set("xrfkey", xrfKey)
+	return query
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestUrlsDirect(t *testing.T) {
+	api := NewAPI("sense", DEFAULT_DIR, "admin", DEFAULT_QRS_PORT, DEFAULT_AUTH_PORT, DEFAULT_WEBSOCKET_PORT)
+	query := xrfQuery("abcdefghijklmnop")
+	query.Set("name", "a b&c")
+	tests := []struct {
+		name, got, want string
+	}{
+		{"qrs", api.qrsUrl("app/1/copy", query), "https://sense:4242/qrs/app/1/copy?name=a+b%26c&xrfkey=abcdefghijklmnop"},
+		{"qps", api.qpsUrl("ticket", nil), "https://sense:4243/qps/ticket"},
+		{"engine", api.engineUrl(""), "wss://sense:4747/app"},
+		{"engine app", api.engineUrl("C:\\apps\\a b.qvf"), "wss://sense:4747/app/C:%5Capps%5Ca%20b.qvf"},
+		{"proxy", api.proxyUrl("/tempcontent/x.csv", nil), "https://sense:443/tempcontent/x.csv"},
+		{"origin", api.origin(), "https://sense"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestUrlsProxyRouted(t *testing.T) {
+	api := NewAPI("sense", DEFAULT_DIR, "admin", DEFAULT_QRS_PORT, DEFAULT_AUTH_PORT, DEFAULT_WEBSOCKET_PORT)
+	api.UseProxy(8443, "/hdr/")
+	api.Origin = "https://portal"
+	tests := []struct {
+		name, got, want string
+	}{
+		{"qrs", api.qrsUrl("about", url.Values{}), "https://sense:8443/hdr/qrs/about"},
+		{"qps stays on the auth port", api.qpsUrl("/ticket", nil), "https://sense:4243/qps/hdr/ticket"},
+		{"engine", api.engineUrl("1234"), "wss://sense:8443/hdr/app/1234"},
+		{"proxy adds the prefix", api.proxyUrl("tempcontent/x.csv", nil), "https://sense:8443/hdr/tempcontent/x.csv"},
+		{"proxy keeps the engine's prefix", api.proxyUrl("/hdr/tempcontent/x.csv", nil), "https://sense:8443/hdr/tempcontent/x.csv"},
+		{"proxy prefix match is by segment", api.proxyUrl("/hdrx/a", nil), "https://sense:8443/hdr/hdrx/a"},
+		{"origin", api.origin(), "https://portal"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	if got := joinPath("", "/a/", "", "b/c/", "/"); got != "a/b/c" {
+		t.Errorf("got %q", got)
+	}
+	if got := joinPath(); got != "" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik
+
+const VARIABLE_TYPE = "variable"
+const VARIABLE_LIST_TYPE = "VariableList"
+
+// FieldAttributes is a number format, e.g. {Type: "M", Fmt: "$#,##0.00"}.
+type FieldAttributes struct {
+	Type    string `json:"qType"`
+	NDec    int    `json:"qnDec,omitempty"`
+	UseThou int    `json:"qUseThou,omitempty"`
+	Fmt     string `json:"qFmt,omitempty"`
+	Dec     string `json:"qDec,omitempty"`
+	Thou    string `json:"qThou,omitempty"`
+}
+
+type GenericVariableProperties struct {
+	Info               NxInfo           `json:"qInfo"`
+	Name               string           `json:"qName"`
+	Comment            string           `json:"qComment"`
+	Definition         string           `json:"qDefinition"`
+	IncludeInBookmark  bool             `json:"qIncludeInBookmark"`
+	NumberPresentation *FieldAttributes `json:"qNumberPresentation,omitempty"`
+}
+
+// VariableLayout holds the evaluated value of a variable, Num is NaN for text values.
+type VariableLayout struct {
+	Info            NxInfo `json:"qInfo"`
+	Name            string `json:"qName"`
+	Text            string `json:"qText"`
+	Num             NxNum  `json:"qNum"`
+	IsScriptCreated bool   `json:"qIsScriptCreated"`
+}
+
+// NewVariableProperties defines a variable, definition is its text or an expression
+// starting with "=".
+func NewVariableProperties(name, definition, comment string) GenericVariableProperties {
+	return GenericVariableProperties{Info: NxInfo{Type: VARIABLE_TYPE}, Name: name, Definition: definition, Comment: comment}
+}
+
+// GenericVariable is a variable of an app, see the GenericVariable class of the engine api.
+type GenericVariable struct {
+	api    *API
+	Handle int
+	Id     string
+	Name   string
+}
+
+// CreateVariableEx creates a variable from properties.
+func (d *Doc) CreateVariableEx(properties GenericVariableProperties) (*GenericVariable, error) {
+	handle, id, err := d.createItem("CreateVariableEx", properties)
+	if err != nil {
+		return nil, err
+	}
+	return &GenericVariable{api: d.api, Handle: handle.Handle, Id: id, Name: properties.Name}, nil
+}
+
+// GetVariableByName returns ErrDoesNotExist if the app has no variable with the name.
+func (d *Doc) GetVariableByName(name string) (*GenericVariable, error) {
+	handle, err := d.api.callForHandle(d.Handle, "GetVariableByName", []interface{}{name})
+	if err != nil {
+		return nil, err
+	}
+	return &GenericVariable{api: d.api, Handle: handle.Handle, Id: handle.GenericId, Name: name}, nil
+}
+
+// GetVariableById returns ErrDoesNotExist if the app has no variable with the id.
+func (d *Doc) GetVariableById(id string) (*GenericVariable, error) {
+	handle, err := d.api.callForHandle(d.Handle, "GetVariableById", []interface{}{id})
+	if err != nil {
+		return nil, err
+	}
+	return &GenericVariable{api: d.api, Handle: handle.Handle, Id: id}, nil
+}
+
+// CreateSessionVariable creates a variable that lives as long as the websocket session.
+func (d *Doc) CreateSessionVariable(properties GenericVariableProperties) (*GenericVariable, error) {
+	handle, id, err := d.createItem("CreateSessionVariable", properties)
+	if err != nil {
+		return nil, err
+	}
+	return &GenericVariable{api: d.api, Handle: handle.Handle, Id: id, Name: properties.Name}, nil
+}
+
+func (d *Doc) DestroySessionVariable(id string) (bool, error) {
+	return d.destroyItem("DestroySessionVariable", id)
+}
+
+func (d *Doc) DestroyVariableByName(name string) (bool, error) {
+	return d.destroyItem("DestroyVariableByName", name)
+}
+
+func (d *Doc) DestroyVariableById(id string) (bool, error) {
+	return d.destroyItem("DestroyVariableById", id)
+}
+
+// VariableItem is a variable as listed by Variables. Script created variables are
+// reset by every reload, reserved and config variables are never listed.
+type VariableItem struct {
+	Id              string
+	Name            string
+	Definition      string
+	Description     string
+	IsScriptCreated bool
+}
+
+// Variables lists the app's variables, through a session variable list object.
+func (d *Doc) Variables() ([]VariableItem, error) {
+	properties := map[string]interface{}{
+		"qInfo": NxInfo{Type: VARIABLE_LIST_TYPE},
+		"qVariableListDef": map[string]interface{}{
+			"qType":         VARIABLE_TYPE,
+			"qShowReserved": false,
+			"qShowConfig":   false,
+		},
+	}
+	object, err := d.CreateSessionObject(properties)
+	if err != nil {
+		return nil, err
+	}
+	defer d.DestroySessionObject(object.Id)
+	var layout struct {
+		VariableList struct {
+			Items []struct {
+				Info            NxInfo `json:"qInfo"`
+				Name            string `json:"qName"`
+				Definition      string `json:"qDefinition"`
+				Description     string `json:"qDescription"`
+				IsScriptCreated bool   `json:"qIsScriptCreated"`
+			} `json:"qItems"`
+		} `json:"qVariableList"`
+	}
+	err = object.GetLayout(&layout)
+	if err != nil {
+		return nil, err
+	}
+	retval := []VariableItem{}
+	for _, item := range layout.VariableList.Items {
+		retval = append(retval, VariableItem{Id: item.Info.Id, Name: item.Name, Definition: item.Definition, Description: item.Description, IsScriptCreated: item.IsScriptCreated})
+	}
+	return retval, nil
+}
+
+func (v *GenericVariable) call(method string, params interface{}, result interface{}) error {
+	return v.api.call(v.Handle, method, params, result)
+}
+
+func (v *GenericVariable) GetProperties() (GenericVariableProperties, error) {
+	var result struct {
+		Properties GenericVariableProperties `json:"qProp"`
+	}
+	err := v.call("GetProperties", nil, &result)
+	return result.Properties, err
+}
+
+func (v *GenericVariable) SetProperties(properties GenericVariableProperties) error {
+	return v.call("SetProperties", []interface{}{properties}, nil)
+}
+
+func (v *GenericVariable) ApplyPatches(patches []NxPatch) error {
+	return v.call("ApplyPatches", []interface{}{patches}, nil)
+}
+
+// GetLayout evaluates the variable.
+func (v *GenericVariable) GetLayout() (VariableLayout, error) {
+	var result struct {
+		Layout VariableLayout `json:"qLayout"`
+	}
+	err := v.call("GetLayout", nil, &result)
+	return result.Layout, err
+}
+
+// Value is the evaluated value of the variable as text.
+func (v *GenericVariable) Value() (string, error) {
+	layout, err := v.GetLayout()
+	return layout.Text, err
+}
+
+// SetStringValue replaces the definition with the text.
+func (v *GenericVariable) SetStringValue(value string) error {
+	return v.call("SetStringValue", []interface{}{value}, nil)
+}
+
+func (v *GenericVariable) SetNumValue(value float64) error {
+	return v.call("SetNumValue", []interface{}{value}, nil)
+}
+
+// SetDualValue sets a value with both a text and a number, e.g. ("Q1", 1).
+func (v *GenericVariable) SetDualValue(text string, num float64) error {
+	return v.call("SetDualValue", []interface{}{text, num}, nil)
+}
+
+// Variable is a variable through the older Variable class of the engine api, addressed by name.
+type Variable struct {
+	api    *API
+	Handle int
+	Name   string
+}
+
+// VariableContent is the value of a Variable, Number is set when IsNum.
+type VariableContent struct {
+	String string  `json:"qString"`
+	IsNum  bool    `json:"qIsNum"`
+	Number float64 `json:"qNumber"`
+}
+
+// GetVariable returns ErrDoesNotExist if the app has no variable with the name.
+func (d *Doc) GetVariable(name string) (*Variable, error) {
+	handle, err := d.api.callForHandle(d.Handle, "GetVariable", []interface{}{name})
+	if err != nil {
+		return nil, err
+	}
+	return &Variable{api: d.api, Handle: handle.Handle, Name: name}, nil
+}
+
+// CreateVariable creates an empty variable, false if one with the name exists.
+func (d *Doc) CreateVariable(name string) (bool, error) {
+	var result struct {
+		Return bool `json:"qReturn"`
+	}
+	err := d.call("CreateVariable", []interface{}{name}, &result)
+	return result.Return, err
+}
+
+func (d *Doc) RemoveVariable(name string) (bool, error) {
+	var result struct {
+		Return bool `json:"qReturn"`
+	}
+	err := d.call("RemoveVariable", []interface{}{name}, &result)
+	return result.Return, err
+}
+
+func (v *Variable) call(method string, params interface{}, result interface{}) error {
+	return v.api.call(v.Handle, method, params, result)
+}
+
+// GetContent is the evaluated value.
+func (v *Variable) GetContent() (VariableContent, error) {
+	var result struct {
+		Content VariableContent `json:"qContent"`
+	}
+	err := v.call("GetContent", nil, &result)
+	return result.Content, err
+}
+
+// GetRawContent is the definition, unevaluated.
+func (v *Variable) GetRawContent() (string, error) {
+	var result struct {
+		Return string `json:"qReturn"`
+	}
+	err := v.call("GetRawContent", nil, &result)
+	return result.Return, err
+}
+
+// SetContent sets the definition, updateMRU adds it to the variable's recently used values.
+func (v *Variable) SetContent(content string, updateMRU bool) (bool, error) {
+	var result struct {
+		Return bool `json:"qReturn"`
+	}
+	err := v.call("SetContent", []interface{}{content, updateMRU}, &result)
+	return result.Return, err
+}
+
+// ForceContent sets a dual value without evaluating it.
+func (v *Variable) ForceContent(text string, num float64) error {
+	return v.call("ForceContent", []interface{}{text, num}, nil)
+}
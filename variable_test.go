@@ -0,0 +1,112 @@
+// Copyright 2016 Matthew Baird
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glik_test
+
+import (
+	"github.com/mattbaird/glik"
+	"github.com/mattbaird/glik/enginetest"
+	"testing"
+)
+
+func TestVariableRoundTrip(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	doc := openTestDoc(t, server, "Sales.qvf")
+	created, err := doc.CreateVariableEx(glik.NewVariableProperties("vYear", "2016", "the reporting year"))
+	if err != nil || len(created.Id) == 0 || created.Name != "vYear" {
+		t.Fatalf("got %+v, %v", created, err)
+	}
+	if _, err := doc.CreateVariableEx(glik.NewVariableProperties("vYear", "2017", "")); err == nil {
+		t.Error("expected an error creating a variable twice")
+	}
+	items, err := doc.Variables()
+	if err != nil || len(items) != 1 || items[0].Name != "vYear" || items[0].Definition != "2016" || items[0].Description != "the reporting year" || items[0].Id != created.Id {
+		t.Fatalf("got %+v, %v", items, err)
+	}
+	variable, err := doc.GetVariableByName("vYear")
+	if err != nil || variable.Id != created.Id {
+		t.Fatalf("got %+v, %v", variable, err)
+	}
+	if properties, err := variable.GetProperties(); err != nil || properties.Definition != "2016" || properties.Info.Type != glik.VARIABLE_TYPE {
+		t.Errorf("got %+v, %v", properties, err)
+	}
+	if err := variable.SetNumValue(2017); err != nil {
+		t.Fatal(err)
+	}
+	layout, err := variable.GetLayout()
+	if err != nil || layout.Text != "2017" || float64(layout.Num) != 2017 {
+		t.Errorf("got %+v, %v", layout, err)
+	}
+	if err := variable.SetStringValue("last year"); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := variable.Value(); err != nil || value != "last year" {
+		t.Errorf("got %q, %v", value, err)
+	}
+	if ok, err := doc.DestroyVariableByName("vYear"); err != nil || !ok {
+		t.Errorf("got %v, %v", ok, err)
+	}
+	if _, err := doc.GetVariableByName("vYear"); err != glik.ErrDoesNotExist {
+		t.Errorf("got %v for a destroyed variable", err)
+	}
+}
+
+func TestSessionVariable(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	app := server.AddDoc("Sales.qvf", "")
+	doc := openTestDoc(t, server, "Sales.qvf")
+	variable, err := doc.CreateSessionVariable(glik.NewVariableProperties("vTemp", "1", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object := app.Objects[variable.Id]; object == nil || !object.Session {
+		t.Errorf("got %+v", object)
+	}
+	if ok, err := doc.DestroySessionVariable(variable.Id); err != nil || !ok || app.Objects[variable.Id] != nil {
+		t.Errorf("got %v, %v", ok, err)
+	}
+}
+
+func TestVariableContent(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	server.AddDoc("Sales.qvf", "")
+	content := "=Year(Today())"
+	server.Handle("Doc.GetVariable", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qReturn": call.Session.NewHandle("Variable", call.Doc(), nil)}, nil
+	})
+	server.Handle("Variable.GetRawContent", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qReturn": content}, nil
+	})
+	server.Handle("Variable.GetContent", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qContent": glik.VariableContent{String: "2016", IsNum: true, Number: 2016}}, nil
+	})
+	server.Handle("Variable.SetContent", func(call *enginetest.Call) (interface{}, error) {
+		return map[string]interface{}{"qReturn": true}, call.Arg(0, "qContent", &content)
+	})
+	doc := openTestDoc(t, server, "Sales.qvf")
+	variable, err := doc.GetVariable("vYear")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, err := variable.GetRawContent(); err != nil || raw != "=Year(Today())" {
+		t.Errorf("got %q, %v", raw, err)
+	}
+	if value, err := variable.GetContent(); err != nil || !value.IsNum || value.Number != 2016 {
+		t.Errorf("got %+v, %v", value, err)
+	}
+	if ok, err := variable.SetContent("2017", false); err != nil || !ok || content != "2017" {
+		t.Errorf("got %v, %v, content %q", ok, err, content)
+	}
+}